@@ -39,7 +39,20 @@ func main() {
 			},
 			&cli.BoolFlag{
 				Name:  "no-sort",
-				Usage: "Disable sorting files by Git commit frequency.",
+				Usage: "Disable ordering files, keeping the order in which they were listed. Same as --order none.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "order",
+				Usage: "Order files by these strategies, each breaking the ties of the previous ones: path, churn, commits, modified (modified:git or modified:mtime), size, tokens, docs, deps or priority, with an optional :desc suffix (e.g. 'docs,modified:mtime:desc,path'). Defaults to commits,path.",
+			},
+			&cli.StringFlag{
+				Name:  "churn-half-life",
+				Usage: "Age at which a commit counts half as much towards the churn score of the files it touched, such as 90d, 2w or 1y, or 0 to count every commit fully. Defaults to 90d.",
+				Value: "90d",
+			},
+			&cli.StringFlag{
+				Name:  "churn-since",
+				Usage: "Only count commits more recent than this date towards churn scores, in any format git accepts (e.g. '6.months' or '2024-01-01').",
 			},
 			&cli.BoolFlag{
 				Name:  "ignore-secrets",
@@ -55,24 +68,145 @@ func main() {
 			},
 			&cli.StringFlag{
 				Name:  "token-count-mode",
-				Usage: "Token counting mode: fast (default) or exact (slower).",
+				Usage: "Token counting mode: fast, exact, or approximate. Fast estimates outputs over 1 MiB from samples, and approximate uses characters per token without a tokenizer. Defaults to fast.",
 				Value: "fast",
 			},
+			&cli.StringFlag{
+				Name:  "tokenizer",
+				Usage: "Encoding to count tokens with (o200k, cl100k, p50k, or r50k). Defaults to o200k.",
+				Value: "o200k",
+			},
 			&cli.StringFlag{
 				Name:  "format",
-				Usage: "Output format (md, xml, or txt). Defaults to md.",
+				Usage: "Output format (md, xml, txt, json, or jsonl). Defaults to md.",
 				Value: "md",
 			},
+			&cli.StringFlag{
+				Name:  "source",
+				Usage: "File source (fs or git). With git, files come from 'git ls-files', falling back to fs outside a repository. Defaults to fs.",
+				Value: "fs",
+			},
+			&cli.StringFlag{
+				Name:  "ref",
+				Usage: "Read files as they are at the given Git ref, such as a tag or commit, from the repository instead of the working tree. Overrides --source.",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Only include files added or modified since the merge base of the given Git ref and HEAD, such as main. Deleted and renamed files are listed separately.",
+			},
+			&cli.BoolFlag{
+				Name:  "staged",
+				Usage: "Only include files with staged changes. Deleted and renamed files are listed separately.",
+			},
+			&cli.BoolFlag{
+				Name:  "worktree",
+				Usage: "Only include files with uncommitted changes, staged or not. Deleted and renamed files are listed separately.",
+			},
+			&cli.StringFlag{
+				Name:  "diff",
+				Usage: "Include the unified diffs of changed files, after each file (file) or in one section after all files (combined). Requires --since, --staged or --worktree.",
+			},
+			&cli.BoolFlag{
+				Name:  "diff-only",
+				Usage: "Leave out the full content of files that have a diff, keeping only the diff. Requires --diff.",
+			},
+			&cli.StringFlag{
+				Name:  "template",
+				Usage: "Render output with a Go text/template, given as a file path or as the name of a template in the config directory's templates folder or a built-in template (md, xml, txt). Overrides --format.",
+			},
+			&cli.StringFlag{
+				Name:  "xml-style",
+				Usage: "Style of the xml format (loose or strict). Strict produces well-formed XML with CDATA content. Defaults to loose.",
+				Value: "loose",
+			},
 			&cli.IntFlag{
 				Name:  "high-token-threshold",
 				Usage: "Threshold for warning about files with high token counts. Defaults to 5000.",
 				Value: 5000,
 			},
+			&cli.IntFlag{
+				Name:  "chunk-tokens",
+				Usage: "Maximum number of tokens per chunk in the jsonl format. Defaults to 512.",
+			},
+			&cli.IntFlag{
+				Name:  "chunk-overlap",
+				Usage: "Number of tokens shared by consecutive chunks in the jsonl format. Defaults to 64.",
+			},
+			&cli.IntFlag{
+				Name:    "jobs",
+				Aliases: []string{"j"},
+				Usage:   "Number of files to read and process concurrently. Defaults to the number of CPUs.",
+			},
+			&cli.IntFlag{
+				Name:  "max-tokens",
+				Usage: "Token budget for file contents. Files are packed in priority order until the budget is met, and the rest are omitted.",
+			},
+			&cli.IntFlag{
+				Name:  "split-tokens",
+				Usage: "Split the output into self-contained parts of at most this many tokens, written as <output>.part1.<ext>, <output>.part2.<ext>, and so on.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "priority",
+				Usage: "Adjust the packing priority of files matching a gitignore-style pattern, as pattern=weight (e.g. 'docs/**=-10'). Can be repeated.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "include",
+				Usage: "Only include files matching this gitignore-style pattern (e.g. 'internal/**/*.go'). Can be repeated.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Exclude files and directories matching this gitignore-style pattern (e.g. '**/*_test.go'). Can be repeated.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ext",
+				Usage: "Allow an additional file extension for this run (e.g. 'hcl'). Can be repeated.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "no-ext",
+				Usage: "Disallow a file extension for this run (e.g. 'txt'). Can be repeated.",
+			},
+			&cli.BoolFlag{
+				Name:  "no-shebang",
+				Usage: "Disable including extensionless files based on their shebang line (e.g. '#!/usr/bin/env python').",
+			},
+			&cli.StringSliceFlag{
+				Name:  "keep-filename",
+				Usage: "Keep files with this name even if an ignored path pattern matches it, such as '.env.example'. Patterns matching their directory still apply. Can be repeated.",
+			},
+			&cli.BoolFlag{
+				Name:  "any-text",
+				Usage: "Include any text file regardless of its extension. Binary files are always skipped.",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Apply a named profile from the configuration files.",
+			},
+			&cli.BoolFlag{
+				Name:  "report",
+				Usage: "Print a report of the bytes, lines and tokens of each file and directory, sorted by tokens, instead of generating output.",
+			},
+			&cli.StringFlag{
+				Name:  "report-format",
+				Usage: "Format of the report (table, json, or csv). Defaults to table.",
+				Value: "table",
+			},
+			&cli.BoolFlag{
+				Name:  "show-config",
+				Usage: "Print the effective configuration after merging config files and flags, then exit.",
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return core.Run(
-				config.NewConfigFromCommand(cmd),
-			)
+			cfg := config.NewConfigFromCommand(cmd)
+
+			if cmd.Bool("show-config") {
+				return cfg.WriteEffective(os.Stdout)
+			}
+
+			if cmd.Bool("report") {
+				return core.Report(cfg)
+			}
+
+			return core.Run(cfg)
 		},
 	}
 
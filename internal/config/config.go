@@ -2,11 +2,18 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/foresturquhart/grimoire/internal/pool"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
 )
@@ -28,18 +35,98 @@ type Config struct {
 	// ShowTree indicates whether to display a directory tree at the beginning of output.
 	ShowTree bool
 
-	// DisableSort indicates whether to skip sorting files by Git commit frequency.
+	// DisableSort indicates whether to skip ordering files, keeping the order in which
+	// they were listed.
 	DisableSort bool
 
+	// Order lists the strategies files are ordered by, each breaking the ties of the
+	// previous ones. It is empty if DisableSort is set.
+	Order []OrderKey
+
+	// ChurnHalfLife is the age at which a commit counts half as much towards churn scores,
+	// or zero to count every commit fully.
+	ChurnHalfLife time.Duration
+
+	// ChurnSince is a date, in any format git accepts. If set, only commits more recent
+	// than it count towards churn scores.
+	ChurnSince string
+
 	// Format specifies the output format (e.g., "md" or "xml")
 	Format string
 
+	// FileSource specifies how the file list is built: "fs" to walk the filesystem or
+	// "git" to use the files git tracks, plus untracked files that are not ignored.
+	FileSource string
+
+	// Ref is a Git ref, such as a tag or commit. If set, files are listed and read from the
+	// tree of the ref instead of the working tree, regardless of FileSource.
+	Ref string
+
+	// Since is a Git ref. If set, only files changed since the merge base of the ref and
+	// HEAD are included.
+	Since string
+
+	// Staged indicates that only files with staged changes are included.
+	Staged bool
+
+	// Worktree indicates that only files with uncommitted changes are included.
+	Worktree bool
+
+	// Diff specifies how the diffs of changed files are included: "file", "combined", or
+	// empty to leave them out.
+	Diff string
+
+	// DiffOnly indicates that files with a diff are shown as their diff only.
+	DiffOnly bool
+
+	// XMLStyle specifies the style of the xml format: "loose" or "strict".
+	XMLStyle string
+
+	// Template is the name or path of a text/template that replaces Format, or empty.
+	Template string
+
+	// ReportFormat specifies the format of the file and directory report: "table", "json" or "csv".
+	ReportFormat string
+
 	// AllowedFileExtensions is the list of file extensions that the walker should consider.
 	AllowedFileExtensions map[string]bool
 
+	// AllowedFileNames is the set of file names the walker should consider regardless
+	// of their extension, such as Dockerfile or Makefile.
+	AllowedFileNames map[string]bool
+
+	// ShebangInterpreters is the set of interpreters whose extensionless scripts the walker
+	// should consider, based on the file's shebang line. It is empty if detection is disabled.
+	ShebangInterpreters map[string]bool
+
+	// AnyText indicates whether to include any file whose content is text, regardless of extension.
+	AnyText bool
+
 	// IgnoredPathRegexes is a set of compiled regex patterns for ignoring certain paths.
 	IgnoredPathRegexes []*regexp.Regexp
 
+	// KeepFileNames is the set of file names that IgnoredPathRegexes are only matched
+	// against the directory of, such as .env.example.
+	KeepFileNames map[string]bool
+
+	// IncludePatterns is a list of gitignore-style patterns. If non-empty, only files
+	// matching at least one pattern are included.
+	IncludePatterns []string
+
+	// ExcludePatterns is a list of gitignore-style patterns for files and directories to exclude.
+	ExcludePatterns []string
+
+	// MaxTokens is the token budget for file contents, or zero for no budget.
+	MaxTokens int
+
+	// SplitTokens is the maximum number of tokens per part of a split output, or zero to
+	// write a single document.
+	SplitTokens int
+
+	// PriorityPatterns adjust the priority of files when packing within MaxTokens, and
+	// their place when ordering by priority.
+	PriorityPatterns []PriorityPattern
+
 	// IgnoreSecrets indicates whether to proceed with output generation even if secrets are detected.
 	IgnoreSecrets bool
 
@@ -56,10 +143,40 @@ type Config struct {
 
 	// SkipTokenCount indicates whether to skip counting output tokens.
 	SkipTokenCount bool
+
+	// TokenCountMode specifies how tokens are counted: "fast", "exact" or "approximate".
+	TokenCountMode string
+
+	// Tokenizer specifies the encoding tokens are counted with: "o200k", "cl100k", "p50k" or "r50k".
+	Tokenizer string
+
+	// ChunkTokens is the maximum number of tokens per chunk in the jsonl format.
+	ChunkTokens int
+
+	// ChunkOverlap is the number of tokens shared by consecutive chunks in the jsonl format.
+	ChunkOverlap int
+
+	// Jobs is the number of files read and processed concurrently.
+	Jobs int
+
+	// Version is the version of Grimoire.
+	Version string
+
+	// Profile is the name of the applied profile, or empty if none was selected.
+	Profile string
+
+	// Sources records where each setting was resolved from, keyed by settings key.
+	Sources map[string][]Source
+
+	// settings holds the merged settings the configuration was built from.
+	settings *Settings
 }
 
 // NewConfigFromCommand constructs a Config by extracting relevant values from
-// the provided cli.Command.
+// the provided cli.Command. Values are resolved from the built-in defaults, the user
+// configuration file, any project configuration files (.grimoire.toml), the selected
+// profile, GRIMOIRE_* environment variables and finally the command line flags, with
+// each layer overriding the ones before it.
 func NewConfigFromCommand(cmd *cli.Command) *Config {
 	var err error
 
@@ -75,37 +192,88 @@ func NewConfigFromCommand(cmd *cli.Command) *Config {
 		log.Fatal().Err(err).Msgf("Failed to resolve target directory %s", targetDir)
 	}
 
-	// Convert output file to an absolute path.
-	outputFile := cmd.String("output")
-	if outputFile != "" {
-		outputFile, err = filepath.Abs(outputFile)
+	// Start from the built-in defaults.
+	resolver := NewResolver()
+
+	// Profiles from all configuration files, with later files overriding same-named profiles.
+	profiles := make(map[string]*Profile)
+
+	// Merge the user configuration file, if one exists.
+	if path := UserConfigPath(); path != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			userFile, err := LoadConfigFile(path)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to load user configuration")
+			}
+			log.Debug().Msgf("Loaded user configuration from %s", path)
+			resolver.Apply(userFile.Settings, Source{Layer: LayerUser, Origin: path})
+			for name, profile := range userFile.Profiles {
+				profiles[name] = profile
+			}
+		}
+	}
+
+	// Merge project configuration files, from the repository root down to the target directory.
+	for _, path := range FindProjectConfigFiles(targetDir) {
+		projectFile, err := LoadConfigFile(path)
 		if err != nil {
-			log.Fatal().Err(err).Msgf("Failed to resolve output file %s", outputFile)
+			log.Fatal().Err(err).Msg("Failed to load project configuration")
+		}
+		log.Debug().Msgf("Loaded project configuration from %s", path)
+		resolver.Apply(projectFile.Settings, Source{Layer: LayerProject, Origin: path})
+		for name, profile := range projectFile.Profiles {
+			profiles[name] = profile
 		}
 	}
 
-	// Fetch value of force command line flag.
-	force := cmd.Bool("force")
+	// Read GRIMOIRE_* environment variables and command line flags.
+	envSettings, err := SettingsFromEnv(os.LookupEnv)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read configuration from environment")
+	}
+	flagSettings := settingsFromCommand(cmd)
+
+	// The profile may be selected by any layer, but is applied between the
+	// configuration files and the environment.
+	profileName := *resolver.Settings().Profile
+	for _, layerSettings := range []*Settings{envSettings, flagSettings} {
+		if layerSettings.Profile != nil {
+			profileName = *layerSettings.Profile
+		}
+	}
 
-	// Check if tree display is disabled (default is to show tree)
-	showTree := !cmd.Bool("no-tree")
+	if profileName != "" {
+		chain, err := ResolveProfile(profiles, profileName)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to resolve profile")
+		}
+		for _, name := range chain {
+			profile := profiles[name]
+			log.Debug().Msgf("Applying profile %s from %s", name, profile.origin)
+			resolver.Apply(&profile.Settings, Source{Layer: LayerProfile, Origin: fmt.Sprintf("%s (%s)", name, profile.origin)})
+		}
+	}
 
-	// Check if sorting is disabled
-	disableSort := cmd.Bool("no-sort")
+	// Merge GRIMOIRE_* environment variables.
+	resolver.Apply(envSettings, Source{Layer: LayerEnv})
 
-	// Check if we should ignore detected secrets
-	ignoreSecrets := cmd.Bool("ignore-secrets")
+	// Command line flags take precedence over everything else.
+	resolver.Apply(flagSettings, Source{Layer: LayerFlag})
 
-	// Check if we should redact detected secrets
-	redactSecrets := cmd.Bool("redact-secrets")
+	settings := resolver.Settings()
 
-	// Check if we should skip counting tokens
-	skipTokenCount := cmd.Bool("skip-token-count")
+	// Convert output file to an absolute path.
+	outputFile := *settings.Output
+	if outputFile != "" {
+		outputFile, err = filepath.Abs(outputFile)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Failed to resolve output file %s", outputFile)
+		}
+		settings.Output = &outputFile
+	}
 
-	// Get output format
-	format := cmd.String("format")
 	// Validate and normalize format
-	format = strings.ToLower(format)
+	format := strings.ToLower(*settings.Format)
 	switch format {
 	case "md", "markdown":
 		format = "md"
@@ -113,6 +281,10 @@ func NewConfigFromCommand(cmd *cli.Command) *Config {
 		format = "xml"
 	case "txt", "text", "plain", "plaintext":
 		format = "txt"
+	case "json":
+		format = "json"
+	case "jsonl", "ndjson":
+		format = "jsonl"
 	default:
 		if format != "" {
 			log.Fatal().Msgf("Unsupported format: %s", format)
@@ -120,10 +292,123 @@ func NewConfigFromCommand(cmd *cli.Command) *Config {
 		// Default to markdown if no format specified
 		format = "md"
 	}
+	settings.Format = &format
+
+	// Validate and normalize the file source
+	fileSource := strings.ToLower(*settings.FileSource)
+	switch fileSource {
+	case "fs", "filesystem", "":
+		fileSource = "fs"
+	case "git":
+		fileSource = "git"
+	default:
+		log.Fatal().Msgf("Unsupported file source: %s", fileSource)
+	}
+	settings.FileSource = &fileSource
+
+	// Only one set of changes can be selected
+	changeModes := 0
+	for _, set := range []bool{*settings.Since != "", *settings.Staged, *settings.Worktree} {
+		if set {
+			changeModes++
+		}
+	}
+	if changeModes > 1 {
+		log.Fatal().Msg("Only one of --since, --staged and --worktree can be used")
+	}
+	if *settings.Ref != "" && changeModes > 0 {
+		log.Fatal().Msg("Reading files at a Git ref with --ref cannot be combined with --since, --staged or --worktree")
+	}
+
+	// Validate and normalize the diff mode, which needs a set of changes to diff
+	diff := strings.ToLower(*settings.Diff)
+	switch diff {
+	case "", "none":
+		diff = ""
+	case "file", "combined":
+	default:
+		log.Fatal().Msgf("Unsupported diff mode: %s", diff)
+	}
+	settings.Diff = &diff
+	if diff != "" && changeModes == 0 {
+		log.Fatal().Msg("Including diffs with --diff requires --since, --staged or --worktree")
+	}
+	if *settings.DiffOnly && diff == "" {
+		log.Fatal().Msg("Leaving out file contents with --diff-only requires --diff")
+	}
+
+	// Validate and normalize the XML style
+	xmlStyle := strings.ToLower(*settings.XMLStyle)
+	switch xmlStyle {
+	case "loose", "":
+		xmlStyle = "loose"
+	case "strict":
+		xmlStyle = "strict"
+	default:
+		log.Fatal().Msgf("Unsupported XML style: %s", xmlStyle)
+	}
+	settings.XMLStyle = &xmlStyle
+
+	// Validate and normalize the report format
+	reportFormat := strings.ToLower(*settings.ReportFormat)
+	switch reportFormat {
+	case "table", "":
+		reportFormat = "table"
+	case "json", "csv":
+	default:
+		log.Fatal().Msgf("Unsupported report format: %s", reportFormat)
+	}
+	settings.ReportFormat = &reportFormat
+
+	// Validate and normalize the token count mode
+	tokenCountMode := strings.ToLower(*settings.TokenCountMode)
+	switch tokenCountMode {
+	case "fast", "":
+		tokenCountMode = "fast"
+	case "exact":
+		tokenCountMode = "exact"
+	case "approximate", "approx":
+		tokenCountMode = "approximate"
+	default:
+		log.Fatal().Msgf("Unsupported token count mode: %s", tokenCountMode)
+	}
+	settings.TokenCountMode = &tokenCountMode
+
+	// Validate and normalize the tokenizer, accepting full encoding names too
+	tokenizer := strings.TrimSuffix(strings.ToLower(*settings.Tokenizer), "_base")
+	switch tokenizer {
+	case "o200k", "":
+		tokenizer = "o200k"
+	case "cl100k", "p50k", "r50k":
+	default:
+		log.Fatal().Msgf("Unsupported tokenizer: %s", tokenizer)
+	}
+	settings.Tokenizer = &tokenizer
+
+	// Splitting writes numbered files next to the output file, and needs a format whose
+	// documents can stand on their own.
+	splitTokens := max(*settings.SplitTokens, 0)
+	if splitTokens > 0 {
+		if outputFile == "" {
+			log.Fatal().Msg("Splitting output with --split-tokens requires an output file")
+		}
+		if format == "jsonl" && *settings.Template == "" {
+			log.Fatal().Msg("Splitting output with --split-tokens is not supported for the jsonl format")
+		}
+		if diff != "" {
+			log.Fatal().Msg("Splitting output with --split-tokens is not supported with --diff")
+		}
+	}
+
+	// Chunks of the jsonl format hold file contents only.
+	if diff != "" && format == "jsonl" && *settings.Template == "" {
+		log.Fatal().Msg("Including diffs with --diff is not supported for the jsonl format")
+	}
 
 	// If an output file is specified, and we are not forcing an overwrite,
-	// check if the file already exists.
-	if outputFile != "" && !force {
+	// check if the file already exists. Split output is checked part by part as it is written,
+	// and nothing is written when only showing the configuration.
+	if outputFile != "" && !*settings.Force && splitTokens == 0 && !cmd.Bool("show-config") {
 		_, err := os.Stat(outputFile)
 		if err == nil {
 			log.Fatal().Msgf("Output file %s already exists, use --force to overwrite", outputFile)
@@ -132,52 +417,259 @@ func NewConfigFromCommand(cmd *cli.Command) *Config {
 		}
 	}
 
-	// Set allowed file extensions and ignored path patterns.
-	allowedFileExtensions := DefaultAllowedFileExtensions
-	ignoredPathPatterns := DefaultIgnoredPathPatterns
+	// Compile the ignored path regexes.
+	ignoredPathRegexes, err := compileRegexes(settings.IgnorePatterns)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to compile ignored path pattern regexes")
+	}
 
-	allowedFileExtensionsMap := make(map[string]bool)
-	for _, ext := range allowedFileExtensions {
-		if !strings.HasPrefix(ext, ".") {
-			ext = "." + ext
+	// Collect the file names that are kept despite ignored path patterns matching them.
+	keepFileNames := make(map[string]bool, len(settings.KeepFilenames))
+	for _, name := range settings.KeepFilenames {
+		keepFileNames[name] = true
+	}
+
+	// Collect the shebang interpreters, unless detection is disabled.
+	shebangInterpreters := make(map[string]bool)
+	if !*settings.NoShebang {
+		for _, interpreter := range settings.ShebangInterpreters {
+			shebangInterpreters[interpreter] = true
 		}
-		allowedFileExtensionsMap[ext] = true
 	}
 
-	// Compile the ignored path regexes.
-	ignoredPathRegexes, err := compileRegexes(ignoredPathPatterns)
+	// Fall back to the default thresholds if non-positive values were given.
+	if *settings.LargeFileSizeThreshold <= 0 {
+		settings.LargeFileSizeThreshold = ptr(DefaultLargeFileSizeThreshold)
+	}
+	if *settings.HighTokenThreshold <= 0 {
+		settings.HighTokenThreshold = ptr(DefaultHighTokenThreshold)
+	}
+
+	// Fall back to the default chunk size if a non-positive value was given, and make
+	// sure that chunks always advance past their overlap.
+	if *settings.ChunkTokens <= 0 {
+		settings.ChunkTokens = ptr(DefaultChunkTokens)
+	}
+	if *settings.ChunkOverlap < 0 {
+		settings.ChunkOverlap = ptr(0)
+	}
+	if *settings.ChunkOverlap >= *settings.ChunkTokens {
+		log.Fatal().Msgf("Chunk overlap (%d) must be smaller than the chunk size (%d)", *settings.ChunkOverlap, *settings.ChunkTokens)
+	}
+
+	// Disable the token budget unless a positive one was given.
+	maxTokens := max(*settings.MaxTokens, 0)
+
+	priorityPatterns, err := parsePriorityPatterns(settings.Priorities)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Failed to compile ignored path pattern regexes")
+		log.Fatal().Err(err).Msg("Invalid priority pattern")
+	}
+
+	// Leave files in the order they were listed if sorting is disabled.
+	var order []OrderKey
+	if !*settings.NoSort {
+		order, err = parseOrder(settings.Order)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid file order")
+		}
 	}
 
-	// Use the default large file size threshold
-	largeFileSizeThreshold := DefaultLargeFileSizeThreshold
+	churnHalfLife, err := parseHalfLife(*settings.ChurnHalfLife)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid churn half-life")
+	}
 
-	// Get high token count threshold from CLI or use default
-	highTokenThreshold := cmd.Int("high-token-threshold")
-	if highTokenThreshold <= 0 {
-		highTokenThreshold = DefaultHighTokenThreshold
+	// Use one job per CPU unless a positive number of jobs was given.
+	jobs := *settings.Jobs
+	if jobs <= 0 {
+		jobs = pool.DefaultJobs()
 	}
 
 	cfg := &Config{
 		TargetDir:              targetDir,
 		OutputFile:             outputFile,
-		Force:                  force,
-		ShowTree:               showTree,
-		DisableSort:            disableSort,
+		Force:                  *settings.Force,
+		ShowTree:               !*settings.NoTree,
+		DisableSort:            len(order) == 0,
+		Order:                  order,
+		ChurnHalfLife:          churnHalfLife,
+		ChurnSince:             *settings.ChurnSince,
 		Format:                 format,
-		AllowedFileExtensions:  allowedFileExtensionsMap,
+		FileSource:             fileSource,
+		Ref:                    *settings.Ref,
+		Since:                  *settings.Since,
+		Staged:                 *settings.Staged,
+		Worktree:               *settings.Worktree,
+		Diff:                   diff,
+		DiffOnly:               *settings.DiffOnly,
+		XMLStyle:               xmlStyle,
+		Template:               *settings.Template,
+		ReportFormat:           reportFormat,
+		AllowedFileExtensions:  settings.ResolveExtensions(),
+		AllowedFileNames:       settings.ResolveFilenames(),
+		ShebangInterpreters:    shebangInterpreters,
+		AnyText:                *settings.AnyText,
 		IgnoredPathRegexes:     ignoredPathRegexes,
-		IgnoreSecrets:          ignoreSecrets,
-		RedactSecrets:          redactSecrets,
-		LargeFileSizeThreshold: largeFileSizeThreshold,
-		HighTokenThreshold:     highTokenThreshold,
-		SkipTokenCount:         skipTokenCount,
+		KeepFileNames:          keepFileNames,
+		IncludePatterns:        settings.Include,
+		ExcludePatterns:        settings.Exclude,
+		MaxTokens:              maxTokens,
+		SplitTokens:            splitTokens,
+		PriorityPatterns:       priorityPatterns,
+		IgnoreSecrets:          *settings.IgnoreSecrets,
+		RedactSecrets:          *settings.RedactSecrets,
+		LargeFileSizeThreshold: *settings.LargeFileSizeThreshold,
+		HighTokenThreshold:     *settings.HighTokenThreshold,
+		SkipTokenCount:         *settings.SkipTokenCount,
+		TokenCountMode:         tokenCountMode,
+		Tokenizer:              tokenizer,
+		ChunkTokens:            *settings.ChunkTokens,
+		ChunkOverlap:           *settings.ChunkOverlap,
+		Jobs:                   jobs,
+		Version:                cmd.Root().Version,
+		Profile:                profileName,
+		Sources:                resolver.Sources(),
+		settings:               settings,
 	}
 
 	return cfg
 }
 
+// WriteEffective writes the effective, merged configuration to w in the same TOML
+// format accepted by configuration files. Each value is annotated with the layers
+// it was set by. Lists that accumulate across layers leave out their defaults, which
+// are applied again when the output is loaded as a configuration file.
+func (cfg *Config) WriteEffective(w io.Writer) error {
+	effective := *cfg.settings
+
+	// Fold additions and removals into the resolved lists.
+	extensions := make([]string, 0, len(cfg.AllowedFileExtensions))
+	for ext := range cfg.AllowedFileExtensions {
+		extensions = append(extensions, strings.TrimPrefix(ext, "."))
+	}
+	sort.Strings(extensions)
+	effective.Extensions = extensions
+
+	filenames := make([]string, 0, len(cfg.AllowedFileNames))
+	for name := range cfg.AllowedFileNames {
+		filenames = append(filenames, name)
+	}
+	sort.Strings(filenames)
+	effective.Filenames = filenames
+
+	// Describe where each value came from.
+	comments := make(map[string]string)
+	for key, sources := range cfg.Sources {
+		comments[key] = describeSources(sources)
+	}
+
+	for _, list := range adjustableLists {
+		*effective.list(list.addKey) = nil
+		*effective.list(list.removeKey) = nil
+
+		var sources []Source
+		sources = append(sources, cfg.Sources[list.key]...)
+		sources = append(sources, cfg.Sources[list.addKey]...)
+		sources = append(sources, cfg.Sources[list.removeKey]...)
+		comments[list.key] = describeSources(sources)
+	}
+
+	defaults := DefaultSettings()
+	v := reflect.ValueOf(&effective).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("toml")
+		if !isAppendKey(key) {
+			continue
+		}
+
+		defaultList := *defaults.list(key)
+		list := effective.list(key)
+		if len(defaultList) == 0 || len(*list) < len(defaultList) || !slices.Equal((*list)[:len(defaultList)], defaultList) {
+			continue
+		}
+
+		*list = (*list)[len(defaultList):]
+		comments[key] = fmt.Sprintf("%d defaults not shown", len(defaultList))
+		var sources []Source
+		for _, source := range cfg.Sources[key] {
+			if source.Layer != LayerDefault {
+				sources = append(sources, source)
+			}
+		}
+		if len(sources) > 0 {
+			comments[key] = describeSources(sources) + ", " + comments[key]
+		}
+	}
+
+	return effective.WriteTOML(w, comments)
+}
+
+// Summary returns the main options of the run as a map from settings keys to values,
+// for inclusion in output metadata.
+func (cfg *Config) Summary() map[string]any {
+	summary := map[string]any{
+		"format":           cfg.Format,
+		"source":           cfg.FileSource,
+		"no_tree":          !cfg.ShowTree,
+		"no_sort":          cfg.DisableSort,
+		"redact_secrets":   cfg.RedactSecrets,
+		"skip_token_count": cfg.SkipTokenCount,
+		"token_count_mode": cfg.TokenCountMode,
+		"tokenizer":        cfg.Tokenizer,
+	}
+	if len(cfg.Order) > 0 {
+		order := make([]string, len(cfg.Order))
+		for i, key := range cfg.Order {
+			order[i] = key.String()
+		}
+		summary["order"] = order
+	}
+	if cfg.ChurnSince != "" {
+		summary["churn_since"] = cfg.ChurnSince
+	}
+	if cfg.Template != "" {
+		summary["template"] = cfg.Template
+	}
+	if cfg.Ref != "" {
+		summary["ref"] = cfg.Ref
+	}
+	if cfg.Since != "" {
+		summary["since"] = cfg.Since
+	}
+	if cfg.Staged {
+		summary["staged"] = true
+	}
+	if cfg.Worktree {
+		summary["worktree"] = true
+	}
+	if cfg.Diff != "" {
+		summary["diff"] = cfg.Diff
+		summary["diff_only"] = cfg.DiffOnly
+	}
+	if cfg.Profile != "" {
+		summary["profile"] = cfg.Profile
+	}
+	if len(cfg.IncludePatterns) > 0 {
+		summary["include"] = cfg.IncludePatterns
+	}
+	if len(cfg.ExcludePatterns) > 0 {
+		summary["exclude"] = cfg.ExcludePatterns
+	}
+	if cfg.MaxTokens > 0 {
+		summary["max_tokens"] = cfg.MaxTokens
+	}
+	if cfg.SplitTokens > 0 {
+		summary["split_tokens"] = cfg.SplitTokens
+	}
+	return summary
+}
+
+// ChangesOnly reports whether only changed files are included, because one of Since,
+// Staged or Worktree is set.
+func (cfg *Config) ChangesOnly() bool {
+	return cfg.Since != "" || cfg.Staged || cfg.Worktree
+}
+
 // ShouldWriteFile returns true if the configuration is set to write output
 // to a file (i.e., if OutputFile is non-empty).
 func (cfg *Config) ShouldWriteFile() bool {
@@ -197,3 +689,195 @@ func compileRegexes(regexes []string) ([]*regexp.Regexp, error) {
 	}
 	return compiled, nil
 }
+
+// describeSources returns a comment listing the distinct sources of a value.
+func describeSources(sources []Source) string {
+	var descriptions []string
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		description := source.String()
+		if !seen[description] {
+			seen[description] = true
+			descriptions = append(descriptions, description)
+		}
+	}
+	return "from " + strings.Join(descriptions, ", ")
+}
+
+// settingsFromCommand returns the settings explicitly set on the command line. Each
+// settings key maps to the flag returned by FlagName; flags that were not set (or do
+// not exist) are left nil.
+func settingsFromCommand(cmd *cli.Command) *Settings {
+	settings := &Settings{}
+
+	v := reflect.ValueOf(settings).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("toml")
+		flagName := FlagName(key)
+		if !cmd.IsSet(flagName) {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Interface().(type) {
+		case *string:
+			field.Set(reflect.ValueOf(ptr(cmd.String(flagName))))
+		case *bool:
+			field.Set(reflect.ValueOf(ptr(cmd.Bool(flagName))))
+		case *int:
+			field.Set(reflect.ValueOf(ptr(cmd.Int(flagName))))
+		case *int64:
+			field.Set(reflect.ValueOf(ptr(cmd.Int64(flagName))))
+		case []string:
+			field.Set(reflect.ValueOf(cmd.StringSlice(flagName)))
+		}
+	}
+
+	return settings
+}
+
+// OrderKey is one of the strategies files are ordered by.
+type OrderKey struct {
+	// Strategy is the name of the strategy, one of OrderStrategies.
+	Strategy string
+
+	// Variant is the variant of the strategy, one of its OrderVariants, or empty for
+	// strategies without variants.
+	Variant string
+
+	// Descending reverses the natural direction of the strategy.
+	Descending bool
+}
+
+// String returns the key as it is written in the order setting, e.g. "commits:desc" or
+// "modified:mtime:desc".
+func (k OrderKey) String() string {
+	s := k.Strategy
+	if k.Variant != "" {
+		s += ":" + k.Variant
+	}
+	if k.Descending {
+		s += ":desc"
+	}
+	return s
+}
+
+// parseOrder parses the entries of the order setting, given as "strategy",
+// "strategy:asc" or "strategy:desc", with a variant after the strategy for those that
+// have OrderVariants, such as "modified:mtime:desc". Strategies with variants default to
+// their first one. Entries may also be comma-separated lists. The single entry "none"
+// disables ordering and yields an empty order.
+func parseOrder(entries []string) ([]OrderKey, error) {
+	var order []OrderKey
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		for _, field := range strings.Split(entry, ",") {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if field == "" {
+				continue
+			}
+			if field == "none" {
+				if len(entries) > 1 || strings.Contains(entry, ",") {
+					return nil, fmt.Errorf("%q cannot be combined with other strategies", field)
+				}
+				return nil, nil
+			}
+
+			parts := strings.Split(field, ":")
+			strategy := parts[0]
+			if !slices.Contains(OrderStrategies, strategy) {
+				return nil, fmt.Errorf("unsupported strategy %q, expected one of %s", strategy, strings.Join(OrderStrategies, ", "))
+			}
+			if seen[strategy] {
+				return nil, fmt.Errorf("strategy %q is given more than once", strategy)
+			}
+			seen[strategy] = true
+
+			key := OrderKey{Strategy: strategy}
+			variants := OrderVariants[strategy]
+			if len(variants) > 0 {
+				key.Variant = variants[0]
+			}
+
+			for i, part := range parts[1:] {
+				switch {
+				case part == "asc" || part == "desc":
+					if i != len(parts)-2 {
+						return nil, fmt.Errorf("the direction of strategy %q must come last", strategy)
+					}
+					key.Descending = part == "desc"
+				case i == 0 && slices.Contains(variants, part):
+					key.Variant = part
+				case len(variants) > 0:
+					return nil, fmt.Errorf("unsupported option %q for strategy %q, expected %s, asc or desc", part, strategy, strings.Join(variants, ", "))
+				default:
+					return nil, fmt.Errorf("unsupported direction %q for strategy %q, expected asc or desc", part, strategy)
+				}
+			}
+			order = append(order, key)
+		}
+	}
+	return order, nil
+}
+
+// halfLifeUnits maps the unit suffixes accepted by parseHalfLife to their duration.
+var halfLifeUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// parseHalfLife parses a half-life given as a number of days, weeks or years, such as
+// "90d", "2w" or "1y", or as a Go duration such as "72h". Zero disables decay.
+func parseHalfLife(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+
+	if unit, ok := halfLifeUnits[value[len(value)-1:]]; ok {
+		count, err := strconv.ParseFloat(value[:len(value)-1], 64)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("%q is not a valid half-life", value)
+		}
+		return time.Duration(count * float64(unit)), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%q is not a valid half-life, expected a duration such as 90d, 2w, 1y or 72h", value)
+	}
+	return duration, nil
+}
+
+// PriorityPattern assigns a weight to the files matching a gitignore-style pattern.
+type PriorityPattern struct {
+	// Pattern is the gitignore-style pattern, relative to the target directory.
+	Pattern string
+
+	// Weight is added to the priority of matching files. Higher weights are packed first.
+	Weight int
+}
+
+// parsePriorityPatterns parses "pattern=weight" entries. The weight follows the last
+// equals sign, so patterns may contain equals signs themselves.
+func parsePriorityPatterns(entries []string) ([]PriorityPattern, error) {
+	var patterns []PriorityPattern
+	for _, entry := range entries {
+		index := strings.LastIndex(entry, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("%q is not of the form pattern=weight", entry)
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(entry[index+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%q has an invalid weight: %w", entry, err)
+		}
+
+		patterns = append(patterns, PriorityPattern{
+			Pattern: strings.TrimSpace(entry[:index]),
+			Weight:  weight,
+		})
+	}
+	return patterns, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		expected    []OrderKey
+		expectError string
+	}{
+		{
+			name:    "Strategies and directions",
+			entries: []string{"docs,commits:desc", "path:asc"},
+			expected: []OrderKey{
+				{Strategy: "docs"}, {Strategy: "commits", Descending: true}, {Strategy: "path"},
+			},
+		},
+		{
+			name:     "Default variant",
+			entries:  []string{"modified:desc"},
+			expected: []OrderKey{{Strategy: "modified", Variant: "git", Descending: true}},
+		},
+		{
+			name:     "Commit time",
+			entries:  []string{"modified:git"},
+			expected: []OrderKey{{Strategy: "modified", Variant: "git"}},
+		},
+		{
+			name:     "Modification time",
+			entries:  []string{"modified:mtime:desc", "path"},
+			expected: []OrderKey{{Strategy: "modified", Variant: "mtime", Descending: true}, {Strategy: "path"}},
+		},
+		{
+			name:    "None",
+			entries: []string{"none"},
+		},
+		{
+			name:        "Unknown variant",
+			entries:     []string{"modified:ctime"},
+			expectError: `unsupported option "ctime" for strategy "modified"`,
+		},
+		{
+			name:        "Variant of a strategy without variants",
+			entries:     []string{"size:mtime"},
+			expectError: `unsupported direction "mtime" for strategy "size"`,
+		},
+		{
+			name:        "Direction before the variant",
+			entries:     []string{"modified:desc:mtime"},
+			expectError: "must come last",
+		},
+		{
+			name:        "Repeated strategy",
+			entries:     []string{"modified:git,modified:mtime"},
+			expectError: "given more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := parseOrder(tt.entries)
+
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(order, tt.expected) {
+				t.Errorf("Order mismatch: got %+v, want %+v", order, tt.expected)
+			}
+		})
+	}
+}
@@ -27,6 +27,73 @@ var DefaultAllowedFileExtensions = []string{
 	"sh", "fish", "tf", "tfvars",
 }
 
+// DefaultAllowedFileNames defines file names that are eligible for processing regardless of
+// their extension. These are build, infrastructure and project files that are conventionally
+// named without a recognizable extension.
+var DefaultAllowedFileNames = []string{
+	// Build files
+	"Makefile", "makefile", "GNUmakefile", "Justfile", "justfile", "Rakefile", "Gemfile",
+	"Brewfile", "Podfile", "Fastfile", "Snakefile", "BUILD", "WORKSPACE", "Tiltfile",
+
+	// Container and infrastructure files
+	"Dockerfile", "Containerfile", "Vagrantfile", "Jenkinsfile", "Procfile", "Caddyfile",
+
+	// Go module files (go.sum is left out, like other lock files)
+	"go.mod", "go.work",
+
+	// Project metadata
+	"CODEOWNERS", ".editorconfig", ".gitattributes", ".dockerignore", ".npmrc", ".nvmrc",
+	".tool-versions",
+
+	// Environment templates, see DefaultKeepFileNames
+	".env.example", ".env.sample", ".env.template", ".env.dist",
+}
+
+// DefaultKeepFileNames defines the names of files that ignored path patterns matching their
+// name do not apply to, while patterns matching their directory still do. These are the
+// templates of environment files, which hold placeholders rather than secrets.
+var DefaultKeepFileNames = []string{".env.example", ".env.sample", ".env.template", ".env.dist"}
+
+// DefaultShebangInterpreters defines the interpreters whose scripts are eligible for processing
+// when a file has no extension but starts with a shebang line, such as "#!/usr/bin/env python".
+// Version suffixes are ignored, so "python" also matches python3 and python3.12.
+var DefaultShebangInterpreters = []string{
+	"sh", "bash", "zsh", "ksh", "dash", "fish", "python", "ruby", "perl", "node", "deno",
+	"bun", "php", "lua", "Rscript", "pwsh", "groovy", "elixir", "escript", "tclsh", "awk",
+}
+
+// OrderStrategies lists the strategies that files can be ordered by, in their natural
+// (ascending) direction:
+//   - path: alphabetically by path.
+//   - churn: by churn score, the number of commits that touched the file weighted by their
+//     recency, lowest first.
+//   - commits: by the number of commits that touched the file, fewest first.
+//   - modified: by the time the file was last modified, oldest first. See OrderVariants.
+//   - size: by size in bytes, smallest first.
+//   - tokens: by token count, fewest first.
+//   - docs: overview documents such as README and ARCHITECTURE first, then other
+//     documentation, then everything else.
+//   - deps: files that depend on no other file first, then the files depending on them.
+//   - priority: by the sum of the weights of the matching priority patterns, highest first.
+var OrderStrategies = []string{"path", "churn", "commits", "modified", "size", "tokens", "docs", "deps", "priority"}
+
+// OrderVariants lists the variants of the strategies that have them, the first being the
+// default:
+//   - modified:git: by the time of the last commit that touched the file, or its
+//     modification time if it has none.
+//   - modified:mtime: by the modification time of the file in the working tree.
+var OrderVariants = map[string][]string{
+	"modified": {"git", "mtime"},
+}
+
+// DefaultOrder defines the default order of files: by ascending commit count, so that the
+// most frequently changed files come last, with ties broken alphabetically.
+var DefaultOrder = []string{"commits", "path"}
+
+// DefaultChurnHalfLife defines the default age (90 days) at which a commit counts half as
+// much towards churn scores.
+var DefaultChurnHalfLife = "90d"
+
 // DefaultLargeFileSizeThreshold defines the default size in bytes (1MB) above which
 // a file is considered "large" and a warning will be logged.
 var DefaultLargeFileSizeThreshold int64 = 1024 * 1024
@@ -35,6 +102,14 @@ var DefaultLargeFileSizeThreshold int64 = 1024 * 1024
 // a file is considered to have a high token count and a warning will be logged.
 var DefaultHighTokenThreshold = 5000
 
+// DefaultChunkTokens defines the default maximum number of tokens (512) per chunk
+// in the jsonl output format.
+var DefaultChunkTokens = 512
+
+// DefaultChunkOverlap defines the default number of tokens (64) that consecutive
+// chunks share in the jsonl output format.
+var DefaultChunkOverlap = 64
+
 // DefaultIgnoredPathPatterns defines the default path patterns that are excluded from processing.
 // These include directories, build artifacts, caches, and temporary files.
 var DefaultIgnoredPathPatterns = []string{
@@ -49,7 +124,7 @@ var DefaultIgnoredPathPatterns = []string{
 	`(^|/)\.turbo/`,
 
 	// Directories that should be more specifically matched to avoid false positives
-	`(^|/)vendor/`, `(^|/)bin/`, `(^|/)obj/`, `(^|/)\.settings/`,
+	`(^|/)vendor/`, `(^|/)bin/(Debug|Release)/`, `(^|/)obj/`, `(^|/)\.settings/`,
 
 	// Lock files and dependency metadata (full path matches to avoid false positives)
 	`(^|/)pnpm-lock\.yaml$`, `(^|/)package-lock\.json$`, `(^|/)yarn\.lock$`,
@@ -62,7 +137,7 @@ var DefaultIgnoredPathPatterns = []string{
 	`\.dll$`, `\.exe$`, `\.so$`, `\.dylib$`, `\.log$`, `\.tmp$`,
 	`\.temp$`, `\.swp$`, `\.swo$`, `\.bak$`, `~$`,
 
-	// System files
+	// System files and environment files, which frequently hold secrets
 	`\.DS_Store$`, `Thumbs\.db$`, `\.env(\..+)?$`,
 
 	// Specific files
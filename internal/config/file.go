@@ -0,0 +1,549 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProjectConfigFilename is the name of the project-level configuration file that is
+// discovered in the target directory and its parents up to the repository root.
+const ProjectConfigFilename = ".grimoire.toml"
+
+// Settings is a partial configuration, as read from a configuration file or derived from
+// command line flags. A nil field means the value was not set and falls through to a
+// lower-precedence layer. Keys mirror the command line flag names with underscores,
+// unless a flag tag names a different flag.
+type Settings struct {
+	// Output is the file where results are written.
+	Output *string `toml:"output"`
+
+	// Force indicates whether existing output files should be overwritten.
+	Force *bool `toml:"force"`
+
+	// NoTree disables the directory tree at the beginning of output.
+	NoTree *bool `toml:"no_tree"`
+
+	// NoSort disables ordering files, keeping the order in which they were listed.
+	NoSort *bool `toml:"no_sort"`
+
+	// Order lists the strategies files are ordered by, each breaking the ties of the
+	// previous ones, as "strategy" or "strategy:desc".
+	Order []string `toml:"order"`
+
+	// ChurnHalfLife is the age at which a commit counts half as much towards the churn
+	// score of the files it touched, such as "90d", or "0" to count every commit fully.
+	ChurnHalfLife *string `toml:"churn_half_life"`
+
+	// ChurnSince restricts the commits counted towards churn scores to those more recent
+	// than a date, in any format git accepts, such as "6.months".
+	ChurnSince *string `toml:"churn_since"`
+
+	// Format is the output format (md, xml, txt, json or jsonl).
+	Format *string `toml:"format"`
+
+	// FileSource selects how the file list is built: "fs" walks the filesystem,
+	// "git" asks git for tracked and untracked, non-ignored files.
+	FileSource *string `toml:"source"`
+
+	// Ref reads the files as they are in the tree of a Git ref instead of the working tree.
+	Ref *string `toml:"ref"`
+
+	// Since restricts the files to those changed since the merge base of a Git ref and HEAD.
+	Since *string `toml:"since"`
+
+	// Staged restricts the files to those with staged changes.
+	Staged *bool `toml:"staged"`
+
+	// Worktree restricts the files to those with uncommitted changes, staged or not.
+	Worktree *bool `toml:"worktree"`
+
+	// Diff includes the diffs of changed files: "file" after each file, or "combined" in
+	// one section after all files.
+	Diff *string `toml:"diff"`
+
+	// DiffOnly leaves out the content of files that have a diff.
+	DiffOnly *bool `toml:"diff_only"`
+
+	// XMLStyle selects the style of the xml format: "loose" for LLM-friendly markup with
+	// unescaped content, or "strict" for well-formed XML.
+	XMLStyle *string `toml:"xml_style"`
+
+	// Template is the name or path of a text/template used instead of Format.
+	Template *string `toml:"template"`
+
+	// ReportFormat is the format of the report written by --report: "table", "json" or "csv".
+	ReportFormat *string `toml:"report_format"`
+
+	// Extensions replaces the complete list of allowed file extensions.
+	Extensions []string `toml:"extensions"`
+
+	// AddExtensions lists extensions to allow in addition to Extensions.
+	AddExtensions []string `toml:"add_extensions" merge:"append" flag:"ext"`
+
+	// RemoveExtensions lists extensions to remove from Extensions.
+	RemoveExtensions []string `toml:"remove_extensions" merge:"append" flag:"no-ext"`
+
+	// Filenames replaces the complete list of file names that are allowed regardless of extension.
+	Filenames []string `toml:"filenames"`
+
+	// AddFilenames lists file names to allow in addition to Filenames.
+	AddFilenames []string `toml:"add_filenames" merge:"append"`
+
+	// RemoveFilenames lists file names to remove from Filenames.
+	RemoveFilenames []string `toml:"remove_filenames" merge:"append"`
+
+	// NoShebang disables including extensionless files based on their shebang line.
+	NoShebang *bool `toml:"no_shebang"`
+
+	// ShebangInterpreters lists the interpreters whose scripts are included when
+	// detected from a shebang line.
+	ShebangInterpreters []string `toml:"shebang_interpreters"`
+
+	// AnyText includes any file whose content is text, regardless of its extension.
+	AnyText *bool `toml:"any_text"`
+
+	// IgnorePatterns lists regular expressions for paths to ignore, in addition to the defaults.
+	IgnorePatterns []string `toml:"ignore_patterns" merge:"append"`
+
+	// KeepFilenames lists file names that IgnorePatterns matching their name do not apply
+	// to, in addition to the defaults.
+	KeepFilenames []string `toml:"keep_filenames" merge:"append" flag:"keep-filename"`
+
+	// Include lists gitignore-style patterns; if any are given, only matching files are included.
+	Include []string `toml:"include" merge:"append"`
+
+	// Exclude lists gitignore-style patterns for files and directories to exclude.
+	Exclude []string `toml:"exclude" merge:"append"`
+
+	// MaxTokens is the token budget for file contents. Zero or less disables the budget.
+	MaxTokens *int `toml:"max_tokens"`
+
+	// SplitTokens is the maximum number of tokens per part when splitting the output
+	// into several files. Zero or less writes a single file.
+	SplitTokens *int `toml:"split_tokens"`
+
+	// Priorities lists "pattern=weight" entries that raise or lower the priority of files
+	// matching a gitignore-style pattern when packing within MaxTokens, and their place
+	// when ordering files by priority.
+	Priorities []string `toml:"priorities" merge:"append" flag:"priority"`
+
+	// IgnoreSecrets proceeds with output generation even if secrets are detected.
+	IgnoreSecrets *bool `toml:"ignore_secrets"`
+
+	// RedactSecrets redacts detected secrets in the output.
+	RedactSecrets *bool `toml:"redact_secrets"`
+
+	// SkipTokenCount skips counting output tokens.
+	SkipTokenCount *bool `toml:"skip_token_count"`
+
+	// TokenCountMode selects how tokens are counted: "fast", "exact" or "approximate".
+	TokenCountMode *string `toml:"token_count_mode"`
+
+	// Tokenizer selects the encoding tokens are counted with: "o200k", "cl100k", "p50k" or "r50k".
+	Tokenizer *string `toml:"tokenizer"`
+
+	// LargeFileSizeThreshold is the size in bytes above which a file is considered large.
+	LargeFileSizeThreshold *int64 `toml:"large_file_size_threshold"`
+
+	// HighTokenThreshold is the token count above which a file is considered to have a high token count.
+	HighTokenThreshold *int `toml:"high_token_threshold"`
+
+	// ChunkTokens is the maximum number of tokens per chunk in the jsonl format.
+	ChunkTokens *int `toml:"chunk_tokens"`
+
+	// ChunkOverlap is the number of tokens shared by consecutive chunks in the jsonl format.
+	ChunkOverlap *int `toml:"chunk_overlap"`
+
+	// Jobs is the number of files read and processed concurrently. Zero or less uses the number of CPUs.
+	Jobs *int `toml:"jobs"`
+
+	// Profile names the profile to apply on top of the configuration files.
+	Profile *string `toml:"profile"`
+}
+
+// File is the content of a configuration file: top-level settings plus any named profiles.
+type File struct {
+	// Settings holds the top-level settings of the file.
+	Settings *Settings
+
+	// Profiles holds the profiles defined under [profiles.<name>], keyed by name.
+	Profiles map[string]*Profile
+}
+
+// fileLayout mirrors the TOML layout of a configuration file for decoding.
+type fileLayout struct {
+	Settings
+	Profiles map[string]*Profile `toml:"profiles"`
+}
+
+// DefaultSettings returns the built-in settings that every other layer is merged onto.
+func DefaultSettings() *Settings {
+	return &Settings{
+		Output:                 ptr(""),
+		Force:                  ptr(false),
+		NoTree:                 ptr(false),
+		NoSort:                 ptr(false),
+		Order:                  append([]string{}, DefaultOrder...),
+		ChurnHalfLife:          ptr(DefaultChurnHalfLife),
+		ChurnSince:             ptr(""),
+		Format:                 ptr("md"),
+		FileSource:             ptr("fs"),
+		Ref:                    ptr(""),
+		Since:                  ptr(""),
+		Staged:                 ptr(false),
+		Worktree:               ptr(false),
+		Diff:                   ptr(""),
+		DiffOnly:               ptr(false),
+		XMLStyle:               ptr("loose"),
+		Template:               ptr(""),
+		ReportFormat:           ptr("table"),
+		MaxTokens:              ptr(0),
+		SplitTokens:            ptr(0),
+		Extensions:             append([]string{}, DefaultAllowedFileExtensions...),
+		Filenames:              append([]string{}, DefaultAllowedFileNames...),
+		NoShebang:              ptr(false),
+		ShebangInterpreters:    append([]string{}, DefaultShebangInterpreters...),
+		AnyText:                ptr(false),
+		IgnorePatterns:         append([]string{}, DefaultIgnoredPathPatterns...),
+		KeepFilenames:          append([]string{}, DefaultKeepFileNames...),
+		IgnoreSecrets:          ptr(false),
+		RedactSecrets:          ptr(false),
+		SkipTokenCount:         ptr(false),
+		TokenCountMode:         ptr("fast"),
+		Tokenizer:              ptr("o200k"),
+		LargeFileSizeThreshold: ptr(DefaultLargeFileSizeThreshold),
+		HighTokenThreshold:     ptr(DefaultHighTokenThreshold),
+		ChunkTokens:            ptr(DefaultChunkTokens),
+		ChunkOverlap:           ptr(DefaultChunkOverlap),
+		Jobs:                   ptr(0),
+		Profile:                ptr(""),
+	}
+}
+
+// LoadConfigFile reads a TOML configuration file. Unknown keys are reported as errors
+// so that typos do not silently go unnoticed. Relative output paths are resolved
+// against the directory containing the file.
+func LoadConfigFile(path string) (*File, error) {
+	layout := &fileLayout{}
+
+	md, err := toml.DecodeFile(path, layout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(keys, ", "))
+	}
+
+	file := &File{
+		Settings: &layout.Settings,
+		Profiles: layout.Profiles,
+	}
+
+	file.Settings.resolvePaths(filepath.Dir(path))
+	for name, profile := range file.Profiles {
+		if profile.Profile != nil {
+			return nil, fmt.Errorf("profile %q in config file %s cannot select another profile, use extends instead", name, path)
+		}
+		profile.Settings.resolvePaths(filepath.Dir(path))
+		profile.origin = path
+	}
+
+	return file, nil
+}
+
+// resolvePaths makes a relative output path, and a relative template path, absolute
+// by joining it to dir. Template names are left as they are.
+func (s *Settings) resolvePaths(dir string) {
+	if s.Output != nil && *s.Output != "" && !filepath.IsAbs(*s.Output) {
+		s.Output = ptr(filepath.Join(dir, *s.Output))
+	}
+	if s.Template != nil && isTemplatePath(*s.Template) && !filepath.IsAbs(*s.Template) {
+		s.Template = ptr(filepath.Join(dir, *s.Template))
+	}
+}
+
+// isTemplatePath reports whether a template reference is a file path rather than the name
+// of a built-in or user template: whether it contains a path separator or ends in .tmpl.
+// It matches serializer.IsTemplatePath, and is repeated here so that config does not
+// depend on the serializer and its dependencies.
+func isTemplatePath(ref string) bool {
+	return strings.ContainsRune(ref, '/') || strings.ContainsRune(ref, filepath.Separator) || strings.HasSuffix(ref, ".tmpl")
+}
+
+// FindProjectConfigFiles returns the project configuration files that apply to targetDir.
+// It looks in targetDir and each of its parents up to and including the repository root
+// (the first directory containing .git). If targetDir is not inside a repository, only
+// targetDir itself is considered. Files are ordered from the repository root down to
+// targetDir, so that merging them in order lets the closest file take precedence.
+func FindProjectConfigFiles(targetDir string) []string {
+	var dirs []string
+	foundRoot := false
+
+	current := targetDir
+	for {
+		dirs = append(dirs, current)
+
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			foundRoot = true
+			break
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+
+	if !foundRoot {
+		dirs = []string{targetDir}
+	}
+
+	var files []string
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(dirs[i], ProjectConfigFilename)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+// adjustableList describes a list setting that can either be replaced outright or
+// adjusted by additions and removals in each layer, such as the allowed file extensions.
+type adjustableList struct {
+	key       string
+	addKey    string
+	removeKey string
+	normalize func(string) string
+}
+
+// adjustableLists holds every list setting with add and remove counterparts.
+var adjustableLists = []adjustableList{
+	{key: "extensions", addKey: "add_extensions", removeKey: "remove_extensions", normalize: normalizeExtension},
+	{key: "filenames", addKey: "add_filenames", removeKey: "remove_filenames", normalize: func(name string) string { return name }},
+}
+
+// Merge overlays every value set in other onto s and returns the keys that were set.
+// Scalar values and replacement lists overwrite the existing value, while lists tagged
+// with merge:"append" accumulate. Replacing an adjustable list such as Extensions discards
+// any additions and removals from lower layers, and an addition in a higher layer cancels
+// a removal from a lower layer (and vice versa).
+func (s *Settings) Merge(other *Settings) []string {
+	if other == nil {
+		return nil
+	}
+
+	for _, list := range adjustableLists {
+		add := s.list(list.addKey)
+		remove := s.list(list.removeKey)
+		if *other.list(list.key) != nil {
+			*add = nil
+			*remove = nil
+		}
+		*remove = withoutItems(*remove, *other.list(list.addKey), list.normalize)
+		*add = withoutItems(*add, *other.list(list.removeKey), list.normalize)
+	}
+
+	var keys []string
+
+	dst := reflect.ValueOf(s).Elem()
+	src := reflect.ValueOf(other).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		field := src.Field(i)
+		if field.IsNil() {
+			continue
+		}
+
+		if dst.Type().Field(i).Tag.Get("merge") == "append" {
+			dst.Field(i).Set(reflect.AppendSlice(dst.Field(i), field))
+		} else {
+			dst.Field(i).Set(field)
+		}
+		keys = append(keys, dst.Type().Field(i).Tag.Get("toml"))
+	}
+
+	return keys
+}
+
+// list returns a pointer to the list setting with the given key.
+func (s *Settings) list(key string) *[]string {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("toml") == key {
+			return v.Field(i).Addr().Interface().(*[]string)
+		}
+	}
+	panic("unknown list setting " + key)
+}
+
+// isAppendKey reports whether the settings key names a list that accumulates across layers.
+func isAppendKey(key string) bool {
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("toml") == key {
+			return t.Field(i).Tag.Get("merge") == "append"
+		}
+	}
+	return false
+}
+
+// ResolveExtensions returns the allowed file extensions after applying additions and
+// removals, normalized to include a leading dot.
+func (s *Settings) ResolveExtensions() map[string]bool {
+	return s.resolveList(adjustableLists[0])
+}
+
+// ResolveFilenames returns the file names allowed regardless of extension after
+// applying additions and removals.
+func (s *Settings) ResolveFilenames() map[string]bool {
+	return s.resolveList(adjustableLists[1])
+}
+
+// resolveList applies the additions and removals of an adjustable list to its base value.
+func (s *Settings) resolveList(list adjustableList) map[string]bool {
+	items := make(map[string]bool)
+	for _, item := range *s.list(list.key) {
+		items[list.normalize(item)] = true
+	}
+	for _, item := range *s.list(list.addKey) {
+		items[list.normalize(item)] = true
+	}
+	for _, item := range *s.list(list.removeKey) {
+		delete(items, list.normalize(item))
+	}
+	return items
+}
+
+// WriteTOML writes every set value in s to w as TOML key/value pairs, in declaration order.
+// If comments is non-nil, any comment it holds for a key is appended to that key's line.
+func (s *Settings) WriteTOML(w io.Writer, comments map[string]string) error {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsNil() {
+			continue
+		}
+
+		key := v.Type().Field(i).Tag.Get("toml")
+		line := fmt.Sprintf("%s = %s", key, formatTOMLValue(field))
+		if comment := comments[key]; comment != "" {
+			line += " # " + comment
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatTOMLValue renders a pointer or slice settings value as a TOML literal.
+func formatTOMLValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = formatTOMLValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.String {
+		return formatTOMLString(v.String())
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// formatTOMLString renders s as a TOML string. Literal strings are preferred since they
+// avoid escaping backslashes in regular expressions, but cannot hold single quotes or
+// control characters, so such strings are written as basic strings with TOML escapes.
+func formatTOMLString(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r == '\'' || isTOMLControl(r) }) {
+		return "'" + s + "'"
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if isTOMLControl(r) {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isTOMLControl reports whether r is a control character that TOML does not allow
+// unescaped in strings: U+0000 to U+001F other than tab, and U+007F.
+func isTOMLControl(r rune) bool {
+	return (r < 0x20 && r != '\t') || r == 0x7f
+}
+
+// normalizeExtension ensures an extension starts with a dot.
+func normalizeExtension(ext string) string {
+	if !strings.HasPrefix(ext, ".") {
+		return "." + ext
+	}
+	return ext
+}
+
+// withoutItems returns the elements of list that do not appear in remove, comparing
+// items after applying normalize.
+func withoutItems(list, remove []string, normalize func(string) string) []string {
+	if len(remove) == 0 {
+		return list
+	}
+
+	removeSet := make(map[string]bool, len(remove))
+	for _, item := range remove {
+		removeSet[normalize(item)] = true
+	}
+
+	var result []string
+	for _, item := range list {
+		if !removeSet[normalize(item)] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// ptr returns a pointer to a copy of v.
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectConfigFilename)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestFindProjectConfigFilesStopsAtRepositoryRoot(t *testing.T) {
+	outerDir := t.TempDir()
+	repoDir := filepath.Join(outerDir, "repo")
+	subDir := filepath.Join(repoDir, "pkg")
+	plainDir := filepath.Join(outerDir, "plain", "dir")
+
+	for _, dir := range []string{filepath.Join(repoDir, ".git"), subDir, plainDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	writeConfigFile(t, outerDir, "format = \"txt\"\n")
+	writeConfigFile(t, filepath.Join(outerDir, "plain"), "format = \"txt\"\n")
+	repoConfig := writeConfigFile(t, repoDir, "format = \"xml\"\n")
+	plainConfig := writeConfigFile(t, plainDir, "format = \"xml\"\n")
+
+	tests := []struct {
+		name      string
+		targetDir string
+		expected  []string
+	}{
+		{name: "Inside a repository", targetDir: subDir, expected: []string{repoConfig}},
+		{name: "At the repository root", targetDir: repoDir, expected: []string{repoConfig}},
+		{name: "Outside a repository", targetDir: plainDir, expected: []string{plainConfig}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := FindProjectConfigFiles(tt.targetDir)
+			if !slicesEqual(files, tt.expected) {
+				t.Errorf("Config files mismatch: got %v, want %v", files, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError string
+		check       func(t *testing.T, dir string, file *File)
+	}{
+		{
+			name:    "Relative paths resolved against the file",
+			content: "output = \"out/context.md\"\ntemplate = \"templates/review.tmpl\"\n\n[profiles.docs]\noutput = \"docs.md\"\n",
+			check: func(t *testing.T, dir string, file *File) {
+				if got, want := *file.Settings.Output, filepath.Join(dir, "out", "context.md"); got != want {
+					t.Errorf("Output mismatch: got %s, want %s", got, want)
+				}
+				if got, want := *file.Settings.Template, filepath.Join(dir, "templates", "review.tmpl"); got != want {
+					t.Errorf("Template mismatch: got %s, want %s", got, want)
+				}
+				if got, want := *file.Profiles["docs"].Output, filepath.Join(dir, "docs.md"); got != want {
+					t.Errorf("Profile output mismatch: got %s, want %s", got, want)
+				}
+			},
+		},
+		{
+			name:    "Absolute paths and template names kept",
+			content: "output = \"/tmp/context.md\"\ntemplate = \"xml\"\n",
+			check: func(t *testing.T, dir string, file *File) {
+				if got := *file.Settings.Output; got != "/tmp/context.md" {
+					t.Errorf("Output mismatch: got %s, want /tmp/context.md", got)
+				}
+				if got := *file.Settings.Template; got != "xml" {
+					t.Errorf("Template mismatch: got %s, want xml", got)
+				}
+			},
+		},
+		{
+			name:        "Unknown top-level key",
+			content:     "format = \"xml\"\nformt = \"md\"\n",
+			expectError: "unknown keys in config file",
+		},
+		{
+			name:        "Unknown profile key",
+			content:     "[profiles.review]\nredact = true\n",
+			expectError: "profiles.review.redact",
+		},
+		{
+			name:        "Profile selecting a profile",
+			content:     "[profiles.review]\nprofile = \"other\"\n",
+			expectError: "cannot select another profile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file, err := LoadConfigFile(writeConfigFile(t, dir, tt.content))
+
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tt.check(t, dir, file)
+		})
+	}
+}
+
+func TestSettingsMerge(t *testing.T) {
+	settings := &Settings{
+		Format:         ptr("md"),
+		IgnorePatterns: []string{`\.lock$`},
+		AddExtensions:  []string{"zz"},
+	}
+
+	keys := settings.Merge(&Settings{
+		Format:           ptr("xml"),
+		IgnorePatterns:   []string{`^vendor/`},
+		RemoveExtensions: []string{".zz", "go"},
+	})
+
+	if !slicesEqual(keys, []string{"format", "remove_extensions", "ignore_patterns"}) {
+		t.Errorf("Keys mismatch: got %v", keys)
+	}
+	if *settings.Format != "xml" {
+		t.Errorf("Format mismatch: got %s, want xml", *settings.Format)
+	}
+	if want := []string{`\.lock$`, `^vendor/`}; !slicesEqual(settings.IgnorePatterns, want) {
+		t.Errorf("Appended list mismatch: got %v, want %v", settings.IgnorePatterns, want)
+	}
+	if len(settings.AddExtensions) != 0 {
+		t.Errorf("Expected the removal to cancel the addition, got %v", settings.AddExtensions)
+	}
+
+	settings.Merge(&Settings{Extensions: []string{"md"}})
+	if settings.RemoveExtensions != nil || settings.AddExtensions != nil {
+		t.Errorf("Expected replacing extensions to discard additions and removals, got %v and %v", settings.AddExtensions, settings.RemoveExtensions)
+	}
+	if extensions := settings.ResolveExtensions(); !reflect.DeepEqual(extensions, map[string]bool{".md": true}) {
+		t.Errorf("Extensions mismatch: got %v", extensions)
+	}
+}
+
+func TestWriteTOMLRoundTrip(t *testing.T) {
+	settings := &Settings{
+		Output:         ptr("/tmp/it's \"quoted\"\\path.md"),
+		Format:         ptr("xml"),
+		IgnorePatterns: []string{`\.min\.js$`, "tab\there", "nul\x00bell\aesc\x1bdel\x7f", "line\nbreak\r\n"},
+		MaxTokens:      ptr(1000),
+		RedactSecrets:  ptr(true),
+	}
+
+	var buf bytes.Buffer
+	if err := settings.WriteTOML(&buf, map[string]string{"format": "flag --format"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load written settings: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(file.Settings, settings) {
+		t.Errorf("Round trip mismatch:\ngot  %+v\nwant %+v\n%s", file.Settings, settings, buf.String())
+	}
+	if !strings.Contains(buf.String(), `ignore_patterns = ['\.min\.js$', `) {
+		t.Errorf("Expected regular expressions as literal strings:\n%s", buf.String())
+	}
+}
+
+func TestWriteEffectiveRoundTrip(t *testing.T) {
+	resolver := NewResolver()
+	resolver.Apply(&Settings{
+		Format:           ptr("xml"),
+		RemoveExtensions: []string{"go"},
+		IgnorePatterns:   []string{"weird\x00pattern"},
+		Order:            []string{"docs", "path"},
+	}, Source{Layer: LayerProject, Origin: "/repo/.grimoire.toml"})
+	resolver.Apply(&Settings{RedactSecrets: ptr(true)}, Source{Layer: LayerFlag})
+
+	settings := resolver.Settings()
+	cfg := &Config{
+		AllowedFileExtensions: settings.ResolveExtensions(),
+		AllowedFileNames:      settings.ResolveFilenames(),
+		Sources:               resolver.Sources(),
+		settings:              settings,
+	}
+
+	var effective bytes.Buffer
+	if err := cfg.WriteEffective(&effective); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, effective.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load effective configuration: %v\n%s", err, effective.String())
+	}
+
+	if got := file.Settings.ResolveExtensions(); !reflect.DeepEqual(got, cfg.AllowedFileExtensions) {
+		t.Errorf("Extensions mismatch after round trip: got %v, want %v", got, cfg.AllowedFileExtensions)
+	}
+	if file.Settings.RemoveExtensions != nil {
+		t.Errorf("Expected removals to be folded into extensions, got %v", file.Settings.RemoveExtensions)
+	}
+	if *file.Settings.Format != "xml" || !*file.Settings.RedactSecrets {
+		t.Errorf("Scalar mismatch after round trip: format %s, redact_secrets %v", *file.Settings.Format, *file.Settings.RedactSecrets)
+	}
+	if want := []string{"weird\x00pattern"}; !slicesEqual(file.Settings.IgnorePatterns, want) {
+		t.Errorf("Expected the defaults to be left out of ignore patterns, got %q, want %q", file.Settings.IgnorePatterns, want)
+	}
+
+	// Loading the output as a configuration file yields the same accumulated lists,
+	// without applying the defaults twice.
+	reloaded := NewResolver()
+	reloaded.Apply(file.Settings, Source{Layer: LayerProject, Origin: path})
+	if got := reloaded.Settings().IgnorePatterns; !slicesEqual(got, settings.IgnorePatterns) {
+		t.Errorf("Ignore patterns mismatch after reloading: got %q, want %q", got, settings.IgnorePatterns)
+	}
+	if got := reloaded.Settings().KeepFilenames; !slicesEqual(got, settings.KeepFilenames) {
+		t.Errorf("Kept file names mismatch after reloading: got %q, want %q", got, settings.KeepFilenames)
+	}
+	if !slicesEqual(file.Settings.Order, settings.Order) {
+		t.Errorf("Order mismatch: got %v, want %v", file.Settings.Order, settings.Order)
+	}
+	if !strings.Contains(effective.String(), "format = 'xml' # from project file /repo/.grimoire.toml") {
+		t.Errorf("Expected sources as comments:\n%s", effective.String())
+	}
+	if !strings.Contains(effective.String(), fmt.Sprintf("keep_filenames = [] # %d defaults not shown", len(DefaultKeepFileNames))) {
+		t.Errorf("Expected a note about the defaults left out:\n%s", effective.String())
+	}
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of environment variables that set configuration values.
+// A settings key such as redact_secrets is read from GRIMOIRE_REDACT_SECRETS.
+const EnvPrefix = "GRIMOIRE_"
+
+// Layer identifies a configuration layer. Layers are applied in increasing order,
+// so a value from a later layer overrides the same value from an earlier one.
+type Layer int
+
+const (
+	// LayerDefault holds the built-in defaults.
+	LayerDefault Layer = iota
+
+	// LayerUser holds values from the user configuration file.
+	LayerUser
+
+	// LayerProject holds values from project configuration files.
+	LayerProject
+
+	// LayerProfile holds values from the selected profile and the profiles it extends.
+	LayerProfile
+
+	// LayerEnv holds values from GRIMOIRE_* environment variables.
+	LayerEnv
+
+	// LayerFlag holds values from command line flags.
+	LayerFlag
+)
+
+// String returns a human-readable name for the layer.
+func (l Layer) String() string {
+	switch l {
+	case LayerDefault:
+		return "default"
+	case LayerUser:
+		return "user file"
+	case LayerProject:
+		return "project file"
+	case LayerProfile:
+		return "profile"
+	case LayerEnv:
+		return "environment"
+	case LayerFlag:
+		return "flag"
+	default:
+		return fmt.Sprintf("layer %d", int(l))
+	}
+}
+
+// Source records where a resolved configuration value was set.
+type Source struct {
+	// Layer is the configuration layer the value came from.
+	Layer Layer
+
+	// Origin identifies the value within its layer, such as a file path,
+	// an environment variable name or a flag name. It is empty for defaults.
+	Origin string
+}
+
+// String returns a description of the source, e.g. "project file /repo/.grimoire.toml".
+func (s Source) String() string {
+	if s.Origin == "" {
+		return s.Layer.String()
+	}
+	return s.Layer.String() + " " + s.Origin
+}
+
+// Resolver merges settings layers in order of precedence while recording the
+// source of every value.
+type Resolver struct {
+	settings *Settings
+	sources  map[string][]Source
+}
+
+// NewResolver returns a Resolver initialized with the built-in default settings.
+func NewResolver() *Resolver {
+	r := &Resolver{
+		settings: &Settings{},
+		sources:  make(map[string][]Source),
+	}
+	r.Apply(DefaultSettings(), Source{Layer: LayerDefault})
+	return r
+}
+
+// Apply merges settings onto the resolved settings, attributing every value it sets to source.
+// For lists that accumulate across layers, every contributing source is recorded. If the
+// source has no origin, environment and flag values are attributed to the variable or flag
+// corresponding to each key.
+func (r *Resolver) Apply(settings *Settings, source Source) {
+	for _, key := range r.settings.Merge(settings) {
+		keySource := source
+		if keySource.Origin == "" {
+			switch keySource.Layer {
+			case LayerEnv:
+				keySource.Origin = EnvVarName(key)
+			case LayerFlag:
+				keySource.Origin = "--" + FlagName(key)
+			}
+		}
+
+		if isAppendKey(key) {
+			r.sources[key] = append(r.sources[key], keySource)
+		} else {
+			r.sources[key] = []Source{keySource}
+		}
+	}
+
+	// Replacing an adjustable list discards the additions and removals made before it.
+	if settings != nil {
+		for _, list := range adjustableLists {
+			if *settings.list(list.key) != nil {
+				delete(r.sources, list.addKey)
+				delete(r.sources, list.removeKey)
+			}
+		}
+	}
+}
+
+// Settings returns the merged settings.
+func (r *Resolver) Settings() *Settings {
+	return r.settings
+}
+
+// Sources returns the sources of every resolved value, keyed by settings key.
+func (r *Resolver) Sources() map[string][]Source {
+	return r.sources
+}
+
+// UserConfigDir returns the user configuration directory, $XDG_CONFIG_HOME/grimoire,
+// falling back to ~/.config when XDG_CONFIG_HOME is not set. It returns an empty string
+// if no home directory is known.
+func UserConfigDir() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "grimoire")
+}
+
+// UserConfigPath returns the path of the user configuration file,
+// $XDG_CONFIG_HOME/grimoire/config.toml. It returns an empty string if no home
+// directory is known.
+func UserConfigPath() string {
+	dir := UserConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config.toml")
+}
+
+// UserTemplatesDir returns the directory where templates are looked up by name,
+// $XDG_CONFIG_HOME/grimoire/templates. It returns an empty string if no home
+// directory is known.
+func UserTemplatesDir() string {
+	dir := UserConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "templates")
+}
+
+// EnvVarName returns the environment variable that sets the given settings key.
+func EnvVarName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// FlagName returns the command line flag that sets the given settings key. This is
+// the key with dashes instead of underscores, unless the field has a flag tag.
+func FlagName(key string) string {
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("toml") == key {
+			if flag := t.Field(i).Tag.Get("flag"); flag != "" {
+				return flag
+			}
+			break
+		}
+	}
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// SettingsFromEnv reads settings from GRIMOIRE_* environment variables using lookup,
+// which is typically os.LookupEnv. Lists are given as comma-separated values.
+func SettingsFromEnv(lookup func(string) (string, bool)) (*Settings, error) {
+	settings := &Settings{}
+
+	v := reflect.ValueOf(settings).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("toml")
+		name := EnvVarName(key)
+
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		value, err := parseEnvValue(v.Field(i).Type(), raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+
+		v.Field(i).Set(value)
+	}
+
+	return settings, nil
+}
+
+// parseEnvValue converts a raw environment variable value to the given settings field type.
+func parseEnvValue(t reflect.Type, raw string) (reflect.Value, error) {
+	raw = strings.TrimSpace(raw)
+
+	if t.Kind() == reflect.Slice {
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return reflect.ValueOf(items), nil
+	}
+
+	value := reflect.New(t.Elem())
+	switch t.Elem().Kind() {
+	case reflect.String:
+		value.Elem().SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.Elem().SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.Elem().SetInt(n)
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported setting type %s", t)
+	}
+
+	return value, nil
+}
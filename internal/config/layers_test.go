@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolverPrecedence(t *testing.T) {
+	resolver := NewResolver()
+
+	resolver.Apply(&Settings{Format: ptr("xml"), AddExtensions: []string{"zz"}}, Source{Layer: LayerUser, Origin: "user.toml"})
+	resolver.Apply(&Settings{Format: ptr("txt"), RemoveExtensions: []string{"go", "zz"}}, Source{Layer: LayerProject, Origin: "project.toml"})
+	resolver.Apply(&Settings{RedactSecrets: ptr(true)}, Source{Layer: LayerEnv})
+	resolver.Apply(&Settings{Format: ptr("md"), AddExtensions: []string{".go"}}, Source{Layer: LayerFlag})
+
+	settings := resolver.Settings()
+	if *settings.Format != "md" {
+		t.Errorf("Format mismatch: got %s, want md", *settings.Format)
+	}
+	if !*settings.RedactSecrets {
+		t.Errorf("RedactSecrets mismatch: got false, want true")
+	}
+
+	extensions := settings.ResolveExtensions()
+	if !extensions[".go"] {
+		t.Errorf("Expected .go to be re-added by a higher layer")
+	}
+	if extensions[".zz"] {
+		t.Errorf("Expected .zz to be removed by a higher layer")
+	}
+	if !extensions[".rs"] {
+		t.Errorf("Expected default extension .rs to be kept")
+	}
+
+	sources := resolver.Sources()
+	expectedSources := map[string]string{
+		"format":         "flag --format",
+		"redact_secrets": "environment GRIMOIRE_REDACT_SECRETS",
+		"force":          "default",
+	}
+	for key, expected := range expectedSources {
+		got := sources[key]
+		if len(got) != 1 || got[0].String() != expected {
+			t.Errorf("Source mismatch for %s: got %v, want %s", key, got, expected)
+		}
+	}
+
+	if got := len(sources["remove_extensions"]); got != 1 {
+		t.Errorf("Expected one source for remove_extensions, got %d", got)
+	}
+}
+
+func TestResolverReplacingExtensions(t *testing.T) {
+	resolver := NewResolver()
+
+	resolver.Apply(&Settings{AddExtensions: []string{"zz"}}, Source{Layer: LayerUser})
+	resolver.Apply(&Settings{Extensions: []string{"go", "md"}}, Source{Layer: LayerProject})
+
+	extensions := resolver.Settings().ResolveExtensions()
+	if len(extensions) != 2 || !extensions[".go"] || !extensions[".md"] {
+		t.Errorf("Extensions mismatch: got %v, want [.go .md]", extensions)
+	}
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		check       func(t *testing.T, s *Settings)
+		expectError bool
+	}{
+		{
+			name: "No variables",
+			env:  map[string]string{},
+			check: func(t *testing.T, s *Settings) {
+				if s.Format != nil || s.RedactSecrets != nil || s.AddExtensions != nil {
+					t.Errorf("Expected no settings, got %+v", s)
+				}
+			},
+		},
+		{
+			name: "Scalar and list values",
+			env: map[string]string{
+				"GRIMOIRE_FORMAT":               "xml",
+				"GRIMOIRE_REDACT_SECRETS":       "true",
+				"GRIMOIRE_HIGH_TOKEN_THRESHOLD": "100",
+				"GRIMOIRE_ADD_EXTENSIONS":       "hcl, nix,",
+			},
+			check: func(t *testing.T, s *Settings) {
+				if s.Format == nil || *s.Format != "xml" {
+					t.Errorf("Format mismatch: got %v", s.Format)
+				}
+				if s.RedactSecrets == nil || !*s.RedactSecrets {
+					t.Errorf("RedactSecrets mismatch: got %v", s.RedactSecrets)
+				}
+				if s.HighTokenThreshold == nil || *s.HighTokenThreshold != 100 {
+					t.Errorf("HighTokenThreshold mismatch: got %v", s.HighTokenThreshold)
+				}
+				if !slicesEqual(s.AddExtensions, []string{"hcl", "nix"}) {
+					t.Errorf("AddExtensions mismatch: got %v", s.AddExtensions)
+				}
+			},
+		},
+		{
+			name:        "Invalid boolean",
+			env:         map[string]string{"GRIMOIRE_FORCE": "maybe"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+
+			settings, err := SettingsFromEnv(lookup)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			tt.check(t, settings)
+		})
+	}
+}
+
+func TestFindProjectConfigFiles(t *testing.T) {
+	repoDir := t.TempDir()
+	subDir := filepath.Join(repoDir, "services", "api")
+
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create subdir: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(repoDir, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git dir: %v", err)
+	}
+
+	rootConfig := filepath.Join(repoDir, ProjectConfigFilename)
+	subConfig := filepath.Join(subDir, ProjectConfigFilename)
+	for _, path := range []string{rootConfig, subConfig} {
+		if err := os.WriteFile(path, []byte("format = \"xml\"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+
+	files := FindProjectConfigFiles(subDir)
+	if !slicesEqual(files, []string{rootConfig, subConfig}) {
+		t.Errorf("Config files mismatch: got %v, want %v", files, []string{rootConfig, subConfig})
+	}
+}
+
+func slicesEqual(s1, s2 []string) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i, v := range s1 {
+		if v != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestResolveProfile(t *testing.T) {
+	profiles := map[string]*Profile{
+		"review":  {Settings: Settings{Format: ptr("xml")}},
+		"backend": {Settings: Settings{Include: []string{"services/"}}, Extends: ptr("review")},
+		"loop-a":  {Extends: ptr("loop-b")},
+		"loop-b":  {Extends: ptr("loop-a")},
+		"orphan":  {Extends: ptr("missing")},
+	}
+
+	tests := []struct {
+		name          string
+		profile       string
+		expectedChain []string
+		expectError   bool
+	}{
+		{name: "Single profile", profile: "review", expectedChain: []string{"review"}},
+		{name: "Inherited profile", profile: "backend", expectedChain: []string{"review", "backend"}},
+		{name: "Unknown profile", profile: "nope", expectError: true},
+		{name: "Unknown parent", profile: "orphan", expectError: true},
+		{name: "Circular inheritance", profile: "loop-a", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := ResolveProfile(profiles, tt.profile)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slicesEqual(chain, tt.expectedChain) {
+				t.Errorf("Chain mismatch: got %v, want %v", chain, tt.expectedChain)
+			}
+		})
+	}
+}
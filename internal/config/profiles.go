@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named set of settings defined in a configuration file under
+// [profiles.<name>], selected with --profile. A profile may extend another
+// profile, in which case its own settings are applied on top of the parent's.
+type Profile struct {
+	Settings
+
+	// Extends names the profile this profile builds upon.
+	Extends *string `toml:"extends"`
+
+	// origin is the path of the configuration file the profile was defined in.
+	origin string
+}
+
+// ResolveProfile returns the chain of profiles that make up the named profile,
+// ordered from the furthest ancestor to the named profile itself, so that applying
+// them in order lets each profile override the ones it extends. It returns an error
+// if a profile is unknown or the inheritance chain contains a cycle.
+func ResolveProfile(profiles map[string]*Profile, name string) ([]string, error) {
+	var chain []string
+	visited := make(map[string]bool)
+
+	for current := name; current != ""; {
+		if visited[current] {
+			return nil, fmt.Errorf("profile %q has circular inheritance: %s -> %s", name, strings.Join(chain, " -> "), current)
+		}
+		visited[current] = true
+
+		profile, ok := profiles[current]
+		if !ok {
+			if current == name {
+				return nil, fmt.Errorf("unknown profile %q", name)
+			}
+			return nil, fmt.Errorf("profile %q extends unknown profile %q", chain[len(chain)-1], current)
+		}
+		chain = append(chain, current)
+
+		current = ""
+		if profile.Extends != nil {
+			current = *profile.Extends
+		}
+	}
+
+	// Reverse the chain so that ancestors come first.
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// filePriority is the packing priority of a file within a token budget. Files with a
+// higher weight are packed first, then files with a higher churn score, then files with
+// more commits, then files that come earlier in the output.
+type filePriority struct {
+	// weight is the sum of the weights of the priority patterns matching the file.
+	weight int
+
+	// churn is the churn score of the file.
+	churn float64
+
+	// commits is the number of commits that touched the file.
+	commits int
+}
+
+// omittedFile is a file left out of the output because it did not fit a token budget.
+type omittedFile struct {
+	// path is the path of the file relative to the target directory.
+	path string
+
+	// tokens is the token count of the file.
+	tokens int
+
+	// remaining is the budget that was left when the file was considered.
+	remaining int
+}
+
+// filePriorities returns the packing priority of each of paths, which are relative to
+// the target directory. commitCounts and churn are keyed by paths relative to the
+// repository root, and commitPrefix is the path of the target directory relative to the
+// repository root.
+func filePriorities(paths []string, commitCounts map[string]int, churn map[string]float64, commitPrefix string, patterns []config.PriorityPattern) []filePriority {
+	matchers := make([]*gitignore.GitIgnore, len(patterns))
+	for i, pattern := range patterns {
+		matchers[i] = gitignore.CompileIgnoreLines(pattern.Pattern)
+	}
+
+	priorities := make([]filePriority, len(paths))
+	for i, relPath := range paths {
+		relPath = filepath.ToSlash(relPath)
+
+		for j, matcher := range matchers {
+			if matcher.MatchesPath(relPath) {
+				priorities[i].weight += patterns[j].Weight
+			}
+		}
+
+		priorities[i].churn = churn[path.Join(commitPrefix, relPath)]
+		priorities[i].commits = commitCounts[path.Join(commitPrefix, relPath)]
+	}
+
+	return priorities
+}
+
+// packWithinBudget greedily selects files in priority order, keeping each file whose
+// token count fits in what is left of maxTokens and omitting the others. Kept files are
+// returned in their original order, and omitted files in the order they were considered.
+// It returns the kept files, the omitted files and the number of tokens used.
+func packWithinBudget(files []serializer.SourceFile, tokenCounts []int, priorities []filePriority, maxTokens int) ([]serializer.SourceFile, []omittedFile, int) {
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := priorities[order[a]], priorities[order[b]]
+		if pa.weight != pb.weight {
+			return pa.weight > pb.weight
+		}
+		if pa.churn != pb.churn {
+			return pa.churn > pb.churn
+		}
+		return pa.commits > pb.commits
+	})
+
+	kept := make([]bool, len(files))
+	var omitted []omittedFile
+	used := 0
+
+	for _, i := range order {
+		if used+tokenCounts[i] <= maxTokens {
+			kept[i] = true
+			used += tokenCounts[i]
+		} else {
+			omitted = append(omitted, omittedFile{
+				path:      files[i].Path,
+				tokens:    tokenCounts[i],
+				remaining: maxTokens - used,
+			})
+		}
+	}
+
+	var keptFiles []serializer.SourceFile
+	for i, file := range files {
+		if kept[i] {
+			keptFiles = append(keptFiles, file)
+		}
+	}
+
+	return keptFiles, omitted, used
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+func TestFilePriorities(t *testing.T) {
+	paths := []string{"README.md", "internal/core/runner.go", "internal/core/runner_test.go", "docs/guide.md"}
+	commitCounts := map[string]int{"app/README.md": 3, "app/internal/core/runner.go": 7}
+	patterns := []config.PriorityPattern{
+		{Pattern: "internal/", Weight: 10},
+		{Pattern: "*_test.go", Weight: -15},
+		{Pattern: "README.md", Weight: 2},
+	}
+
+	churn := map[string]float64{"app/internal/core/runner.go": 1.5, "app/docs/guide.md": 0.25}
+
+	got := filePriorities(paths, commitCounts, churn, "app", patterns)
+	want := []filePriority{
+		{weight: 2, commits: 3},
+		{weight: 10, churn: 1.5, commits: 7},
+		{weight: -5, commits: 0},
+		{weight: 0, churn: 0.25, commits: 0},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Priorities mismatch: got %+v, want %+v", got, want)
+	}
+}
+
+func TestPackWithinBudget(t *testing.T) {
+	files := []serializer.SourceFile{{Path: "a"}, {Path: "b"}, {Path: "c"}, {Path: "d"}}
+
+	tests := []struct {
+		name        string
+		tokens      []int
+		priorities  []filePriority
+		maxTokens   int
+		wantKept    []string
+		wantOmitted []string
+		wantUsed    int
+	}{
+		{
+			name:       "Everything fits",
+			tokens:     []int{10, 20, 30, 40},
+			priorities: make([]filePriority, 4),
+			maxTokens:  100,
+			wantKept:   []string{"a", "b", "c", "d"},
+			wantUsed:   100,
+		},
+		{
+			name:        "Equal priorities keep output order",
+			tokens:      []int{10, 20, 30, 40},
+			priorities:  make([]filePriority, 4),
+			maxTokens:   35,
+			wantKept:    []string{"a", "b"},
+			wantOmitted: []string{"c", "d"},
+			wantUsed:    30,
+		},
+		{
+			name:        "Smaller files fill the remaining budget",
+			tokens:      []int{50, 60, 10, 40},
+			priorities:  make([]filePriority, 4),
+			maxTokens:   100,
+			wantKept:    []string{"a", "c", "d"},
+			wantOmitted: []string{"b"},
+			wantUsed:    100,
+		},
+		{
+			name:        "Weights then commits decide",
+			tokens:      []int{40, 40, 40, 40},
+			priorities:  []filePriority{{weight: 0, commits: 1}, {weight: 0, commits: 9}, {weight: 5}, {weight: -1, commits: 50}},
+			maxTokens:   80,
+			wantKept:    []string{"b", "c"},
+			wantOmitted: []string{"a", "d"},
+			wantUsed:    80,
+		},
+		{
+			name:        "Churn decides before commits",
+			tokens:      []int{40, 40, 40, 40},
+			priorities:  []filePriority{{churn: 0.5, commits: 1}, {commits: 9}, {churn: 2}, {churn: 0.5, commits: 3}},
+			maxTokens:   80,
+			wantKept:    []string{"c", "d"},
+			wantOmitted: []string{"a", "b"},
+			wantUsed:    80,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, omitted, used := packWithinBudget(files, tt.tokens, tt.priorities, tt.maxTokens)
+
+			var keptPaths, omittedPaths []string
+			for _, file := range kept {
+				keptPaths = append(keptPaths, file.Path)
+			}
+			for _, file := range omitted {
+				omittedPaths = append(omittedPaths, file.path)
+			}
+
+			if !reflect.DeepEqual(keptPaths, tt.wantKept) {
+				t.Errorf("Kept mismatch: got %v, want %v", keptPaths, tt.wantKept)
+			}
+			if !reflect.DeepEqual(omittedPaths, tt.wantOmitted) {
+				t.Errorf("Omitted mismatch: got %v, want %v", omittedPaths, tt.wantOmitted)
+			}
+			if used != tt.wantUsed {
+				t.Errorf("Used mismatch: got %d, want %d", used, tt.wantUsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"path/filepath"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/pool"
+	"github.com/foresturquhart/grimoire/internal/secrets"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/rs/zerolog/log"
+)
+
+// diffArgs returns the `git diff` arguments that select the changes requested by cfg, and
+// a description of those changes such as "since main".
+func diffArgs(cfg *config.Config) ([]string, string) {
+	switch {
+	case cfg.Since != "":
+		// Compare the working tree with the merge base, so that changes made on the ref
+		// since the branch point are not reported.
+		return []string{"--merge-base", cfg.Since}, "since " + cfg.Since
+	case cfg.Staged:
+		return []string{"--cached"}, "in the staging area"
+	default:
+		return []string{"HEAD"}, "in the working tree"
+	}
+}
+
+// filterChanged restricts files to those changed as requested by cfg, according to git.
+// It returns the remaining files in their original order, the change of each one keyed by
+// its path, and the change set listing deleted and renamed files.
+//
+// Files that git reports as changed but that are not in files, because they are filtered
+// out, are left out. Untracked files are never reported as changed. Deleted and renamed
+// files are listed regardless, so the output mentions every path that no longer exists.
+func filterChanged(cfg *config.Config, git *Git, files []string) ([]string, map[string]FileChange, *serializer.ChangeSet, error) {
+	args, description := diffArgs(cfg)
+
+	changes, err := git.ChangedFiles(cfg.TargetDir, args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	changeSet := &serializer.ChangeSet{Description: description}
+	byPath := make(map[string]FileChange, len(changes))
+
+	for _, change := range changes {
+		switch change.Status {
+		case "deleted":
+			changeSet.Deleted = append(changeSet.Deleted, change.Path)
+			continue
+		case "renamed":
+			changeSet.Renamed = append(changeSet.Renamed, serializer.Rename{From: change.OldPath, To: change.Path})
+		}
+		byPath[change.Path] = change
+	}
+
+	var changed []string
+	for _, file := range files {
+		if _, ok := byPath[filepath.ToSlash(file)]; ok {
+			changed = append(changed, file)
+		}
+	}
+
+	log.Info().Msgf("Found %d changed files %s, %d of them excluded by filters", len(byPath), description, len(byPath)-len(changed))
+
+	return changed, byPath, changeSet, nil
+}
+
+// readDiffs sets the diff of each changed file in files, taken from git with the same
+// comparison as the file selection, on a pool of cfg.Jobs workers. Each diff is scanned for
+// secrets with detector as soon as it has been read. Diffs that cannot be read are logged
+// and left out. The returned findings have lines relative to the diffs.
+func readDiffs(cfg *config.Config, git *Git, files []serializer.SourceFile, detector *secrets.Detector) []secrets.Finding {
+	args, _ := diffArgs(cfg)
+	var findings []secrets.Finding
+
+	_ = pool.Ordered(len(files), cfg.Jobs, func(i int) readResult {
+		file := files[i]
+		if file.Status == "" {
+			return readResult{}
+		}
+
+		// Diff a renamed file against its previous path, so that only the changes show
+		paths := []string{filepath.ToSlash(file.Path)}
+		if file.Status == "renamed" {
+			paths = append([]string{file.OldPath}, paths...)
+		}
+
+		diff, err := git.FileDiff(cfg.TargetDir, args, paths...)
+		if err != nil {
+			return readResult{err: err}
+		}
+
+		return readResult{
+			content:  []byte(diff),
+			findings: detector.DetectSecrets(filepath.Join(cfg.TargetDir, file.Path), []byte(diff)),
+		}
+	}, func(i int, result readResult) error {
+		if result.err != nil {
+			log.Warn().Err(result.err).Msgf("Skipping diff of %s due to read error", files[i].Path)
+			return nil
+		}
+
+		if len(result.content) > 0 {
+			files[i].Diff = result.content
+		}
+		findings = append(findings, result.findings...)
+		return nil
+	})
+
+	return findings
+}
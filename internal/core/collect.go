@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/secrets"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// collection holds the files selected for a run, read and scanned for secrets.
+type collection struct {
+	// sourceFiles are the files in output order.
+	sourceFiles []serializer.SourceFile
+
+	// findings are the secrets detected in sourceFiles.
+	findings []secrets.Finding
+
+	// diffFindings are the secrets detected in the diffs of sourceFiles, with lines
+	// relative to the diffs.
+	diffFindings []secrets.Finding
+
+	// repoDir is the root of the Git repository containing the target directory, or
+	// empty if there is none.
+	repoDir string
+
+	// changes describes the changes the files were selected from, or is nil if all files
+	// are included.
+	changes *serializer.ChangeSet
+
+	// history provides the Git history of the files, keeping what was loaded to order them.
+	history *gitHistory
+}
+
+// collectFiles lists the files in cfg.TargetDir, at a Git ref, from git or by walking the
+// filesystem, reads them while detecting secrets, and orders them by the strategies of
+// cfg.Order. Findings are returned for the caller to act on.
+func collectFiles(cfg *config.Config) (*collection, error) {
+	gitExecutor := NewDefaultGitExecutor()
+	git := NewGit(gitExecutor)
+
+	// Locate the Git repository containing TargetDir, if any, so that ignore rules from
+	// the rest of the repository and the user's global excludes file are honored.
+	var repoDir, globalExcludesFile string
+	if root, err := git.FindRepositoryRoot(cfg.TargetDir); err == nil {
+		repoDir = root
+		if git.IsAvailable() {
+			globalExcludesFile, err = git.GlobalExcludesFile(repoDir)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to locate global Git excludes file")
+			}
+		}
+	}
+
+	walkerOpts := WalkerOptions{
+		AllowedFileExtensions: cfg.AllowedFileExtensions,
+		AllowedFileNames:      cfg.AllowedFileNames,
+		ShebangInterpreters:   cfg.ShebangInterpreters,
+		AnyText:               cfg.AnyText,
+		IgnoredPathRegexes:    cfg.IgnoredPathRegexes,
+		KeepFileNames:         cfg.KeepFileNames,
+		IncludePatterns:       cfg.IncludePatterns,
+		ExcludePatterns:       cfg.ExcludePatterns,
+		OutputFile:            cfg.OutputFile,
+		RepoDir:               repoDir,
+		GlobalExcludesFile:    globalExcludesFile,
+	}
+
+	// Take the file list and contents from a Git ref if requested, or else the file list
+	// from git if requested and possible, falling back to walking the filesystem.
+	var files []string
+	var source FileSource
+	var err error
+	listed := false
+	if cfg.Ref != "" {
+		if !git.IsAvailable() {
+			return nil, fmt.Errorf("reading files at a Git ref requires the git executable")
+		}
+		if repoDir == "" {
+			return nil, fmt.Errorf("reading files at a Git ref requires a Git repository, none found at %s", cfg.TargetDir)
+		}
+
+		walker := NewRefWalker(cfg.TargetDir, cfg.Ref, git, walkerOpts)
+		files, err = walker.Walk()
+		if err != nil {
+			return nil, fmt.Errorf("error listing files at %s: %w", cfg.Ref, err)
+		}
+		source = walker.Source()
+		listed = true
+	} else if cfg.FileSource == "git" {
+		if !git.IsAvailable() {
+			log.Warn().Msg("Git executable not found, falling back to filesystem walk")
+		} else if repoDir == "" {
+			log.Warn().Msgf("No Git repository found at %s, falling back to filesystem walk", cfg.TargetDir)
+		} else {
+			walker := NewGitWalker(cfg.TargetDir, git, walkerOpts)
+			files, err = walker.Walk()
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to list files with git, falling back to filesystem walk")
+			} else {
+				source = walker.Source()
+				listed = true
+			}
+		}
+	}
+
+	if !listed {
+		// Create a new walker to recursively find and filter files in TargetDir,
+		// returning a slice of string paths.
+		walker := NewDefaultWalker(cfg.TargetDir, walkerOpts)
+		files, err = walker.Walk()
+		if err != nil {
+			return nil, fmt.Errorf("error walking target directory: %w", err)
+		}
+		source = walker.Source()
+	}
+
+	if cfg.Ref != "" {
+		log.Info().Msgf("Found %d files in %s at %s", len(files), cfg.TargetDir, cfg.Ref)
+	} else {
+		log.Info().Msgf("Found %d files in %s", len(files), cfg.TargetDir)
+	}
+
+	// Keep only changed files if requested, remembering how each one changed.
+	var changes map[string]FileChange
+	var changeSet *serializer.ChangeSet
+	if cfg.ChangesOnly() {
+		if !git.IsAvailable() {
+			return nil, fmt.Errorf("including only changed files requires the git executable")
+		}
+		if repoDir == "" {
+			return nil, fmt.Errorf("including only changed files requires a Git repository, none found at %s", cfg.TargetDir)
+		}
+
+		files, changes, changeSet, err = filterChanged(cfg, git, files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list changed files: %w", err)
+		}
+	}
+
+	log.Info().Msg("Checking for secrets in files...")
+
+	// Create a secrets detector
+	detector, err := secrets.NewDetector()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets detector: %w", err)
+	}
+
+	// Read every file once, detecting secrets in its content as it is read.
+	sourceFiles, findings := readFiles(cfg.TargetDir, source, files, cfg.Jobs, detector)
+
+	for i := range sourceFiles {
+		if change, ok := changes[filepath.ToSlash(sourceFiles[i].Path)]; ok {
+			sourceFiles[i].Status = change.Status
+			sourceFiles[i].OldPath = change.OldPath
+		}
+	}
+
+	// Read the diffs of changed files if requested, detecting secrets in them too.
+	var diffFindings []secrets.Finding
+	if cfg.Diff != "" {
+		diffFindings = readDiffs(cfg, git, sourceFiles, detector)
+	}
+
+	collected := &collection{
+		sourceFiles:  sourceFiles,
+		findings:     findings,
+		diffFindings: diffFindings,
+		repoDir:      repoDir,
+		changes:      changeSet,
+		history:      newGitHistory(cfg, git, repoDir),
+	}
+
+	// Order the files once read, so that strategies can use their content as it will be
+	// serialized. The history loaded for ordering is kept for prioritizing files within a
+	// token budget.
+	collected.sourceFiles, err = orderFiles(cfg, collected.history, newSerializeOptions(cfg, collected), sourceFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return collected, nil
+}
+
+// hasFindings reports whether secrets were detected in the files or their diffs.
+func (c *collection) hasFindings() bool {
+	return len(c.findings) > 0 || len(c.diffFindings) > 0
+}
+
+// logFindings logs each secret detected in the files and their diffs at the level of logFn.
+func (c *collection) logFindings(logFn func() *zerolog.Event) {
+	for _, group := range []struct {
+		findings []secrets.Finding
+		msg      string
+	}{
+		{findings: c.findings, msg: "Detected possible secret"},
+		{findings: c.diffFindings, msg: "Detected possible secret in diff"},
+	} {
+		for _, finding := range group.findings {
+			logFn().
+				Str("type", finding.Description).
+				Str("secret", finding.Secret).
+				Str("file", finding.File).
+				Int("line", finding.Line).
+				Msg(group.msg)
+		}
+	}
+}
+
+// newSerializeOptions returns the options for serializing the collected files according
+// to cfg, with findings redacted if redaction is enabled.
+func newSerializeOptions(cfg *config.Config, collected *collection) serializer.SerializeOptions {
+	// Prepare redaction info if needed
+	var redactionInfo *serializer.RedactionInfo
+	if cfg.RedactSecrets && collected.hasFindings() {
+		redactionInfo = &serializer.RedactionInfo{
+			Enabled:      true,
+			Findings:     collected.findings,
+			DiffFindings: collected.diffFindings,
+			BaseDir:      cfg.TargetDir,
+		}
+	}
+
+	return serializer.SerializeOptions{
+		BaseDir:                cfg.TargetDir,
+		ShowTree:               cfg.ShowTree,
+		Redaction:              redactionInfo,
+		Changes:                collected.changes,
+		Diffs:                  cfg.Diff,
+		DiffOnly:               cfg.DiffOnly,
+		LargeFileSizeThreshold: cfg.LargeFileSizeThreshold,
+		HighTokenThreshold:     cfg.HighTokenThreshold,
+		SkipTokenCount:         cfg.SkipTokenCount,
+		Jobs:                   cfg.Jobs,
+		ChunkTokens:            cfg.ChunkTokens,
+		ChunkOverlap:           cfg.ChunkOverlap,
+		StrictXML:              cfg.XMLStyle == "strict",
+		Version:                cfg.Version,
+		ConfigSummary:          cfg.Summary(),
+	}
+}
@@ -0,0 +1,408 @@
+package core
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+var (
+	// goImportBlockRegex matches a parenthesized Go import block.
+	goImportBlockRegex = regexp.MustCompile(`(?m)^import\s*\(([^)]*)\)`)
+
+	// goImportRegex matches a single-line Go import.
+	goImportRegex = regexp.MustCompile(`(?m)^import\s+(?:[\w.]+\s+)?"([^"]+)"`)
+
+	// goModuleRegex matches the module directive of a go.mod file.
+	goModuleRegex = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+	// goImportSpecRegex matches the import paths within a Go import block.
+	goImportSpecRegex = regexp.MustCompile(`"([^"]+)"`)
+
+	// jsImportRegex matches JavaScript and TypeScript imports, re-exports and requires.
+	jsImportRegex = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*|\b(?:require|import)\s*\(\s*)['"]([^'"]+)['"]`)
+
+	// pythonFromImportRegex matches Python "from module import name" statements.
+	pythonFromImportRegex = regexp.MustCompile(`(?m)^\s*from\s+(\.*[\w.]*)\s+import\b`)
+
+	// pythonImportRegex matches Python "import module" statements.
+	pythonImportRegex = regexp.MustCompile(`(?m)^\s*import\s+([\w.]+(?:\s*,\s*[\w.]+)*)`)
+
+	// cIncludeRegex matches C and C++ includes of project headers.
+	cIncludeRegex = regexp.MustCompile(`(?m)^\s*#\s*include\s*"([^"]+)"`)
+
+	// javaImportRegex matches Java, Kotlin and Scala imports of a single class.
+	javaImportRegex = regexp.MustCompile(`(?m)^\s*import\s+(?:static\s+)?([\w.]+)`)
+
+	// rustModRegex matches Rust module declarations whose body is in another file.
+	rustModRegex = regexp.MustCompile(`(?m)^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(\w+)\s*;`)
+)
+
+// jsExtensions lists the extensions tried, in order, when resolving a JavaScript or
+// TypeScript import that leaves out the extension.
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".vue", ".svelte"}
+
+// dependencyGraph resolves the imports of a set of files to other files in the set.
+type dependencyGraph struct {
+	// paths holds the path of each file, relative to the target directory with forward
+	// slashes.
+	paths []string
+
+	// byPath maps each path to the index of its file.
+	byPath map[string]int
+
+	// bySuffix maps every trailing sequence of path elements, such as "b/c.py" for
+	// "a/b/c.py", to the indexes of the files whose path ends with it.
+	bySuffix map[string][]int
+
+	// goPackages maps each directory holding Go files to the indexes of its non-test files.
+	goPackages map[string][]int
+
+	// goModules maps the path of each Go module declared by a go.mod file in the set to
+	// the directory of the file.
+	goModules map[string]string
+}
+
+// newDependencyGraph indexes the paths of files for resolving imports.
+func newDependencyGraph(files []serializer.SourceFile) *dependencyGraph {
+	g := &dependencyGraph{
+		paths:      make([]string, len(files)),
+		byPath:     make(map[string]int, len(files)),
+		bySuffix:   make(map[string][]int),
+		goPackages: make(map[string][]int),
+		goModules:  make(map[string]string),
+	}
+
+	for i, file := range files {
+		p := filepath.ToSlash(file.Path)
+		g.paths[i] = p
+		g.byPath[p] = i
+
+		for suffix := p; ; {
+			g.bySuffix[suffix] = append(g.bySuffix[suffix], i)
+			_, rest, ok := strings.Cut(suffix, "/")
+			if !ok {
+				break
+			}
+			suffix = rest
+		}
+
+		if strings.HasSuffix(p, ".go") && !strings.HasSuffix(p, "_test.go") {
+			dir := path.Dir(p)
+			g.goPackages[dir] = append(g.goPackages[dir], i)
+		}
+
+		if path.Base(p) == "go.mod" {
+			if match := goModuleRegex.FindSubmatch(file.Content); match != nil {
+				g.goModules[string(match[1])] = path.Dir(p)
+			}
+		}
+	}
+
+	return g
+}
+
+// dependencies returns the indexes of the files in the graph that the file at index i
+// imports, based on its extension and content. Imports that cannot be resolved, such
+// as those of third-party packages, are left out.
+func (g *dependencyGraph) dependencies(i int, content string) []int {
+	p := g.paths[i]
+	dir := path.Dir(p)
+
+	var deps []int
+	switch strings.ToLower(path.Ext(p)) {
+	case ".go":
+		var imports []string
+		for _, block := range goImportBlockRegex.FindAllStringSubmatch(content, -1) {
+			for _, spec := range goImportSpecRegex.FindAllStringSubmatch(block[1], -1) {
+				imports = append(imports, spec[1])
+			}
+		}
+		for _, match := range goImportRegex.FindAllStringSubmatch(content, -1) {
+			imports = append(imports, match[1])
+		}
+		for _, importPath := range imports {
+			deps = append(deps, g.resolveGoImport(importPath, dir)...)
+		}
+
+	case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs", ".vue", ".svelte":
+		for _, match := range jsImportRegex.FindAllStringSubmatch(content, -1) {
+			if spec := match[1]; strings.HasPrefix(spec, ".") {
+				deps = append(deps, g.resolveJSImport(path.Join(dir, spec))...)
+			}
+		}
+
+	case ".py":
+		for _, match := range pythonFromImportRegex.FindAllStringSubmatch(content, -1) {
+			deps = append(deps, g.resolvePythonImport(match[1], dir)...)
+		}
+		for _, match := range pythonImportRegex.FindAllStringSubmatch(content, -1) {
+			for _, module := range strings.Split(match[1], ",") {
+				deps = append(deps, g.resolvePythonImport(strings.TrimSpace(module), dir)...)
+			}
+		}
+
+	case ".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".hh", ".hxx", ".m", ".mm":
+		for _, match := range cIncludeRegex.FindAllStringSubmatch(content, -1) {
+			if j, ok := g.byPath[path.Join(dir, match[1])]; ok {
+				deps = append(deps, j)
+			} else {
+				deps = append(deps, g.resolveSuffix(path.Clean(match[1]), dir)...)
+			}
+		}
+
+	case ".java", ".kt", ".scala":
+		for _, match := range javaImportRegex.FindAllStringSubmatch(content, -1) {
+			base := strings.ReplaceAll(match[1], ".", "/")
+			for _, ext := range []string{".java", ".kt", ".scala"} {
+				deps = append(deps, g.resolveSuffix(base+ext, dir)...)
+			}
+		}
+
+	case ".rs":
+		// Declarations in lib.rs, main.rs and mod.rs refer to files in the same directory,
+		// and those in other files to files in a directory named after the file.
+		modDir := dir
+		if base := path.Base(p); base != "lib.rs" && base != "main.rs" && base != "mod.rs" {
+			modDir = path.Join(dir, strings.TrimSuffix(base, ".rs"))
+		}
+		for _, match := range rustModRegex.FindAllStringSubmatch(content, -1) {
+			for _, candidate := range []string{match[1] + ".rs", match[1] + "/mod.rs"} {
+				if j, ok := g.byPath[path.Join(modDir, candidate)]; ok {
+					deps = append(deps, j)
+					break
+				}
+			}
+		}
+	}
+
+	// Leave out self-references and duplicates.
+	seen := map[int]bool{i: true}
+	unique := deps[:0]
+	for _, j := range deps {
+		if !seen[j] {
+			seen[j] = true
+			unique = append(unique, j)
+		}
+	}
+	return unique
+}
+
+// resolveGoImport resolves a Go import path to the non-test files of the package it
+// names. Packages of the modules declared by go.mod files in the set are found relative
+// to the go.mod file. Without any, the longest trailing part of the path that names a
+// directory holding Go files is used, skipping standard library packages, whose first
+// path element has no dot. Files of the importing package itself, in dir, are never
+// returned.
+func (g *dependencyGraph) resolveGoImport(importPath, dir string) []int {
+	if len(g.goModules) > 0 {
+		// Nested modules take precedence over the modules containing them.
+		pkgDir, longest := "", ""
+		for module, moduleDir := range g.goModules {
+			rest, ok := strings.CutPrefix(importPath, module)
+			if ok && (rest == "" || rest[0] == '/') && len(module) > len(longest) {
+				pkgDir, longest = path.Join(moduleDir, rest), module
+			}
+		}
+		if longest == "" || pkgDir == dir {
+			return nil
+		}
+		return g.goPackages[pkgDir]
+	}
+
+	first, _, _ := strings.Cut(importPath, "/")
+	if !strings.Contains(first, ".") {
+		return nil
+	}
+
+	for suffix := importPath; ; {
+		if pkgDir := g.goPackageDir(suffix); pkgDir != "" && pkgDir != dir {
+			return g.goPackages[pkgDir]
+		}
+		_, rest, ok := strings.Cut(suffix, "/")
+		if !ok {
+			return nil
+		}
+		suffix = rest
+	}
+}
+
+// goPackageDir returns the directory holding Go files whose path is dir, or ends with
+// dir, if there is exactly one, or an empty string otherwise.
+func (g *dependencyGraph) goPackageDir(dir string) string {
+	if _, ok := g.goPackages[dir]; ok {
+		return dir
+	}
+
+	found := ""
+	for pkgDir := range g.goPackages {
+		if strings.HasSuffix(pkgDir, "/"+dir) {
+			if found != "" {
+				return ""
+			}
+			found = pkgDir
+		}
+	}
+	return found
+}
+
+// resolveJSImport resolves the target of a relative JavaScript or TypeScript import,
+// joined to the directory of the importing file, trying the path as is, with each of
+// jsExtensions, and as a directory with an index file. TypeScript sources imported
+// with a .js extension are found too.
+func (g *dependencyGraph) resolveJSImport(target string) []int {
+	candidates := []string{target}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, target+ext)
+	}
+	if strings.HasSuffix(target, ".js") {
+		base := strings.TrimSuffix(target, ".js")
+		candidates = append(candidates, base+".ts", base+".tsx")
+	}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, target+"/index"+ext)
+	}
+
+	for _, candidate := range candidates {
+		if j, ok := g.byPath[candidate]; ok {
+			return []int{j}
+		}
+	}
+	return nil
+}
+
+// resolvePythonImport resolves a Python module name, which is relative to dir if it
+// starts with dots, to its module file or package __init__.py.
+func (g *dependencyGraph) resolvePythonImport(module, dir string) []int {
+	if strings.HasPrefix(module, ".") {
+		trimmed := strings.TrimLeft(module, ".")
+		base := dir
+		for range len(module) - len(trimmed) - 1 {
+			base = path.Dir(base)
+		}
+		if trimmed == "" {
+			return nil
+		}
+		target := path.Join(base, strings.ReplaceAll(trimmed, ".", "/"))
+		for _, candidate := range []string{target + ".py", target + "/__init__.py"} {
+			if j, ok := g.byPath[candidate]; ok {
+				return []int{j}
+			}
+		}
+		return nil
+	}
+
+	if module == "" {
+		return nil
+	}
+	target := strings.ReplaceAll(module, ".", "/")
+	if deps := g.resolveSuffix(target+".py", dir); len(deps) > 0 {
+		return deps
+	}
+	return g.resolveSuffix(target+"/__init__.py", dir)
+}
+
+// resolveSuffix returns the file whose path ends with suffix. If several do, the one in
+// dir is preferred, and nothing is returned if none of them is.
+func (g *dependencyGraph) resolveSuffix(suffix, dir string) []int {
+	candidates := g.bySuffix[suffix]
+	if len(candidates) == 1 {
+		return candidates
+	}
+	for _, j := range candidates {
+		if path.Dir(g.paths[j]) == dir {
+			return []int{j}
+		}
+	}
+	return nil
+}
+
+// dependencyRanks returns the rank of each of files in dependency order: 0 for files
+// that import no other file in files, and otherwise one more than the highest rank of
+// the files they import. Files that import each other, directly or not, share a rank.
+func dependencyRanks(files []serializer.SourceFile) []int {
+	graph := newDependencyGraph(files)
+	edges := make([][]int, len(files))
+	for i, file := range files {
+		edges[i] = graph.dependencies(i, string(file.Content))
+	}
+
+	// Group files into strongly connected components, so that every cycle collapses into
+	// a single component, then rank the components. Tarjan's algorithm completes each
+	// component after all of the components it depends on, so ranks can be computed as
+	// components complete.
+	const unvisited = -1
+	index := make([]int, len(files))
+	lowLink := make([]int, len(files))
+	onStack := make([]bool, len(files))
+	component := make([]int, len(files))
+	for i := range index {
+		index[i] = unvisited
+	}
+
+	var componentRanks []int
+	var stack []int
+	next := 0
+
+	var visit func(v int)
+	visit = func(v int) {
+		index[v] = next
+		lowLink[v] = next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range edges[v] {
+			if index[w] == unvisited {
+				visit(w)
+				lowLink[v] = min(lowLink[v], lowLink[w])
+			} else if onStack[w] {
+				lowLink[v] = min(lowLink[v], index[w])
+			}
+		}
+
+		if lowLink[v] != index[v] {
+			return
+		}
+
+		// v is the root of a component: pop its members and rank it after the components
+		// its members depend on, which are all complete.
+		id := len(componentRanks)
+		var members []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component[w] = id
+			members = append(members, w)
+			if w == v {
+				break
+			}
+		}
+
+		rank := 0
+		for _, member := range members {
+			for _, w := range edges[member] {
+				if c := component[w]; c != id {
+					rank = max(rank, componentRanks[c]+1)
+				}
+			}
+		}
+		componentRanks = append(componentRanks, rank)
+	}
+
+	for i := range files {
+		if index[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	ranks := make([]int, len(files))
+	for i := range files {
+		ranks[i] = componentRanks[component[i]]
+	}
+	return ranks
+}
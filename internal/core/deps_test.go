@@ -0,0 +1,96 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+func TestDependencyRanks(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		order    []string
+		expected []int
+	}{
+		{
+			name: "Go packages resolved through go.mod",
+			files: map[string]string{
+				"go.mod":                "module example.com/app\n",
+				"main.go":               "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/app/internal/core\"\n)\n",
+				"internal/core/core.go": "package core\n\nimport \"example.com/app/internal/util\"\n",
+				"internal/core/more.go": "package core\n",
+				"internal/util/util.go": "package util\n\nimport \"github.com/other/util\"\n",
+			},
+			order:    []string{"go.mod", "main.go", "internal/core/core.go", "internal/core/more.go", "internal/util/util.go"},
+			expected: []int{0, 2, 1, 0, 0},
+		},
+		{
+			name: "Go packages resolved by path suffix",
+			files: map[string]string{
+				"core/core.go": "package core\n\nimport \"github.com/x/app/util\"\n",
+				"util/util.go": "package util\n\nimport \"strings\"\n",
+			},
+			order:    []string{"core/core.go", "util/util.go"},
+			expected: []int{1, 0},
+		},
+		{
+			name: "JavaScript and TypeScript relative imports",
+			files: map[string]string{
+				"src/index.ts":     "import { a } from './a.js'\nexport * from \"./lib\"\nimport React from 'react'\n",
+				"src/a.ts":         "const b = require('./b')\n",
+				"src/b.js":         "export const b = 1\n",
+				"src/lib/index.ts": "import './b'\n",
+			},
+			order:    []string{"src/index.ts", "src/a.ts", "src/b.js", "src/lib/index.ts"},
+			expected: []int{2, 1, 0, 0},
+		},
+		{
+			name: "Python absolute and relative imports",
+			files: map[string]string{
+				"app/main.py":         "from app.models import User\nimport os, app.util\n",
+				"app/models.py":       "from .util import helper\n",
+				"app/util.py":         "import json\n",
+				"app/pkg/__init__.py": "from ..models import User\n",
+			},
+			order:    []string{"app/main.py", "app/models.py", "app/util.py", "app/pkg/__init__.py"},
+			expected: []int{2, 1, 0, 2},
+		},
+		{
+			name: "C includes",
+			files: map[string]string{
+				"src/main.c":      "#include <stdio.h>\n#include \"util.h\"\n",
+				"src/util.h":      "#include \"include/types.h\"\n",
+				"include/types.h": "typedef int t;\n",
+			},
+			order:    []string{"src/main.c", "src/util.h", "include/types.h"},
+			expected: []int{2, 1, 0},
+		},
+		{
+			name: "Cycles share a rank",
+			files: map[string]string{
+				"a.py": "import b\n",
+				"b.py": "import a\nimport c\n",
+				"c.py": "",
+				"d.py": "import a\n",
+			},
+			order:    []string{"a.py", "b.py", "c.py", "d.py"},
+			expected: []int{1, 1, 0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make([]serializer.SourceFile, len(tt.order))
+			for i, path := range tt.order {
+				files[i] = serializer.SourceFile{Path: path, Content: []byte(tt.files[path])}
+			}
+
+			got := dependencyRanks(files)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Ranks mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
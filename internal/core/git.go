@@ -2,20 +2,63 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // GitExecutor defines the interface for running git-related commands.
 type GitExecutor interface {
-	// ListFileChanges returns a ReadCloser that streams file paths that were changed in commits.
+	// ListFileHistory returns a ReadCloser that streams the NUL-separated output of
+	// `git log --name-status -M -z` run in repoDir, where each commit starts with its Unix
+	// commit time prefixed with \x01 and followed by a newline, then lists a status and one
+	// or, for renames and copies, two paths per changed file, and ends with an empty token.
+	// Commits are listed from ref, or from HEAD if ref is empty.
 	// The caller is responsible for closing the returned stream.
-	ListFileChanges(repoDir string) (io.ReadCloser, error)
+	ListFileHistory(repoDir, ref string) (io.ReadCloser, error)
+
+	// ListFiles returns a ReadCloser that streams the NUL-separated paths, relative to dir, of
+	// files that are tracked or untracked but not ignored by git.
+	// The caller is responsible for closing the returned stream.
+	ListFiles(dir string) (io.ReadCloser, error)
+
+	// DiffNameStatus returns a ReadCloser that streams the NUL-separated output of
+	// `git diff --name-status` run in dir with the given arguments, which select what is
+	// compared. Paths are relative to dir.
+	// The caller is responsible for closing the returned stream.
+	DiffNameStatus(dir string, args ...string) (io.ReadCloser, error)
+
+	// Diff returns a ReadCloser that streams the unified diff produced by `git diff` run in
+	// dir with the given arguments, which select what is compared and which paths.
+	// The caller is responsible for closing the returned stream.
+	Diff(dir string, args ...string) (io.ReadCloser, error)
+
+	// ListTree returns a ReadCloser that streams the NUL-separated entries of every file in
+	// the tree of ref, as printed by `git ls-tree -r`, with paths relative to the root of
+	// the repository at repoDir.
+	// The caller is responsible for closing the returned stream.
+	ListTree(repoDir, ref string) (io.ReadCloser, error)
+
+	// CatFileBatch returns a ReadCloser that streams the output of `git cat-file --batch` run
+	// in repoDir, given the object names to print, one per line, on objects.
+	// The caller is responsible for closing the returned stream.
+	CatFileBatch(repoDir string, objects io.Reader) (io.ReadCloser, error)
+
+	// ParseDate returns the output of `git rev-parse --since` run in repoDir with date,
+	// which gives the Unix time of the date as --max-age=<time>.
+	ParseDate(repoDir, date string) (string, error)
+
+	// GetConfig returns the value of a git configuration key as seen from repoDir.
+	// It returns an empty string and no error if the key is not set.
+	GetConfig(repoDir, key string) (string, error)
 
 	// IsAvailable indicates whether git is installed and can be found in PATH.
 	IsAvailable() bool
@@ -58,22 +101,134 @@ func (crc *cmdReadCloser) Close() error {
 	return fmt.Errorf("multiple errors on close: %w (close); %v (wait)", closeErr, waitErr)
 }
 
-// ListFileChanges runs the `git log --name-only ...` command and returns a stream of file paths.
+// ListFileHistory runs the `git log --name-status -M -z --pretty=format:%x01%ct ...` command
+// from ref, or from HEAD if ref is empty, and returns a stream of commit times and file
+// changes with renames detected.
 // Callers must close the returned ReadCloser to free resources and reap the spawned process.
-func (e *DefaultGitExecutor) ListFileChanges(repoDir string) (io.ReadCloser, error) {
-	cmd := exec.Command(
-		"git",
+func (e *DefaultGitExecutor) ListFileHistory(repoDir, ref string) (io.ReadCloser, error) {
+	args := []string{
 		"-C", repoDir,
 		"log",
-		"--name-only",
-		"-n", "99999",
-		"--pretty=format:",
+		"--name-status",
+		"-M",
+		"-z",
+		"--pretty=format:%x01%ct",
 		"--no-merges",
 		"--relative",
+	}
+	if ref != "" {
+		args = append(args, ref, "--")
+	}
+	cmd := exec.Command("git", args...)
+	return e.executeWithReader(cmd, os.Stderr)
+}
+
+// ListFiles runs the `git ls-files --cached --others --exclude-standard` command and returns
+// a stream of NUL-separated file paths relative to dir.
+// Callers must close the returned ReadCloser to free resources and reap the spawned process.
+func (e *DefaultGitExecutor) ListFiles(dir string) (io.ReadCloser, error) {
+	cmd := exec.Command(
+		"git",
+		"-C", dir,
+		"ls-files",
+		"-z",
+		"--cached",
+		"--others",
+		"--exclude-standard",
+	)
+	return e.executeWithReader(cmd, os.Stderr)
+}
+
+// DiffNameStatus runs the `git diff --name-status -z -M --relative` command with the given
+// arguments appended, and returns a stream of NUL-separated statuses and paths. Renames
+// are detected, and paths are relative to dir.
+// Callers must close the returned ReadCloser to free resources and reap the spawned process.
+func (e *DefaultGitExecutor) DiffNameStatus(dir string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(
+		"git",
+		append([]string{
+			"-C", dir,
+			"diff",
+			"--name-status",
+			"-z",
+			"-M",
+			"--relative",
+		}, args...)...,
 	)
 	return e.executeWithReader(cmd, os.Stderr)
 }
 
+// Diff runs the `git diff --no-color --no-ext-diff -M --relative` command with the given
+// arguments appended, and returns a stream of the unified diff. Renames are detected, and
+// paths are relative to dir.
+// Callers must close the returned ReadCloser to free resources and reap the spawned process.
+func (e *DefaultGitExecutor) Diff(dir string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(
+		"git",
+		append([]string{
+			"-C", dir,
+			"diff",
+			"--no-color",
+			"--no-ext-diff",
+			"-M",
+			"--relative",
+		}, args...)...,
+	)
+	return e.executeWithReader(cmd, os.Stderr)
+}
+
+// ListTree runs the `git ls-tree -r -z --full-tree <ref>` command and returns a stream of
+// NUL-separated entries, each holding the mode, type, object name and path of a file.
+// Callers must close the returned ReadCloser to free resources and reap the spawned process.
+func (e *DefaultGitExecutor) ListTree(repoDir, ref string) (io.ReadCloser, error) {
+	cmd := exec.Command(
+		"git",
+		"-C", repoDir,
+		"ls-tree",
+		"-r",
+		"-z",
+		"--full-tree",
+		ref,
+		"--",
+	)
+	return e.executeWithReader(cmd, os.Stderr)
+}
+
+// CatFileBatch runs the `git cat-file --batch` command with objects as its standard input,
+// and returns a stream of the header and content of each object in turn.
+// Callers must close the returned ReadCloser to free resources and reap the spawned process.
+func (e *DefaultGitExecutor) CatFileBatch(repoDir string, objects io.Reader) (io.ReadCloser, error) {
+	cmd := exec.Command("git", "-C", repoDir, "cat-file", "--batch")
+	cmd.Stdin = objects
+	return e.executeWithReader(cmd, os.Stderr)
+}
+
+// ParseDate runs the `git rev-parse --since=<date>` command in repoDir and returns its
+// output.
+func (e *DefaultGitExecutor) ParseDate(repoDir, date string) (string, error) {
+	cmd := exec.Command("git", "-C", repoDir, "rev-parse", "--since="+date)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse date %s: %w", date, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetConfig runs `git config --get <key>` and returns the trimmed value. Git exits with
+// status 1 when the key is not set, which is reported as an empty value.
+func (e *DefaultGitExecutor) GetConfig(repoDir, key string) (string, error) {
+	cmd := exec.Command("git", "-C", repoDir, "config", "--get", key)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read git config %s: %w", key, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // IsAvailable returns true if the `git` executable is found in the system's PATH.
 func (e *DefaultGitExecutor) IsAvailable() bool {
 	_, err := exec.LookPath("git")
@@ -137,61 +292,473 @@ func (g *Git) FindRepositoryRoot(startDir string) (string, error) {
 	}
 }
 
-// GetCommitCounts returns a map of file paths to the number of commits in which each file appears.
-func (g *Git) GetCommitCounts(repoDir string) (map[string]int, error) {
-	output, err := g.executor.ListFileChanges(repoDir)
+// GlobalExcludesFile returns the path of the user's global excludes file. This is the
+// value of core.excludesFile if set, with a leading ~/ expanded, and otherwise Git's
+// default of $XDG_CONFIG_HOME/git/ignore (or ~/.config/git/ignore).
+func (g *Git) GlobalExcludesFile(repoDir string) (string, error) {
+	value, err := g.executor.GetConfig(repoDir, "core.excludesFile")
 	if err != nil {
-		return nil, fmt.Errorf("failed to list file changes: %w", err)
+		return "", err
+	}
+
+	home, _ := os.UserHomeDir()
+
+	if value != "" {
+		if strings.HasPrefix(value, "~/") && home != "" {
+			value = filepath.Join(home, value[2:])
+		}
+		return value, nil
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home == "" {
+			return "", nil
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "git", "ignore"), nil
+}
+
+// FileHistory holds statistics of the commits that touched each file, keyed by path.
+type FileHistory struct {
+	// CommitCounts holds the number of commits that touched each file.
+	CommitCounts map[string]int
+
+	// LastModified holds the time of the most recent commit that touched each file.
+	LastModified map[string]time.Time
+
+	// Churn holds the churn score of each file: the number of commits that touched it since
+	// the churn window started, with every commit weighted by its age.
+	Churn map[string]float64
+}
+
+// GetFileHistory reads the history of ref, or of HEAD if ref is empty, once and returns the
+// commit count, last commit time and churn score of each file. Churn scores count only
+// commits since churnSince, or every commit if it is zero, and weigh each commit by its age
+// at now so that its weight halves every halfLife. A zero halfLife weighs every commit as
+// one. Renames are followed, so that commits made to a file under a previous path count
+// towards its current path.
+func (g *Git) GetFileHistory(repoDir, ref string, churnSince time.Time, halfLife time.Duration, now time.Time) (*FileHistory, error) {
+	output, err := g.executor.ListFileHistory(repoDir, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file history: %w", err)
 	}
 	defer output.Close()
 
-	commitCounts := make(map[string]int)
+	history := &FileHistory{
+		CommitCounts: make(map[string]int),
+		LastModified: make(map[string]time.Time),
+		Churn:        make(map[string]float64),
+	}
+
+	// Commits are listed from the most recent, so the first time seen for a file is the
+	// time of its last change.
+	err = readFileHistory(output, func(p string, commitTime time.Time) {
+		history.CommitCounts[p]++
+		if _, ok := history.LastModified[p]; !ok {
+			history.LastModified[p] = commitTime
+		}
+		if !commitTime.Before(churnSince) {
+			history.Churn[p] += decayWeight(now.Sub(commitTime), halfLife)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// ParseDate returns the time of a date in any format git accepts, such as 6.months or
+// 2024-01-01.
+func (g *Git) ParseDate(repoDir, date string) (time.Time, error) {
+	output, err := g.executor.ParseDate(repoDir, date)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(output, "--max-age="), 10, 64)
+	if err != nil || !strings.HasPrefix(output, "--max-age=") {
+		return time.Time{}, fmt.Errorf("unexpected output %q parsing date %s", output, date)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// readFileHistory reads the output of ListFileHistory and calls visit with the current path
+// of the file changed by each change, and the time of its commit, from the most recent
+// commit. Changes made to a file under a previous path are visited with the path it was
+// renamed to, and changes to files deleted since are not visited.
+func readFileHistory(output io.Reader, visit func(p string, commitTime time.Time)) error {
+	// Commits are listed from the most recent, so a rename is seen before the older
+	// commits made under the previous path. renamed maps a previous path to the path its
+	// commits count towards, or to an empty string if they count towards no current file
+	// because the file was deleted since.
+	renamed := make(map[string]string)
+	current := func(p string) string {
+		if to, ok := renamed[p]; ok {
+			return to
+		}
+		return p
+	}
+
+	var commitTime time.Time
+	var status string
+	var paths []string
 
 	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(scanNul)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			commitCounts[line]++
+		token := scanner.Text()
+		if token == "" {
+			continue
+		}
+
+		// A commit starts with its time, followed on the next line by the status of its
+		// first changed file.
+		if strings.HasPrefix(token, "\x01") {
+			header, firstStatus, _ := strings.Cut(token[1:], "\n")
+			seconds, err := strconv.ParseInt(header, 10, 64)
+			if err != nil {
+				return fmt.Errorf("unexpected commit time %q in git log output", header)
+			}
+			commitTime = time.Unix(seconds, 0)
+			status = firstStatus
+			paths = paths[:0]
+			continue
+		}
+
+		if status == "" {
+			status = token
+			paths = paths[:0]
+			continue
+		}
+
+		// Renames and copies are followed by the previous path and the new path.
+		paths = append(paths, token)
+		if (status[0] == 'R' || status[0] == 'C') && len(paths) < 2 {
+			continue
+		}
+
+		switch status[0] {
+		case 'R':
+			to := current(paths[1])
+			renamed[paths[0]] = to
+			if to != "" {
+				visit(to, commitTime)
+			}
+		case 'C':
+			if to := current(paths[1]); to != "" {
+				visit(to, commitTime)
+			}
+		case 'D':
+			// Older commits to this path belong to a file that no longer exists, even if
+			// a newer commit added a file at the same path again.
+			renamed[paths[0]] = ""
+		default:
+			if p := current(paths[0]); p != "" {
+				visit(p, commitTime)
+			}
 		}
+		status = ""
 	}
 
 	if scanErr := scanner.Err(); scanErr != nil {
-		return nil, fmt.Errorf("error reading git log output: %w", scanErr)
+		return fmt.Errorf("error reading git log output: %w", scanErr)
 	}
 
-	return commitCounts, nil
+	return nil
 }
 
-// CommitCounter defines a function type for counting the number of commits per file in a repository.
-type CommitCounter func(repoDir string) (map[string]int, error)
+// decayWeight returns the weight of a commit of the given age, which halves every
+// halfLife, or 1 if halfLife is zero. Commits from the future weigh 1.
+func decayWeight(age, halfLife time.Duration) float64 {
+	if halfLife <= 0 || age <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
 
-// SortFilesByCommitCounts sorts the provided files based on their commit counts in ascending order.
-// It uses the provided commitCounter function to retrieve commit counts for each file.
-func (g *Git) SortFilesByCommitCounts(repoDir string, filePaths []string, commitCounter CommitCounter) ([]string, error) {
-	commitCounts, err := commitCounter(repoDir)
+// ListFiles returns the paths, relative to dir and using forward slashes, of the files
+// in dir that git tracks or that are untracked but not ignored. Paths are deduplicated,
+// since files with merge conflicts are listed once per stage.
+func (g *Git) ListFiles(dir string) ([]string, error) {
+	output, err := g.executor.ListFiles(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get commit counts: %w", err)
+		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 
-	sort.Slice(filePaths, func(i, j int) bool {
-		countI := 0
-		if c, ok := commitCounts[filePaths[i]]; ok {
-			countI = c
+	var files []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(output)
+	scanner.Split(scanNul)
+	for scanner.Scan() {
+		path := scanner.Text()
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
 		}
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil {
+		output.Close()
+		return nil, fmt.Errorf("error reading git ls-files output: %w", scanErr)
+	}
+
+	// Closing waits for git to exit, which reports a failure such as running outside a repository.
+	if err := output.Close(); err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %w", err)
+	}
+
+	return files, nil
+}
 
-		countJ := 0
-		if c, ok := commitCounts[filePaths[j]]; ok {
-			countJ = c
+// FileChange is a file that differs between two versions of a repository.
+type FileChange struct {
+	// Status is the kind of change: "added", "modified", "deleted", "renamed", "copied",
+	// "type changed" or "unmerged".
+	Status string
+
+	// Path is the path of the file, relative to the directory the diff was run in. For a
+	// renamed or copied file, it is the new path.
+	Path string
+
+	// OldPath is the previous path of a renamed or copied file, or empty.
+	OldPath string
+}
+
+// changeStatuses maps the status letters of `git diff --name-status` to change statuses.
+var changeStatuses = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type changed",
+	'U': "unmerged",
+}
+
+// ChangedFiles returns the files that `git diff` reports as changed in dir, with the given
+// arguments selecting what is compared, such as a ref or --cached. Paths are relative to
+// dir and use forward slashes, and renames are detected.
+func (g *Git) ChangedFiles(dir string, args ...string) ([]FileChange, error) {
+	// End the arguments with "--" so that refs cannot be mistaken for paths.
+	output, err := g.executor.DiffNameStatus(dir, append(args[:len(args):len(args)], "--")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff files: %w", err)
+	}
+
+	var fields []string
+	scanner := bufio.NewScanner(output)
+	scanner.Split(scanNul)
+	for scanner.Scan() {
+		fields = append(fields, scanner.Text())
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil {
+		output.Close()
+		return nil, fmt.Errorf("error reading git diff output: %w", scanErr)
+	}
+
+	// Closing waits for git to exit, which reports a failure such as an unknown ref.
+	if err := output.Close(); err != nil {
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+
+	// Each change is a status, such as M or R100 with a similarity score, followed by
+	// its path, or by the old and new paths for renames and copies.
+	var changes []FileChange
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
 		}
 
-		if countI != countJ {
-			// Sort by ascending commit count
-			return countI < countJ
+		status, ok := changeStatuses[fields[i][0]]
+		if !ok {
+			return nil, fmt.Errorf("unexpected git diff status %q", fields[i])
 		}
 
-		// If counts are equal, sort alphabetically
-		return filePaths[i] < filePaths[j]
-	})
+		change := FileChange{Status: status}
+		if status == "renamed" || status == "copied" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("truncated git diff output after status %q", fields[i])
+			}
+			change.OldPath, change.Path = fields[i+1], fields[i+2]
+			i += 2
+		} else {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("truncated git diff output after status %q", fields[i])
+			}
+			change.Path = fields[i+1]
+			i++
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// FileDiff returns the unified diff of the given paths in dir, with args selecting what is
+// compared, such as a ref or --cached. A renamed file is diffed against its previous path
+// when both paths are given. Paths are matched literally rather than as patterns. It
+// returns an empty string if the paths are unchanged.
+func (g *Git) FileDiff(dir string, args []string, paths ...string) (string, error) {
+	diffArgs := append(args[:len(args):len(args)], "--")
+	for _, path := range paths {
+		diffArgs = append(diffArgs, ":(literal)"+path)
+	}
+
+	output, err := g.executor.Diff(dir, diffArgs...)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff files: %w", err)
+	}
+
+	diff, readErr := io.ReadAll(output)
+
+	// Closing waits for git to exit, which reports a failure such as an unknown ref.
+	if err := output.Close(); err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+	if readErr != nil {
+		return "", fmt.Errorf("error reading git diff output: %w", readErr)
+	}
+
+	return string(diff), nil
+}
+
+// TreeEntry is a file in the tree of a Git commit.
+type TreeEntry struct {
+	// Mode is the file mode, such as "100644" for a regular file or "120000" for a
+	// symbolic link.
+	Mode string
 
-	return filePaths, nil
+	// Type is the object type: "blob" for files, or "commit" for submodules.
+	Type string
+
+	// Object is the name of the object holding the file's content.
+	Object string
+
+	// Path is the path of the file relative to the root of the repository.
+	Path string
+}
+
+// ListTree returns every file in the tree of ref in the repository at repoDir, with paths
+// relative to the repository root.
+func (g *Git) ListTree(repoDir, ref string) ([]TreeEntry, error) {
+	output, err := g.executor.ListTree(repoDir, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tree: %w", err)
+	}
+
+	var entries []TreeEntry
+	var parseErr error
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(scanNul)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// Each entry is "<mode> SP <type> SP <object> TAB <path>".
+		info, path, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			parseErr = fmt.Errorf("unexpected git ls-tree entry %q", line)
+			break
+		}
+
+		entries = append(entries, TreeEntry{Mode: fields[0], Type: fields[1], Object: fields[2], Path: path})
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil && parseErr == nil {
+		parseErr = fmt.Errorf("error reading git ls-tree output: %w", scanErr)
+	}
+
+	// Closing waits for git to exit, which reports a failure such as an unknown ref.
+	if err := output.Close(); err != nil && parseErr == nil {
+		return nil, fmt.Errorf("git ls-tree failed: %w", err)
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	return entries, nil
+}
+
+// ReadBlobs reads the content of the given objects from the repository at repoDir with a
+// single `git cat-file --batch` process, and calls fn with the index and content of each
+// object in order. Reading stops at the first error returned by fn.
+func (g *Git) ReadBlobs(repoDir string, objects []string, fn func(i int, content []byte) error) error {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	output, err := g.executor.CatFileBatch(repoDir, strings.NewReader(strings.Join(objects, "\n")+"\n"))
+	if err != nil {
+		return fmt.Errorf("failed to read objects: %w", err)
+	}
+
+	readErr := readBatch(bufio.NewReader(output), objects, fn)
+
+	// Stopping early leaves output unread, so git may fail to write it and exit with an
+	// error that is of no interest.
+	if err := output.Close(); err != nil && readErr == nil {
+		return fmt.Errorf("git cat-file failed: %w", err)
+	}
+
+	return readErr
+}
+
+// readBatch parses the output of `git cat-file --batch` for the given objects, calling fn
+// with the content of each one.
+func readBatch(reader *bufio.Reader, objects []string, fn func(i int, content []byte) error) error {
+	for i, object := range objects {
+		// Each object starts with a "<object> <type> <size>" header line, or
+		// "<object> missing" if it does not exist.
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error reading git cat-file output for %s: %w", object, err)
+		}
+
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("git object %s could not be read: %s", object, strings.TrimSpace(header))
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("unexpected git cat-file header %q", strings.TrimSpace(header))
+		}
+
+		// The content is followed by a newline.
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return fmt.Errorf("error reading git object %s: %w", object, err)
+		}
+
+		if err := fn(i, content[:size]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanNul is a bufio.SplitFunc that splits input into NUL-terminated tokens.
+func scanNul(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
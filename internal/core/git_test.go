@@ -1,11 +1,15 @@
 package core
 
 import (
+	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestFindRepositoryRoot(t *testing.T) {
@@ -93,15 +97,71 @@ func TestFindRepositoryRoot(t *testing.T) {
 
 // MockGitExecutor is a mock implementation of GitExecutor for testing purposes.
 type MockGitExecutor struct {
-	MockListFileChanges func(repoDir string) (io.ReadCloser, error)
+	MockListFiles       func(dir string) (io.ReadCloser, error)
+	MockGetConfig       func(repoDir, key string) (string, error)
+	MockDiffNameStatus  func(dir string, args ...string) (io.ReadCloser, error)
+	MockDiff            func(dir string, args ...string) (io.ReadCloser, error)
+	MockListFileHistory func(repoDir, ref string) (io.ReadCloser, error)
+	MockParseDate       func(repoDir, date string) (string, error)
+	MockListTree        func(repoDir, ref string) (io.ReadCloser, error)
+	MockCatFileBatch    func(repoDir string, objects io.Reader) (io.ReadCloser, error)
 	MockIsAvailable     func() bool
 }
 
-func (m *MockGitExecutor) ListFileChanges(repoDir string) (io.ReadCloser, error) {
-	if m.MockListFileChanges != nil {
-		return m.MockListFileChanges(repoDir)
+func (m *MockGitExecutor) ListFiles(dir string) (io.ReadCloser, error) {
+	if m.MockListFiles != nil {
+		return m.MockListFiles(dir)
 	}
-	return io.NopCloser(strings.NewReader("")), nil // Default to no changes
+	return io.NopCloser(strings.NewReader("")), nil // Default to no files
+}
+
+func (m *MockGitExecutor) DiffNameStatus(dir string, args ...string) (io.ReadCloser, error) {
+	if m.MockDiffNameStatus != nil {
+		return m.MockDiffNameStatus(dir, args...)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *MockGitExecutor) Diff(dir string, args ...string) (io.ReadCloser, error) {
+	if m.MockDiff != nil {
+		return m.MockDiff(dir, args...)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *MockGitExecutor) ListFileHistory(repoDir, ref string) (io.ReadCloser, error) {
+	if m.MockListFileHistory != nil {
+		return m.MockListFileHistory(repoDir, ref)
+	}
+	return io.NopCloser(strings.NewReader("")), nil // Default to no history
+}
+
+func (m *MockGitExecutor) ListTree(repoDir, ref string) (io.ReadCloser, error) {
+	if m.MockListTree != nil {
+		return m.MockListTree(repoDir, ref)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *MockGitExecutor) CatFileBatch(repoDir string, objects io.Reader) (io.ReadCloser, error) {
+	if m.MockCatFileBatch != nil {
+		return m.MockCatFileBatch(repoDir, objects)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *MockGitExecutor) ParseDate(repoDir, date string) (string, error) {
+	if m.MockParseDate != nil {
+		return m.MockParseDate(repoDir, date)
+	}
+	return "--max-age=0", nil // Default to the epoch
+}
+
+func (m *MockGitExecutor) GetConfig(repoDir, key string) (string, error) {
+	if m.MockGetConfig != nil {
+		return m.MockGetConfig(repoDir, key)
+	}
+	return "", nil // Default to unset
 }
 
 func (m *MockGitExecutor) IsAvailable() bool {
@@ -111,175 +171,321 @@ func (m *MockGitExecutor) IsAvailable() bool {
 	return true // Default to git available
 }
 
-func TestGetCommitCounts(t *testing.T) {
+func TestGetFileHistory(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Unix(1000*86400, 0)
+	daysAgo := func(days int) time.Time {
+		return now.Add(-time.Duration(days) * day)
+	}
+	commit := func(days int) string {
+		return fmt.Sprintf("\x00\x01%d\n", daysAgo(days).Unix())
+	}
+
 	tests := []struct {
-		name              string
-		listChangesOutput string
-		listChangesError  error
-		expectedCounts    map[string]int
-		expectError       bool
+		name             string
+		output           string
+		listError        error
+		halfLife         time.Duration
+		churnSince       time.Time
+		expectedCounts   map[string]int
+		expectedModified map[string]time.Time
+		expectedChurn    map[string]float64
+		expectError      bool
 	}{
 		{
-			name:              "No changes",
-			listChangesOutput: "",
-			expectedCounts:    map[string]int{},
+			name:             "No history",
+			output:           "",
+			expectedCounts:   map[string]int{},
+			expectedModified: map[string]time.Time{},
+			expectedChurn:    map[string]float64{},
 		},
 		{
-			name:              "Single file, single commit",
-			listChangesOutput: "file1.go\n",
-			expectedCounts:    map[string]int{"file1.go": 1},
+			name:             "No decay counts every commit",
+			output:           commit(0) + "M\x00a.go\x00A\x00b.go\x00" + commit(400) + "A\x00a.go\x00",
+			expectedCounts:   map[string]int{"a.go": 2, "b.go": 1},
+			expectedModified: map[string]time.Time{"a.go": daysAgo(0), "b.go": daysAgo(0)},
+			expectedChurn:    map[string]float64{"a.go": 2, "b.go": 1},
 		},
 		{
-			name:              "Single file, multiple commits",
-			listChangesOutput: "file1.go\nfile1.go\nfile1.go\n",
-			expectedCounts:    map[string]int{"file1.go": 3},
+			name:             "Commits weigh half as much every half-life",
+			output:           commit(0) + "M\x00a.go\x00" + commit(10) + "M\x00a.go\x00M\x00b.go\x00" + commit(20) + "A\x00b.go\x00",
+			halfLife:         10 * day,
+			expectedCounts:   map[string]int{"a.go": 2, "b.go": 2},
+			expectedModified: map[string]time.Time{"a.go": daysAgo(0), "b.go": daysAgo(10)},
+			expectedChurn:    map[string]float64{"a.go": 1.5, "b.go": 0.75},
 		},
 		{
-			name:              "Multiple files, single commit each",
-			listChangesOutput: "file1.go\nfile2.go\nfile3.go\n",
-			expectedCounts:    map[string]int{"file1.go": 1, "file2.go": 1, "file3.go": 1},
+			name:             "Churn counts only commits since the window started",
+			output:           commit(0) + "M\x00a.go\x00" + commit(10) + "M\x00a.go\x00M\x00b.go\x00" + commit(20) + "A\x00a.go\x00A\x00b.go\x00",
+			churnSince:       daysAgo(10),
+			expectedCounts:   map[string]int{"a.go": 3, "b.go": 2},
+			expectedModified: map[string]time.Time{"a.go": daysAgo(0), "b.go": daysAgo(10)},
+			expectedChurn:    map[string]float64{"a.go": 2, "b.go": 1},
 		},
 		{
-			name: "Multiple files, multiple commits",
-			listChangesOutput: `file1.go
-file2.go
-file1.go
-file3.go
-file2.go
-`,
-			expectedCounts: map[string]int{"file1.go": 2, "file2.go": 2, "file3.go": 1},
+			name:             "Renames credit older commits to the current path",
+			output:           commit(0) + "M\x00new.go\x00" + commit(1) + "R100\x00old.go\x00new.go\x00" + commit(2) + "M\x00old.go\x00" + commit(3) + "A\x00old.go\x00",
+			expectedCounts:   map[string]int{"new.go": 4},
+			expectedModified: map[string]time.Time{"new.go": daysAgo(0)},
+			expectedChurn:    map[string]float64{"new.go": 4},
 		},
 		{
-			name:              "Empty lines in output",
-			listChangesOutput: "\nfile1.go\n\nfile2.go\n\n",
-			expectedCounts:    map[string]int{"file1.go": 1, "file2.go": 1},
+			name:             "Chained renames",
+			output:           commit(0) + "R090\x00b.go\x00c.go\x00" + commit(1) + "R100\x00a.go\x00b.go\x00" + commit(2) + "A\x00a.go\x00",
+			expectedCounts:   map[string]int{"c.go": 3},
+			expectedModified: map[string]time.Time{"c.go": daysAgo(0)},
+			expectedChurn:    map[string]float64{"c.go": 3},
 		},
 		{
-			name:             "Error from ListFileChanges",
-			listChangesError: ErrTest, // Define a test error
-			expectError:      true,
+			name:             "Deleted files lose their older commits",
+			output:           commit(0) + "A\x00a.go\x00" + commit(1) + "D\x00a.go\x00" + commit(2) + "A\x00a.go\x00M\x00b.go\x00",
+			expectedCounts:   map[string]int{"a.go": 1, "b.go": 1},
+			expectedModified: map[string]time.Time{"a.go": daysAgo(0), "b.go": daysAgo(2)},
+			expectedChurn:    map[string]float64{"a.go": 1, "b.go": 1},
+		},
+		{
+			name:             "Copies credit the destination only",
+			output:           commit(0) + "C075\x00a.go\x00b.go\x00" + commit(1) + "A\x00a.go\x00",
+			expectedCounts:   map[string]int{"a.go": 1, "b.go": 1},
+			expectedModified: map[string]time.Time{"a.go": daysAgo(1), "b.go": daysAgo(0)},
+			expectedChurn:    map[string]float64{"a.go": 1, "b.go": 1},
+		},
+		{
+			name:        "Unexpected commit time",
+			output:      "\x01soon\nM\x00a.go\x00",
+			expectError: true,
+		},
+		{
+			name:        "Error from ListFileHistory",
+			listError:   ErrTest,
+			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockExecutor := &MockGitExecutor{
-				MockListFileChanges: func(repoDir string) (io.ReadCloser, error) {
-					if tt.listChangesError != nil {
-						return nil, tt.listChangesError
+				MockListFileHistory: func(repoDir, ref string) (io.ReadCloser, error) {
+					if ref != "v1.0" {
+						t.Errorf("Ref mismatch: got %q, want %q", ref, "v1.0")
+					}
+					if tt.listError != nil {
+						return nil, tt.listError
 					}
-					return io.NopCloser(strings.NewReader(tt.listChangesOutput)), nil
+					return io.NopCloser(strings.NewReader(tt.output)), nil
 				},
 			}
-			git := NewGit(mockExecutor)
 
-			counts, err := git.GetCommitCounts("dummyRepoDir")
+			history, err := NewGit(mockExecutor).GetFileHistory("dummyRepoDir", "v1.0", tt.churnSince, tt.halfLife, now)
 
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error, but got nil")
 				}
-				return // Stop here for error cases
+				return
 			}
 
 			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
 
-			if len(counts) != len(tt.expectedCounts) {
-				t.Errorf("Counts map length mismatch: got %v, want %v", len(counts), len(tt.expectedCounts))
+			if !reflect.DeepEqual(history.CommitCounts, tt.expectedCounts) {
+				t.Errorf("Commit counts mismatch: got %v, want %v", history.CommitCounts, tt.expectedCounts)
 			}
-
-			for file, expectedCount := range tt.expectedCounts {
-				actualCount, ok := counts[file]
-				if !ok {
-					t.Errorf("Missing file in counts: %s", file)
-					continue
-				}
-				if actualCount != expectedCount {
-					t.Errorf("Count mismatch for file %s: got %d, want %d", file, actualCount, expectedCount)
+			if !reflect.DeepEqual(history.LastModified, tt.expectedModified) {
+				t.Errorf("Last modified mismatch: got %v, want %v", history.LastModified, tt.expectedModified)
+			}
+			if len(history.Churn) != len(tt.expectedChurn) {
+				t.Errorf("Churn map length mismatch: got %v, want %v", history.Churn, tt.expectedChurn)
+			}
+			for file, expected := range tt.expectedChurn {
+				if got := history.Churn[file]; math.Abs(got-expected) > 1e-9 {
+					t.Errorf("Churn mismatch for file %s: got %v, want %v", file, got, expected)
 				}
 			}
 		})
 	}
 }
 
-func TestSortFilesByCommitCounts(t *testing.T) {
+func TestGetFileHistoryCommitCounts(t *testing.T) {
+	commit := func(seconds int) string {
+		return fmt.Sprintf("\x00\x01%d\n", seconds)
+	}
+
 	tests := []struct {
-		name          string
-		filePaths     []string
-		commitCounts  map[string]int
-		expectedOrder []string
-		expectError   bool // While sorting itself unlikely to error, including for completeness
+		name           string
+		output         string
+		expectedCounts map[string]int
 	}{
 		{
-			name:          "Empty file list",
-			filePaths:     []string{},
-			commitCounts:  map[string]int{},
-			expectedOrder: []string{},
+			name:           "No changes",
+			output:         "",
+			expectedCounts: map[string]int{},
 		},
 		{
-			name:          "Single file",
-			filePaths:     []string{"file1.go"},
-			commitCounts:  map[string]int{"file1.go": 1},
-			expectedOrder: []string{"file1.go"},
+			name:           "Single file, single commit",
+			output:         commit(100) + "A\x00file1.go\x00",
+			expectedCounts: map[string]int{"file1.go": 1},
 		},
 		{
-			name:          "Already sorted by commits",
-			filePaths:     []string{"file1.go", "file2.go", "file3.go"},
-			commitCounts:  map[string]int{"file1.go": 1, "file2.go": 2, "file3.go": 3},
-			expectedOrder: []string{"file1.go", "file2.go", "file3.go"},
+			name:           "Single file, multiple commits",
+			output:         commit(300) + "M\x00file1.go\x00" + commit(200) + "M\x00file1.go\x00" + commit(100) + "A\x00file1.go\x00",
+			expectedCounts: map[string]int{"file1.go": 3},
+		},
+		{
+			name:           "Multiple files, single commit",
+			output:         commit(100) + "A\x00file1.go\x00A\x00file2.go\x00A\x00file3.go\x00",
+			expectedCounts: map[string]int{"file1.go": 1, "file2.go": 1, "file3.go": 1},
+		},
+		{
+			name: "Multiple files, multiple commits",
+			output: commit(300) + "M\x00file1.go\x00M\x00file2.go\x00" + commit(200) + "M\x00file1.go\x00A\x00file3.go\x00" +
+				commit(100) + "A\x00file2.go\x00",
+			expectedCounts: map[string]int{"file1.go": 2, "file2.go": 2, "file3.go": 1},
+		},
+		{
+			name:           "Paths with spaces and newlines",
+			output:         commit(200) + "M\x00my file.go\x00" + commit(100) + "A\x00my file.go\x00A\x00odd\nname.go\x00",
+			expectedCounts: map[string]int{"my file.go": 2, "odd\nname.go": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := &MockGitExecutor{
+				MockListFileHistory: func(repoDir, ref string) (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader(tt.output)), nil
+				},
+			}
+
+			history, err := NewGit(mockExecutor).GetFileHistory("dummyRepoDir", "", time.Time{}, 0, time.Unix(1000, 0))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(history.CommitCounts, tt.expectedCounts) {
+				t.Errorf("Commit counts mismatch: got %v, want %v", history.CommitCounts, tt.expectedCounts)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		expected    time.Time
+		expectError bool
+	}{
+		{name: "Maximum age", output: "--max-age=1704067200", expected: time.Unix(1704067200, 0)},
+		{name: "Unexpected output", output: "1704067200", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := &MockGitExecutor{
+				MockParseDate: func(repoDir, date string) (string, error) {
+					return tt.output, nil
+				},
+			}
+
+			got, err := NewGit(mockExecutor).ParseDate("dummyRepoDir", "2024-01-01")
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("Date mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	tests := []struct {
+		name            string
+		diffOutput      string
+		diffError       error
+		expectedChanges []FileChange
+		expectError     bool
+	}{
+		{
+			name:       "No changes",
+			diffOutput: "",
 		},
 		{
-			name:          "Reverse sorted by commits",
-			filePaths:     []string{"file3.go", "file2.go", "file1.go"},
-			commitCounts:  map[string]int{"file1.go": 1, "file2.go": 2, "file3.go": 3},
-			expectedOrder: []string{"file1.go", "file2.go", "file3.go"},
+			name:       "Added, modified and deleted files",
+			diffOutput: "A\x00new.go\x00M\x00main.go\x00D\x00old.go\x00",
+			expectedChanges: []FileChange{
+				{Status: "added", Path: "new.go"},
+				{Status: "modified", Path: "main.go"},
+				{Status: "deleted", Path: "old.go"},
+			},
 		},
 		{
-			name:          "Mixed commit counts",
-			filePaths:     []string{"file3.go", "file1.go", "file2.go"},
-			commitCounts:  map[string]int{"file1.go": 2, "file2.go": 1, "file3.go": 3},
-			expectedOrder: []string{"file2.go", "file1.go", "file3.go"},
+			name:       "Renamed and copied files",
+			diffOutput: "R087\x00a.go\x00dir/b.go\x00C100\x00c.go\x00d.go\x00T\x00link\x00",
+			expectedChanges: []FileChange{
+				{Status: "renamed", Path: "dir/b.go", OldPath: "a.go"},
+				{Status: "copied", Path: "d.go", OldPath: "c.go"},
+				{Status: "type changed", Path: "link"},
+			},
 		},
 		{
-			name:          "Same commit counts, sorted alphabetically",
-			filePaths:     []string{"file3.go", "file1.go", "file2.go"},
-			commitCounts:  map[string]int{"file1.go": 1, "file2.go": 1, "file3.go": 1},
-			expectedOrder: []string{"file1.go", "file2.go", "file3.go"},
+			name:        "Unknown status",
+			diffOutput:  "X\x00file.go\x00",
+			expectError: true,
 		},
 		{
-			name:          "Mixed commit counts and same counts, alphabetical tie-breaker",
-			filePaths:     []string{"fileC.go", "fileA.go", "fileB.go", "fileD.go"},
-			commitCounts:  map[string]int{"fileA.go": 2, "fileB.go": 1, "fileC.go": 2, "fileD.go": 1},
-			expectedOrder: []string{"fileB.go", "fileD.go", "fileA.go", "fileC.go"}, // B and D (count 1, then alpha), A and C (count 2, then alpha)
+			name:        "Truncated rename",
+			diffOutput:  "R100\x00a.go\x00",
+			expectError: true,
 		},
 		{
-			name:          "File with no commit count (treated as 0 commits)",
-			filePaths:     []string{"file2.go", "file1.go", "file3.go"},
-			commitCounts:  map[string]int{"file1.go": 1, "file2.go": 2}, // file3.go has no count
-			expectedOrder: []string{"file3.go", "file1.go", "file2.go"}, // file3.go (0), file1.go (1), file2.go (2)
+			name:        "Error from DiffNameStatus",
+			diffError:   ErrTest,
+			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockCommitCounter := func(repoDir string) (map[string]int, error) {
-				return tt.commitCounts, nil
+			mockExecutor := &MockGitExecutor{
+				MockDiffNameStatus: func(dir string, args ...string) (io.ReadCloser, error) {
+					if tt.diffError != nil {
+						return nil, tt.diffError
+					}
+					return io.NopCloser(strings.NewReader(tt.diffOutput)), nil
+				},
 			}
+			git := NewGit(mockExecutor)
 
-			git := NewGit(&MockGitExecutor{}) // Executor not used for this test
-			sortedFiles, err := git.SortFilesByCommitCounts("dummyRepoDir", tt.filePaths, mockCommitCounter)
+			changes, err := git.ChangedFiles("dummyDir", "HEAD")
 
-			if tt.expectError && err == nil {
-				t.Fatalf("Expected error but got nil")
-			} else if !tt.expectError && err != nil {
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+
+			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
 
-			if !tt.expectError {
-				if !slicesAreEqual(sortedFiles, tt.expectedOrder) {
-					t.Errorf("Sorted file order mismatch: got %v, want %v", sortedFiles, tt.expectedOrder)
+			if len(changes) != len(tt.expectedChanges) {
+				t.Fatalf("Changes length mismatch: got %v, want %v", changes, tt.expectedChanges)
+			}
+
+			for i, expected := range tt.expectedChanges {
+				if changes[i] != expected {
+					t.Errorf("Change %d mismatch: got %+v, want %+v", i, changes[i], expected)
 				}
 			}
 		})
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GitWalker is an implementation of Walker that takes its file list from git rather than
+// the filesystem, returning the files in targetDir that are tracked, or untracked but not
+// ignored, as reported by `git ls-files`. Git ignore rules are therefore applied by git
+// itself. The .grimoireignore files, the extension, name, shebang, regex, include and
+// exclude filters, binary detection and the output file exclusion are applied on top,
+// as for DefaultWalker.
+type GitWalker struct {
+	*fileFilter
+
+	// targetDir is the directory whose files are listed.
+	targetDir string
+
+	// repoDir is the root of the Git repository containing targetDir.
+	repoDir string
+
+	// git is used to list the files known to git.
+	git *Git
+
+	// dirIgnores caches the .grimoireignore rules of each directory, keyed by path.
+	dirIgnores map[string]*ignoreRules
+}
+
+// NewGitWalker constructs and returns a new GitWalker that lists the files in targetDir
+// using git and filters them with the given options.
+func NewGitWalker(targetDir string, git *Git, opts WalkerOptions) *GitWalker {
+	return &GitWalker{
+		fileFilter: newFileFilter(opts, dirSource(targetDir)),
+		targetDir:  targetDir,
+		repoDir:    opts.RepoDir,
+		git:        git,
+		dirIgnores: make(map[string]*ignoreRules),
+	}
+}
+
+// Walk lists the files in targetDir known to git and returns the sorted paths (relative
+// to targetDir) of those that meet the filtering criteria. Files that are listed in the
+// index but missing from the working tree, and submodules, are skipped.
+func (gw *GitWalker) Walk() ([]string, error) {
+	listed, err := gw.git.ListFiles(gw.targetDir)
+	if err != nil {
+		return nil, fmt.Errorf("git file listing failed: %w", err)
+	}
+
+	// Collect the .grimoireignore rules of the directories above targetDir.
+	var inheritedIgnores []*ignoreRules
+	if gw.repoDir != "" && gw.targetDir != gw.repoDir {
+		for dir := filepath.Dir(gw.targetDir); ; dir = filepath.Dir(dir) {
+			if r := gw.loadIgnores(dir); r != nil {
+				inheritedIgnores = append([]*ignoreRules{r}, inheritedIgnores...)
+			}
+			if dir == gw.repoDir || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	var files []string
+	for _, relPath := range listed {
+		fullPath := filepath.Join(gw.targetDir, filepath.FromSlash(relPath))
+
+		if gw.skipPath(fullPath, relPath) {
+			continue
+		}
+
+		if gw.isIgnored(inheritedIgnores, relPath) {
+			continue
+		}
+
+		if gw.excludes != nil && gw.excludes.MatchesPath(relPath) {
+			continue
+		}
+
+		// Skip deleted files and submodules, which are listed as directories.
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		if gw.includeFile(relPath, path.Base(relPath)) {
+			files = append(files, relPath)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Source returns a FileSource that reads files from targetDir.
+func (gw *GitWalker) Source() FileSource {
+	return dirSource(gw.targetDir)
+}
+
+// isIgnored reports whether the file at relPath, or any of the directories leading to it,
+// is ignored by the .grimoireignore files of targetDir and its subdirectories, on top of
+// the inherited rules. As in a filesystem walk, the contents of an ignored directory
+// cannot be re-included.
+func (gw *GitWalker) isIgnored(inheritedIgnores []*ignoreRules, relPath string) bool {
+	rules := append([]*ignoreRules{}, inheritedIgnores...)
+
+	dir := gw.targetDir
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		if r := gw.loadIgnores(dir); r != nil {
+			rules = append(rules, r)
+		}
+
+		dir = filepath.Join(dir, part)
+		if isIgnored(rules, dir, i < len(parts)-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadIgnores returns the rules of the .grimoireignore file in dir, or nil if there is none.
+func (gw *GitWalker) loadIgnores(dir string) *ignoreRules {
+	r, ok := gw.dirIgnores[dir]
+	if !ok {
+		r = loadIgnoreRules(filepath.Join(dir, grimoireIgnoreFilename), dir)
+		gw.dirIgnores[dir] = r
+	}
+	return r
+}
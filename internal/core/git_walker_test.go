@@ -0,0 +1,78 @@
+package core
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGitWalker(t *testing.T) {
+	targetDir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":                  "package main",
+		"README.md":                "readme",
+		"vendor/lib/lib.go":        "package lib",
+		"internal/a_test.go":       "package internal",
+		"internal/a.go":            "package internal",
+		"image.png":                "\x89PNG\r\n\x1a\n",
+		"output.md":                "previous output",
+		"internal/.grimoireignore": "gen/\n",
+		"internal/gen/gen.go":      "package gen",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(targetDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(targetDir, "submodule"), 0755); err != nil {
+		t.Fatalf("Failed to create submodule dir: %v", err)
+	}
+
+	// The listing includes a conflicted file twice, a deleted file and a submodule.
+	listing := []string{
+		"main.go", "main.go", "README.md", "deleted.go", "submodule",
+		"vendor/lib/lib.go", "internal/a_test.go", "internal/gen/gen.go", "internal/a.go", "image.png", "output.md",
+	}
+
+	mockExecutor := &MockGitExecutor{
+		MockListFiles: func(dir string) (io.ReadCloser, error) {
+			if dir != targetDir {
+				t.Errorf("ListFiles called with %s, want %s", dir, targetDir)
+			}
+			return io.NopCloser(strings.NewReader(strings.Join(listing, "\x00") + "\x00")), nil
+		},
+	}
+
+	walker := NewGitWalker(targetDir, NewGit(mockExecutor), WalkerOptions{
+		AllowedFileExtensions: map[string]bool{".go": true, ".md": true, ".png": true},
+		IgnoredPathRegexes:    []*regexp.Regexp{regexp.MustCompile(`(^|/)vendor/`)},
+		ExcludePatterns:       []string{"**/*_test.go"},
+		OutputFile:            filepath.Join(targetDir, "output.md"),
+	})
+
+	got, err := walker.Walk()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"README.md", "internal/a.go", "main.go"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Files mismatch: got %v, want %v", got, expected)
+	}
+
+	// A failing listing is reported as an error so the caller can fall back.
+	mockExecutor.MockListFiles = func(dir string) (io.ReadCloser, error) {
+		return nil, ErrTest
+	}
+	if _, err := walker.Walk(); err == nil {
+		t.Errorf("Expected error, but got nil")
+	}
+}
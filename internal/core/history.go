@@ -0,0 +1,92 @@
+package core
+
+import (
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// gitHistory provides statistics of the Git history of the files of a run, read from git
+// in a single pass on first use and kept for later uses. The history is read from the Git
+// ref of the run if there is one. Files are keyed by path relative to the repository root.
+type gitHistory struct {
+	cfg *config.Config
+	git *Git
+
+	// repoDir is the root of the Git repository containing the target directory, or empty
+	// if there is none.
+	repoDir string
+
+	// files holds the statistics of each file, or is nil if they have not been loaded.
+	files *FileHistory
+}
+
+// newGitHistory returns a gitHistory of the repository at repoDir, which may be empty if
+// there is none.
+func newGitHistory(cfg *config.Config, git *Git, repoDir string) *gitHistory {
+	return &gitHistory{cfg: cfg, git: git, repoDir: repoDir}
+}
+
+// unavailable returns the reason why the history cannot be read, or an empty string if it
+// can be.
+func (h *gitHistory) unavailable() string {
+	if !h.git.IsAvailable() {
+		return "git executable not found"
+	}
+	if h.repoDir == "" {
+		return "Git repository not found"
+	}
+	return ""
+}
+
+// prefix returns the path of the target directory relative to the repository root, which
+// prefixes the paths of its files in the history.
+func (h *gitHistory) prefix() string {
+	return repoPrefix(h.repoDir, h.cfg.TargetDir)
+}
+
+// key returns the key in the history of a file, given its path relative to the target
+// directory.
+func (h *gitHistory) key(relPath string) string {
+	return path.Join(h.prefix(), filepath.ToSlash(relPath))
+}
+
+// load returns the statistics of each file, with the churn half-life and window of the
+// configuration.
+func (h *gitHistory) load() (*FileHistory, error) {
+	if h.files == nil {
+		var churnSince time.Time
+		if h.cfg.ChurnSince != "" {
+			since, err := h.git.ParseDate(h.repoDir, h.cfg.ChurnSince)
+			if err != nil {
+				return nil, err
+			}
+			churnSince = since
+		}
+
+		files, err := h.git.GetFileHistory(h.repoDir, h.cfg.Ref, churnSince, h.cfg.ChurnHalfLife, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		h.files = files
+	}
+	return h.files, nil
+}
+
+// loadIfAvailable returns the statistics of each file, or nil if the history is unavailable
+// or cannot be read, which is logged as a warning mentioning purpose.
+func (h *gitHistory) loadIfAvailable(purpose string) *FileHistory {
+	if h.unavailable() != "" {
+		return nil
+	}
+
+	files, err := h.load()
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to read the Git history for %s", purpose)
+		return nil
+	}
+	return files
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+)
+
+func TestGitHistoryLoad(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+
+	var listed int
+	mockExecutor := &MockGitExecutor{
+		MockListFileHistory: func(repoDir, ref string) (io.ReadCloser, error) {
+			listed++
+			if ref != "v1.0" {
+				t.Errorf("Ref mismatch: got %q, want %q", ref, "v1.0")
+			}
+			output := fmt.Sprintf("\x01%d\nM\x00pkg/a.go\x00\x00\x01%d\nA\x00pkg/a.go\x00A\x00pkg/b.go\x00",
+				time.Now().Unix(), since.Add(-time.Hour).Unix())
+			return io.NopCloser(strings.NewReader(output)), nil
+		},
+		MockParseDate: func(repoDir, date string) (string, error) {
+			if date != "1.hour" {
+				t.Errorf("Date mismatch: got %q, want %q", date, "1.hour")
+			}
+			return fmt.Sprintf("--max-age=%d", since.Unix()), nil
+		},
+	}
+
+	repoDir := t.TempDir()
+	cfg := &config.Config{TargetDir: repoDir, Ref: "v1.0", ChurnSince: "1.hour"}
+	history := newGitHistory(cfg, NewGit(mockExecutor), repoDir)
+
+	for range 2 {
+		files, err := history.load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if files.CommitCounts["pkg/a.go"] != 2 || files.CommitCounts["pkg/b.go"] != 1 {
+			t.Errorf("Commit counts mismatch: got %v", files.CommitCounts)
+		}
+		if files.Churn["pkg/a.go"] != 1 || files.Churn["pkg/b.go"] != 0 {
+			t.Errorf("Expected churn to count only commits since the window started, got %v", files.Churn)
+		}
+	}
+
+	if listed != 1 {
+		t.Errorf("Expected the history to be read once, got %d times", listed)
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// grimoireIgnoreFilename is the name of Grimoire's own per-directory ignore file.
+const grimoireIgnoreFilename = ".grimoireignore"
+
+// ignoreFilenames lists the per-directory ignore files honored by the walker.
+var ignoreFilenames = []string{".gitignore", grimoireIgnoreFilename}
+
+// ignoreRules holds the compiled patterns of a single ignore file, together with the
+// directory its patterns are anchored to.
+type ignoreRules struct {
+	// baseDir is the directory that patterns are matched relative to.
+	baseDir string
+
+	// patterns holds the compiled patterns of the file.
+	patterns *gitignore.GitIgnore
+
+	// negations holds the same patterns preceded by a catch-all pattern. A path that does
+	// not match it was explicitly re-included by a negated ("!") pattern.
+	negations *gitignore.GitIgnore
+}
+
+// loadIgnoreRules compiles the ignore file at path, anchoring its patterns to baseDir.
+// It returns nil if the file does not exist or cannot be parsed.
+func loadIgnoreRules(path, baseDir string) *ignoreRules {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Error parsing ignore file at %s", path)
+		return nil
+	}
+
+	return compileIgnoreRules(content, baseDir)
+}
+
+// compileIgnoreRules compiles the content of an ignore file, anchoring its patterns to baseDir.
+func compileIgnoreRules(content []byte, baseDir string) *ignoreRules {
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	return &ignoreRules{
+		baseDir:   baseDir,
+		patterns:  gitignore.CompileIgnoreLines(lines...),
+		negations: gitignore.CompileIgnoreLines(append([]string{"*"}, lines...)...),
+	}
+}
+
+// match reports whether the rules decide anything about the path at fullPath, and if
+// so, whether the path is ignored. A negated pattern that re-includes the path counts
+// as a decision, so that it can override rules from lower-precedence files.
+func (r *ignoreRules) match(fullPath string, isDir bool) (decided bool, ignored bool) {
+	relPath, err := filepath.Rel(r.baseDir, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return false, false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	if isDir {
+		// A trailing slash lets directory-only patterns such as "build/" match.
+		relPath += "/"
+	}
+
+	if r.patterns.MatchesPath(relPath) {
+		return true, true
+	}
+	if !r.negations.MatchesPath(relPath) {
+		return true, false
+	}
+	return false, false
+}
+
+// isIgnored applies a list of ignore rules ordered from lowest to highest precedence,
+// as git does: the last rules that decide about a path win.
+func isIgnored(rules []*ignoreRules, fullPath string, isDir bool) bool {
+	ignored := false
+	for _, r := range rules {
+		if decided, ignore := r.match(fullPath, isDir); decided {
+			ignored = ignore
+		}
+	}
+	return ignored
+}
+
+// loadDirectoryIgnoreRules loads the per-directory ignore files found in dir.
+func loadDirectoryIgnoreRules(dir string) []*ignoreRules {
+	var rules []*ignoreRules
+	for _, ignoreFilename := range ignoreFilenames {
+		if r := loadIgnoreRules(filepath.Join(dir, ignoreFilename), dir); r != nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// loadExcludeRules returns the ignore rules of the global excludes file and the repository's
+// .git/info/exclude, in that order of precedence, anchored to repoDir.
+func loadExcludeRules(repoDir, globalExcludesFile string) []*ignoreRules {
+	var rules []*ignoreRules
+
+	if globalExcludesFile != "" {
+		if r := loadIgnoreRules(globalExcludesFile, repoDir); r != nil {
+			rules = append(rules, r)
+		}
+	}
+
+	if r := loadIgnoreRules(filepath.Join(repoDir, ".git", "info", "exclude"), repoDir); r != nil {
+		rules = append(rules, r)
+	}
+
+	return rules
+}
+
+// loadRepositoryIgnoreRules returns the ignore rules that apply to targetDir from outside
+// of it, ordered from lowest to highest precedence: the global excludes file, the
+// repository's .git/info/exclude, and the ignore files of every directory from the
+// repository root down to the parent of targetDir. It returns nil if repoDir is empty.
+func loadRepositoryIgnoreRules(repoDir, targetDir, globalExcludesFile string) []*ignoreRules {
+	if repoDir == "" {
+		return nil
+	}
+
+	rules := loadExcludeRules(repoDir, globalExcludesFile)
+
+	// Collect the directories between the repository root and targetDir (exclusive).
+	var parents []string
+	if targetDir != repoDir {
+		for dir := filepath.Dir(targetDir); ; dir = filepath.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+			if dir == repoDir || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	for _, dir := range parents {
+		rules = append(rules, loadDirectoryIgnoreRules(dir)...)
+	}
+
+	return rules
+}
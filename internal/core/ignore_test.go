@@ -0,0 +1,64 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkerIgnoreSemantics(t *testing.T) {
+	repoDir := t.TempDir()
+	targetDir := filepath.Join(repoDir, "svc")
+
+	files := map[string]string{
+		".gitignore":           "secret.go\n",
+		".git/info/exclude":    "excluded.go\n",
+		"global-ignore":        "global.go\n",
+		"svc/.gitignore":       "/gen\n*.md\n!keep.md\n",
+		"svc/gen/a.go":         "package gen",
+		"svc/sub/gen/b.go":     "package gen",
+		"svc/notes.md":         "notes",
+		"svc/keep.md":          "keep",
+		"svc/docs/keep.md":     "keep",
+		"svc/secret.go":        "package svc",
+		"svc/excluded.go":      "package svc",
+		"svc/global.go":        "package svc",
+		"svc/main.go":          "package main",
+		"svc/sub/.gitignore":   "!secret.go\n",
+		"svc/sub/secret.go":    "package sub",
+		"svc/sub/excluded.go":  "package sub",
+		"svc/sub/gen/.keep.go": "package gen",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(repoDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	walker := NewDefaultWalker(targetDir, WalkerOptions{
+		AllowedFileExtensions: map[string]bool{".go": true, ".md": true},
+		RepoDir:               repoDir,
+		GlobalExcludesFile:    filepath.Join(repoDir, "global-ignore"),
+	})
+
+	got, err := walker.Walk()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"docs/keep.md",
+		"keep.md",
+		"main.go",
+		"sub/gen/.keep.go",
+		"sub/gen/b.go",
+		"sub/secret.go",
+	}
+	if !slicesAreEqual(got, expected) {
+		t.Errorf("Walked files mismatch: got %v, want %v", got, expected)
+	}
+}
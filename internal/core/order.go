@@ -0,0 +1,273 @@
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/rs/zerolog/log"
+)
+
+// overviewDocNames lists the names, without extension and in upper case, of documents that
+// give an overview of a project and come first when ordering by docs.
+var overviewDocNames = map[string]bool{
+	"README": true, "ARCHITECTURE": true, "OVERVIEW": true, "DESIGN": true, "CONTRIBUTING": true,
+}
+
+// docExtensions lists the extensions of documentation files.
+var docExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".mdx": true, ".rst": true, ".adoc": true, ".asciidoc": true,
+	".txt": true, ".org": true,
+}
+
+// docDirs lists the names of directories whose files are documentation.
+var docDirs = map[string]bool{"docs": true, "doc": true, "documentation": true}
+
+// fileComparator compares the files at two indexes, returning a negative number if the
+// first comes before the second, a positive number if it comes after, or zero if the
+// order is left to the next strategy.
+type fileComparator func(a, b int) int
+
+// fileOrder orders the files of a run by the strategies of the configuration.
+type fileOrder struct {
+	cfg *config.Config
+
+	// history provides the Git history of the files.
+	history *gitHistory
+
+	// opts are the options the files are serialized with, which their token counts are
+	// measured with.
+	opts serializer.SerializeOptions
+
+	// files are the files being ordered.
+	files []serializer.SourceFile
+
+	// paths holds the path of each file with forward slashes.
+	paths []string
+}
+
+// orderFiles sorts files by the strategies of cfg.Order, each breaking the ties of the
+// previous ones, reading the Git history of the files from history as needed and counting
+// their tokens after processing them with opts. Files that tie on every strategy keep the
+// order in which they were listed.
+func orderFiles(cfg *config.Config, history *gitHistory, opts serializer.SerializeOptions, files []serializer.SourceFile) ([]serializer.SourceFile, error) {
+	if len(cfg.Order) == 0 {
+		log.Info().Msg("Skipped ordering files: sorting disabled by flag")
+		return files, nil
+	}
+
+	o := &fileOrder{
+		cfg:     cfg,
+		history: history,
+		opts:    opts,
+		files:   files,
+		paths:   make([]string, len(files)),
+	}
+	for i, file := range files {
+		o.paths[i] = filepath.ToSlash(file.Path)
+	}
+
+	var comparators []fileComparator
+	var names []string
+	for _, key := range cfg.Order {
+		compare, err := o.comparator(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to order files by %s: %w", key.Strategy, err)
+		}
+		if compare == nil {
+			continue
+		}
+
+		if key.Descending {
+			ascending := compare
+			compare = func(a, b int) int { return ascending(b, a) }
+		}
+		comparators = append(comparators, compare)
+		names = append(names, key.String())
+	}
+
+	if len(comparators) == 0 {
+		return files, nil
+	}
+
+	log.Info().Msgf("Ordering files by %s", strings.Join(names, ", "))
+
+	indexes := make([]int, len(files))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	slices.SortStableFunc(indexes, func(a, b int) int {
+		for _, compare := range comparators {
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	ordered := make([]serializer.SourceFile, len(files))
+	for i, index := range indexes {
+		ordered[i] = files[index]
+	}
+
+	return ordered, nil
+}
+
+// comparator returns the comparator of the strategy of key in its natural direction, or
+// nil if the strategy cannot be applied and is skipped.
+func (o *fileOrder) comparator(key config.OrderKey) (fileComparator, error) {
+	switch key.Strategy {
+	case "path":
+		return func(a, b int) int { return cmp.Compare(o.paths[a], o.paths[b]) }, nil
+
+	case "commits":
+		if reason := o.history.unavailable(); reason != "" {
+			log.Warn().Msgf("Skipped ordering files by commit frequency: %s", reason)
+			return nil, nil
+		}
+
+		files, err := o.history.load()
+		if err != nil {
+			return nil, err
+		}
+		return compareKeys(o.paths, func(relPath string) int {
+			return files.CommitCounts[o.history.key(relPath)]
+		}), nil
+
+	case "churn":
+		if reason := o.history.unavailable(); reason != "" {
+			log.Warn().Msgf("Skipped ordering files by churn: %s", reason)
+			return nil, nil
+		}
+
+		files, err := o.history.load()
+		if err != nil {
+			return nil, err
+		}
+		return compareKeys(o.paths, func(relPath string) float64 {
+			return files.Churn[o.history.key(relPath)]
+		}), nil
+
+	case "modified":
+		return o.compareModified(key.Variant)
+
+	case "size":
+		return compareKeys(o.files, func(file serializer.SourceFile) int {
+			return len(file.Content)
+		}), nil
+
+	case "tokens":
+		counts := serializer.MeasureTokens(o.files, o.opts)
+		return func(a, b int) int { return cmp.Compare(counts[a], counts[b]) }, nil
+
+	case "docs":
+		return compareKeys(o.paths, docRank), nil
+
+	case "deps":
+		ranks := dependencyRanks(o.files)
+		return func(a, b int) int { return cmp.Compare(ranks[a], ranks[b]) }, nil
+
+	case "priority":
+		priorities := filePriorities(o.paths, nil, nil, "", o.cfg.PriorityPatterns)
+		return func(a, b int) int { return cmp.Compare(priorities[b].weight, priorities[a].weight) }, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported strategy")
+	}
+}
+
+// compareModified returns a comparator of the time each file was last modified. With the
+// mtime variant, this is its modification time in the working tree, so that uncommitted
+// changes count. Otherwise, it is the time of the last commit that touched it if git knows
+// about it, or its modification time in the working tree. Files read from a Git ref that
+// have no commit time sort first.
+func (o *fileOrder) compareModified(variant string) (fileComparator, error) {
+	var lastModified map[string]time.Time
+
+	switch {
+	case variant == "mtime":
+		if o.cfg.Ref != "" {
+			log.Warn().Msg("Skipped ordering files by modification time: files are read from a Git ref")
+			return nil, nil
+		}
+	case o.history.unavailable() == "":
+		files, err := o.history.load()
+		if err != nil {
+			return nil, err
+		}
+		lastModified = files.LastModified
+	default:
+		log.Warn().Msg("Ordering files by modification time instead of commit time: Git repository or executable not found")
+	}
+
+	times := make([]int64, len(o.paths))
+	for i, relPath := range o.paths {
+		if t, ok := lastModified[o.history.key(relPath)]; ok {
+			times[i] = t.Unix()
+		} else if o.cfg.Ref == "" {
+			if info, err := os.Stat(filepath.Join(o.cfg.TargetDir, filepath.FromSlash(relPath))); err == nil {
+				times[i] = info.ModTime().Unix()
+			}
+		}
+	}
+
+	return func(a, b int) int { return cmp.Compare(times[a], times[b]) }, nil
+}
+
+// docRank ranks a file for ordering documentation first: 0 for overview documents such as
+// README and ARCHITECTURE at the top of the target directory, 1 for other documentation,
+// and 2 for everything else.
+func docRank(relPath string) int {
+	name := path.Base(relPath)
+	ext := strings.ToLower(path.Ext(name))
+	isDoc := ext == "" || docExtensions[ext]
+
+	if isDoc && overviewDocNames[strings.ToUpper(strings.TrimSuffix(name, path.Ext(name)))] {
+		if !strings.Contains(relPath, "/") {
+			return 0
+		}
+		return 1
+	}
+
+	if docExtensions[ext] {
+		return 1
+	}
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		if docDirs[strings.ToLower(dir)] {
+			return 1
+		}
+	}
+
+	return 2
+}
+
+// compareKeys returns a comparator of the keys computed once for each of values.
+func compareKeys[T any, K cmp.Ordered](values []T, key func(T) K) fileComparator {
+	keys := make([]K, len(values))
+	for i, value := range values {
+		keys[i] = key(value)
+	}
+	return func(a, b int) int { return cmp.Compare(keys[a], keys[b]) }
+}
+
+// repoPrefix returns the path of targetDir relative to repoDir, which prefixes the paths
+// of files in targetDir as git reports them, or an empty string if they are the same or
+// repoDir is empty.
+func repoPrefix(repoDir, targetDir string) string {
+	if repoDir == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(repoDir, targetDir)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+func TestOrderFiles(t *testing.T) {
+	repoDir := t.TempDir()
+
+	files := []serializer.SourceFile{
+		{Path: "main.go", Content: []byte("package main // the longest file")},
+		{Path: "docs/guide.md", Content: []byte("# Guide")},
+		{Path: "README.md", Content: []byte("# Project")},
+		{Path: "internal/util.go", Content: []byte("package internal")},
+		{Path: "internal/b.go", Content: []byte("package internal")},
+	}
+
+	// Modification times in the working tree differ from commit times, as if every file
+	// had uncommitted changes. README.md has no commits.
+	modTimes := map[string]int64{"main.go": 100, "docs/guide.md": 200, "README.md": 300, "internal/util.go": 400, "internal/b.go": 50}
+	for _, file := range files {
+		fullPath := filepath.Join(repoDir, filepath.FromSlash(file.Path))
+		writeFiles(t, repoDir, map[string]string{file.Path: string(file.Content)})
+		modTime := time.Unix(modTimes[file.Path], 0)
+		if err := os.Chtimes(fullPath, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	mockExecutor := &MockGitExecutor{
+		MockListFileHistory: func(repoDir, ref string) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("\x01500\nM\x00internal/b.go\x00\x00" +
+				"\x01400\nM\x00main.go\x00R100\x00docs/old.md\x00docs/guide.md\x00\x00" +
+				"\x01300\nM\x00main.go\x00\x00" +
+				"\x01200\nA\x00main.go\x00A\x00internal/util.go\x00A\x00internal/b.go\x00A\x00docs/old.md\x00")), nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		order    string
+		patterns []config.PriorityPattern
+		expected []string
+	}{
+		{
+			name:     "Alphabetical",
+			order:    "path",
+			expected: []string{"README.md", "docs/guide.md", "internal/b.go", "internal/util.go", "main.go"},
+		},
+		{
+			name:     "Default order",
+			order:    strings.Join(config.DefaultOrder, ","),
+			expected: []string{"README.md", "internal/util.go", "docs/guide.md", "internal/b.go", "main.go"},
+		},
+		{
+			name:     "Commit frequency with ties broken alphabetically",
+			order:    "commits,path",
+			expected: []string{"README.md", "internal/util.go", "docs/guide.md", "internal/b.go", "main.go"},
+		},
+		{
+			name:     "Descending commit frequency keeps the listing order of ties",
+			order:    "commits:desc",
+			expected: []string{"main.go", "docs/guide.md", "internal/b.go", "internal/util.go", "README.md"},
+		},
+		{
+			name:     "Churn follows renames",
+			order:    "churn:desc,path",
+			expected: []string{"main.go", "docs/guide.md", "internal/b.go", "internal/util.go", "README.md"},
+		},
+		{
+			name:     "Last modified by commit time, falling back to the modification time",
+			order:    "modified,path",
+			expected: []string{"internal/util.go", "README.md", "docs/guide.md", "main.go", "internal/b.go"},
+		},
+		{
+			name:     "Last modified by commit time explicitly",
+			order:    "modified:git:desc,path",
+			expected: []string{"internal/b.go", "docs/guide.md", "main.go", "README.md", "internal/util.go"},
+		},
+		{
+			name:     "Last modified by modification time in the working tree",
+			order:    "modified:mtime,path",
+			expected: []string{"internal/b.go", "main.go", "docs/guide.md", "README.md", "internal/util.go"},
+		},
+		{
+			name:     "Size",
+			order:    "size:desc,path",
+			expected: []string{"main.go", "internal/b.go", "internal/util.go", "README.md", "docs/guide.md"},
+		},
+		{
+			name:     "Tokens",
+			order:    "tokens:desc,path",
+			expected: []string{"main.go", "README.md", "docs/guide.md", "internal/b.go", "internal/util.go"},
+		},
+		{
+			name:     "Docs first",
+			order:    "docs,path",
+			expected: []string{"README.md", "docs/guide.md", "internal/b.go", "internal/util.go", "main.go"},
+		},
+		{
+			name:     "Priority patterns",
+			order:    "priority,path",
+			patterns: []config.PriorityPattern{{Pattern: "internal/", Weight: 5}, {Pattern: "*.md", Weight: -5}},
+			expected: []string{"internal/b.go", "internal/util.go", "main.go", "README.md", "docs/guide.md"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order []config.OrderKey
+			for _, field := range strings.Split(tt.order, ",") {
+				parts := strings.Split(field, ":")
+				key := config.OrderKey{Strategy: parts[0]}
+				for _, part := range parts[1:] {
+					if part == "desc" {
+						key.Descending = true
+					} else {
+						key.Variant = part
+					}
+				}
+				order = append(order, key)
+			}
+
+			cfg := &config.Config{TargetDir: repoDir, Order: order, PriorityPatterns: tt.patterns, Jobs: 1}
+			input := append([]serializer.SourceFile{}, files...)
+
+			got, err := orderFiles(cfg, newGitHistory(cfg, NewGit(mockExecutor), repoDir), serializer.SerializeOptions{Jobs: 1}, input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			paths := serializer.FilePaths(got)
+			if strings.Join(paths, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Order mismatch: got %v, want %v", paths, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDocRank(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"README.md", 0},
+		{"ARCHITECTURE.md", 0},
+		{"readme", 0},
+		{"pkg/README.md", 1},
+		{"CHANGELOG.md", 1},
+		{"docs/setup.sh", 1},
+		{"readme.go", 2},
+		{"main.go", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := docRank(tt.path); got != tt.expected {
+				t.Errorf("docRank(%q) = %d, want %d", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"path/filepath"
+
+	"github.com/foresturquhart/grimoire/internal/pool"
+	"github.com/foresturquhart/grimoire/internal/secrets"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/rs/zerolog/log"
+)
+
+// readResult is the outcome of reading a single file.
+type readResult struct {
+	content  []byte
+	findings []secrets.Finding
+	err      error
+}
+
+// readFiles reads the files at the given paths, relative to baseDir, from source on a pool
+// of jobs workers, scanning each file for secrets with detector as soon as it has been read so
+// that every file is only read once. Files that cannot be read are logged and left out.
+// The returned files and findings follow the order of filePaths.
+func readFiles(baseDir string, source FileSource, filePaths []string, jobs int, detector *secrets.Detector) ([]serializer.SourceFile, []secrets.Finding) {
+	files := make([]serializer.SourceFile, 0, len(filePaths))
+	var findings []secrets.Finding
+
+	_ = pool.Ordered(len(filePaths), jobs, func(i int) readResult {
+		fullPath := filepath.Join(baseDir, filePaths[i])
+
+		content, err := source.ReadFile(filePaths[i])
+		if err != nil {
+			return readResult{err: err}
+		}
+
+		return readResult{
+			content:  content,
+			findings: detector.DetectSecrets(fullPath, content),
+		}
+	}, func(i int, result readResult) error {
+		if result.err != nil {
+			log.Warn().Err(result.err).Msgf("Skipping file %s due to read error", filePaths[i])
+			return nil
+		}
+
+		files = append(files, serializer.SourceFile{Path: filePaths[i], Content: result.content})
+		findings = append(findings, result.findings...)
+		return nil
+	})
+
+	return files, findings
+}
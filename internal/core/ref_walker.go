@@ -0,0 +1,250 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// symlinkMode is the mode of a symbolic link in a Git tree.
+const symlinkMode = "120000"
+
+// RefWalker is an implementation of Walker that lists the files in targetDir as they are
+// in a Git ref, such as a tag or commit, rather than in the working tree. Files are listed
+// with `git ls-tree` and their content is read from the repository's objects with
+// `git cat-file`, so that the working tree is never read. The .gitignore and
+// .grimoireignore files in the tree at the ref are honored together with .git/info/exclude
+// and the global excludes file, and the extension, name, shebang, regex, include and
+// exclude filters and binary detection are applied as for DefaultWalker. Symbolic links
+// and submodules are skipped.
+type RefWalker struct {
+	*fileFilter
+
+	// targetDir is the directory whose files are listed.
+	targetDir string
+
+	// repoDir is the root of the Git repository containing targetDir.
+	repoDir string
+
+	// globalExcludesFile is the path of the user's global Git excludes file, if any.
+	globalExcludesFile string
+
+	// ref is the Git ref whose tree is listed.
+	ref string
+
+	// git is used to list the tree and read objects.
+	git *Git
+
+	// blobs holds the content of the candidate files read from the repository, keyed by
+	// path relative to targetDir.
+	blobs blobSource
+}
+
+// NewRefWalker constructs and returns a new RefWalker that lists the files in targetDir
+// at ref using git and filters them with the given options. opts.RepoDir must be set.
+func NewRefWalker(targetDir, ref string, git *Git, opts WalkerOptions) *RefWalker {
+	blobs := make(blobSource)
+	return &RefWalker{
+		fileFilter:         newFileFilter(opts, blobs),
+		targetDir:          targetDir,
+		repoDir:            opts.RepoDir,
+		globalExcludesFile: opts.GlobalExcludesFile,
+		ref:                ref,
+		git:                git,
+		blobs:              blobs,
+	}
+}
+
+// Walk lists the files in targetDir at the ref and returns the sorted paths (relative to
+// targetDir) of those that meet the filtering criteria. The content of every candidate
+// file is read in a single pass and kept in memory, to be served by Source.
+func (rw *RefWalker) Walk() ([]string, error) {
+	entries, err := rw.git.ListTree(rw.repoDir, rw.ref)
+	if err != nil {
+		return nil, fmt.Errorf("git tree listing failed: %w", err)
+	}
+
+	// Paths in the tree are relative to the repository root, so those in targetDir share
+	// its path relative to the root as a prefix.
+	prefix := ""
+	if rel, err := filepath.Rel(rw.repoDir, rw.targetDir); err == nil && rel != "." {
+		prefix = filepath.ToSlash(rel) + "/"
+	}
+
+	ignores, err := rw.loadIgnores(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	var objects []string
+	for _, entry := range entries {
+		if entry.Type != "blob" || entry.Mode == symlinkMode || !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+
+		relPath := strings.TrimPrefix(entry.Path, prefix)
+		fullPath := filepath.Join(rw.targetDir, filepath.FromSlash(relPath))
+
+		if rw.skipPath(fullPath, relPath) {
+			continue
+		}
+
+		if ignores.isIgnored(entry.Path, prefix) {
+			continue
+		}
+
+		if rw.excludes != nil && rw.excludes.MatchesPath(relPath) {
+			continue
+		}
+
+		if !rw.isCandidate(relPath, path.Base(relPath)) {
+			continue
+		}
+
+		candidates = append(candidates, relPath)
+		objects = append(objects, entry.Object)
+	}
+
+	err = rw.git.ReadBlobs(rw.repoDir, objects, func(i int, content []byte) error {
+		rw.blobs[candidates[i]] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files at %s: %w", rw.ref, err)
+	}
+
+	var files []string
+	for _, relPath := range candidates {
+		if rw.includeFile(relPath, path.Base(relPath)) {
+			files = append(files, relPath)
+		} else {
+			delete(rw.blobs, relPath)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Source returns a FileSource that serves the content of the listed files at the ref.
+// It is only populated once Walk has returned.
+func (rw *RefWalker) Source() FileSource {
+	return rw.blobs
+}
+
+// loadIgnores reads and compiles the ignore files found in entries, which hold the whole
+// tree of the repository at the ref.
+func (rw *RefWalker) loadIgnores(entries []TreeEntry) (*treeIgnores, error) {
+	ignores := &treeIgnores{
+		repoDir:  rw.repoDir,
+		base:     loadExcludeRules(rw.repoDir, rw.globalExcludesFile),
+		dirRules: make(map[string][]*ignoreRules),
+		rules:    make(map[string][]*ignoreRules),
+		ignored:  make(map[string]bool),
+	}
+
+	// Read the ignore files in the order of ignoreFilenames within each directory, so that
+	// their rules keep the same precedence as on the filesystem.
+	var ignoreFiles []TreeEntry
+	for _, ignoreFilename := range ignoreFilenames {
+		for _, entry := range entries {
+			if entry.Type == "blob" && path.Base(entry.Path) == ignoreFilename {
+				ignoreFiles = append(ignoreFiles, entry)
+			}
+		}
+	}
+
+	objects := make([]string, len(ignoreFiles))
+	for i, entry := range ignoreFiles {
+		objects[i] = entry.Object
+	}
+
+	err := rw.git.ReadBlobs(rw.repoDir, objects, func(i int, content []byte) error {
+		dir := treeDir(ignoreFiles[i].Path)
+		baseDir := filepath.Join(rw.repoDir, filepath.FromSlash(dir))
+		ignores.dirRules[dir] = append(ignores.dirRules[dir], compileIgnoreRules(content, baseDir))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore files at %s: %w", rw.ref, err)
+	}
+
+	return ignores, nil
+}
+
+// treeIgnores applies the ignore files of a Git tree to the paths in it, caching the
+// rules and the outcome for each directory. Directories are keyed by path relative to the
+// repository root, with an empty string for the root itself.
+type treeIgnores struct {
+	// repoDir is the root of the repository, which anchors the rules.
+	repoDir string
+
+	// base holds the rules that apply to the whole tree, from outside of it.
+	base []*ignoreRules
+
+	// dirRules holds the rules of the ignore files in each directory.
+	dirRules map[string][]*ignoreRules
+
+	// rules caches the rules that apply within each directory, from lowest to highest
+	// precedence.
+	rules map[string][]*ignoreRules
+
+	// ignored caches whether each directory is ignored.
+	ignored map[string]bool
+}
+
+// isIgnored reports whether the file at treePath, or any of the directories leading to it
+// below the directory prefix, is ignored. As in a filesystem walk, the contents of an
+// ignored directory cannot be re-included, and the directories above prefix are not
+// checked.
+func (t *treeIgnores) isIgnored(treePath, prefix string) bool {
+	dir := treeDir(treePath)
+	if t.dirIgnored(dir, strings.TrimSuffix(prefix, "/")) {
+		return true
+	}
+	return isIgnored(t.rulesFor(dir), filepath.Join(t.repoDir, filepath.FromSlash(treePath)), false)
+}
+
+// dirIgnored reports whether dir, or any directory between it and top, is ignored.
+func (t *treeIgnores) dirIgnored(dir, top string) bool {
+	if dir == top || dir == "" {
+		return false
+	}
+
+	ignored, ok := t.ignored[dir]
+	if !ok {
+		parent := treeDir(dir)
+		ignored = t.dirIgnored(parent, top) ||
+			isIgnored(t.rulesFor(parent), filepath.Join(t.repoDir, filepath.FromSlash(dir)), true)
+		t.ignored[dir] = ignored
+	}
+	return ignored
+}
+
+// rulesFor returns the rules that apply to the entries of dir: those of the directories
+// above it, followed by its own.
+func (t *treeIgnores) rulesFor(dir string) []*ignoreRules {
+	rules, ok := t.rules[dir]
+	if !ok {
+		inherited := t.base
+		if dir != "" {
+			inherited = t.rulesFor(treeDir(dir))
+		}
+		rules = append(append([]*ignoreRules{}, inherited...), t.dirRules[dir]...)
+		t.rules[dir] = rules
+	}
+	return rules
+}
+
+// treeDir returns the directory of a path in a Git tree, or an empty string for the root.
+func treeDir(treePath string) string {
+	dir := path.Dir(treePath)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
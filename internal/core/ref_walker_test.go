@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRefWalker(t *testing.T) {
+	repoDir := t.TempDir()
+	targetDir := filepath.Join(repoDir, "src")
+
+	// Objects are named after the paths they are stored at, for readability.
+	tree := []struct {
+		mode, kind, path, content string
+	}{
+		{"100644", "blob", ".gitignore", "*.log\n"},
+		{"100644", "blob", "README.md", "outside of the target directory"},
+		{"100644", "blob", "src/.grimoireignore", "gen/\n!keep.log\n"},
+		{"100644", "blob", "src/main.go", "package main"},
+		{"100644", "blob", "src/debug.log", "ignored by the root .gitignore"},
+		{"100644", "blob", "src/keep.log", "re-included"},
+		{"100644", "blob", "src/gen/gen.go", "package gen"},
+		{"100644", "blob", "src/vendor/lib.go", "package lib"},
+		{"100644", "blob", "src/a_test.go", "package main"},
+		{"100644", "blob", "src/image.go", "\x89PNG\r\n\x1a\n"},
+		{"100755", "blob", "src/run", "#!/bin/sh\necho run"},
+		{"120000", "blob", "src/link.go", "main.go"},
+		{"160000", "commit", "src/module", ""},
+	}
+
+	var listing strings.Builder
+	objects := make(map[string]string)
+	for _, entry := range tree {
+		fmt.Fprintf(&listing, "%s %s %s\t%s\x00", entry.mode, entry.kind, entry.path, entry.path)
+		objects[entry.path] = entry.content
+	}
+
+	var read []string
+	mockExecutor := &MockGitExecutor{
+		MockListTree: func(dir, ref string) (io.ReadCloser, error) {
+			if dir != repoDir || ref != "v1.0.0" {
+				t.Errorf("ListTree called with %s and %s, want %s and v1.0.0", dir, ref, repoDir)
+			}
+			return io.NopCloser(strings.NewReader(listing.String())), nil
+		},
+		MockCatFileBatch: func(dir string, names io.Reader) (io.ReadCloser, error) {
+			var output strings.Builder
+			scanner := bufio.NewScanner(names)
+			for scanner.Scan() {
+				name := scanner.Text()
+				read = append(read, name)
+				content, ok := objects[name]
+				if !ok {
+					fmt.Fprintf(&output, "%s missing\n", name)
+					continue
+				}
+				fmt.Fprintf(&output, "%s blob %d\n%s\n", name, len(content), content)
+			}
+			return io.NopCloser(strings.NewReader(output.String())), nil
+		},
+	}
+
+	walker := NewRefWalker(targetDir, "v1.0.0", NewGit(mockExecutor), WalkerOptions{
+		AllowedFileExtensions: map[string]bool{".go": true, ".md": true, ".log": true},
+		ShebangInterpreters:   map[string]bool{"sh": true},
+		IgnoredPathRegexes:    []*regexp.Regexp{regexp.MustCompile(`(^|/)vendor/`)},
+		ExcludePatterns:       []string{"**/*_test.go"},
+		RepoDir:               repoDir,
+	})
+
+	got, err := walker.Walk()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"keep.log", "main.go", "run"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Files mismatch: got %v, want %v", got, expected)
+	}
+
+	// Only the ignore files and the candidates are read from the repository.
+	expectedRead := []string{".gitignore", "src/.grimoireignore", "src/main.go", "src/keep.log", "src/image.go", "src/run"}
+	if strings.Join(read, ",") != strings.Join(expectedRead, ",") {
+		t.Errorf("Objects read mismatch: got %v, want %v", read, expectedRead)
+	}
+
+	// The content of the listed files is served from the objects read.
+	for _, relPath := range got {
+		content, err := walker.Source().ReadFile(relPath)
+		if err != nil {
+			t.Errorf("Unexpected error reading %s: %v", relPath, err)
+		} else if string(content) != objects["src/"+relPath] {
+			t.Errorf("Content mismatch for %s: got %q, want %q", relPath, content, objects["src/"+relPath])
+		}
+	}
+	if _, err := walker.Source().ReadFile("image.go"); err == nil {
+		t.Errorf("Expected error reading an excluded file, but got nil")
+	}
+
+	// A missing object is reported as an error.
+	delete(objects, "src/main.go")
+	if _, err := walker.Walk(); err == nil {
+		t.Errorf("Expected error for a missing object, but got nil")
+	}
+
+	// A failing listing is reported as an error.
+	mockExecutor.MockListTree = func(dir, ref string) (io.ReadCloser, error) {
+		return nil, ErrTest
+	}
+	if _, err := walker.Walk(); err == nil {
+		t.Errorf("Expected error, but got nil")
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+	"github.com/foresturquhart/grimoire/internal/report"
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/foresturquhart/grimoire/internal/tokens"
+	"github.com/rs/zerolog/log"
+)
+
+// Report selects and reads files exactly as Run does, then writes a report of the bytes,
+// lines and tokens of each file and directory in cfg.ReportFormat instead of the output.
+// Detected secrets are logged but do not stop the report, since nothing is sent anywhere,
+// and are redacted before counting if redaction is enabled.
+func Report(cfg *config.Config) error {
+	// Select the tokenizer and counting mode before anything is counted
+	if err := tokens.Configure(cfg.Tokenizer, tokens.Mode(cfg.TokenCountMode)); err != nil {
+		return fmt.Errorf("failed to configure token counting: %w", err)
+	}
+
+	collected, err := collectFiles(cfg)
+	if err != nil {
+		return err
+	}
+
+	if collected.hasFindings() {
+		collected.logFindings(log.Warn)
+		log.Warn().Msg("Potential secrets detected in codebase. They must be redacted with --redact-secrets or ignored with --ignore-secrets to generate output")
+	}
+
+	stats := serializer.MeasureFiles(collected.sourceFiles, newSerializeOptions(cfg, collected))
+	// Key churn scores by path relative to the target directory, as in the report.
+	var churn map[string]float64
+	if files := collected.history.loadIfAvailable("the report"); files != nil {
+		churn = make(map[string]float64, len(stats))
+		for _, fileStats := range stats {
+			churn[filepath.ToSlash(fileStats.Path)] = files.Churn[collected.history.key(fileStats.Path)]
+		}
+	}
+	fileReport := report.Build(cfg.TargetDir, tokens.Describe(), stats, churn)
+
+	// Write the report to the output file if one is set, otherwise to stdout.
+	writer := os.Stdout
+	if cfg.ShouldWriteFile() {
+		writer, err = os.Create(cfg.OutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			if cerr := writer.Close(); cerr != nil {
+				log.Warn().Err(cerr).Msg("Failed to close output file")
+			}
+		}()
+	}
+
+	if err := fileReport.Write(writer, cfg.ReportFormat); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if cfg.ShouldWriteFile() {
+		log.Info().Msgf("Report written to %s", cfg.OutputFile)
+	}
+
+	return nil
+}
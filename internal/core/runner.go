@@ -3,9 +3,7 @@ package core
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
-	"github.com/foresturquhart/grimoire/internal/secrets"
 	"github.com/foresturquhart/grimoire/internal/tokens"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
@@ -16,63 +14,44 @@ import (
 )
 
 // Run is the main entry point for processing files. It uses a Walker to retrieve
-// files from cfg.TargetDir, optionally sorts them by Git commit frequency,
+// files from cfg.TargetDir, orders them by the configured strategies,
 // and serializes them (e.g., to Markdown) via the specified Serializer.
 //
 // The function returns an error if any critical step (such as starting the walker
 // or creating the output file) fails.
 func Run(cfg *config.Config) error {
-	// Create a new walker to recursively find and filter files in TargetDir.
-	walker := NewDefaultWalker(cfg.TargetDir, cfg.AllowedFileExtensions, cfg.IgnoredPathRegexes, cfg.OutputFile)
-
-	// Recursively find and filter files in TargetDir, returning a slice of string paths.
-	files, err := walker.Walk()
-	if err != nil {
-		return fmt.Errorf("error walking target directory: %w", err)
+	// Create a serializer based on the configured template or format first, so that
+	// a missing or invalid template is reported before any work is done
+	var formatSerializer serializer.Serializer
+	var err error
+	if cfg.Template != "" {
+		formatSerializer, err = serializer.LoadTemplate(cfg.Template, config.UserTemplatesDir())
+	} else {
+		formatSerializer, err = serializer.NewSerializer(cfg.Format)
 	}
-
-	log.Info().Msgf("Found %d files in %s", len(files), cfg.TargetDir)
-
-	// Initialize variables for secret findings
-	var findings []secrets.Finding
-	secretsFound := false
-
-	// Get absolute file paths for secret detection
-	var absoluteFilePaths []string
-	for _, file := range files {
-		absPath := filepath.Join(cfg.TargetDir, file)
-		absoluteFilePaths = append(absoluteFilePaths, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to create serializer: %w", err)
 	}
 
-	log.Info().Msg("Checking for secrets in files...")
-
-	// Create a secrets detector
-	detector, err := secrets.NewDetector()
-	if err != nil {
-		return fmt.Errorf("failed to create secrets detector: %w", err)
+	// Select the tokenizer and counting mode before anything is counted
+	if err := tokens.Configure(cfg.Tokenizer, tokens.Mode(cfg.TokenCountMode)); err != nil {
+		return fmt.Errorf("failed to configure token counting: %w", err)
 	}
 
-	// Detect secrets in the files
-	findings, secretsFound, err = detector.DetectSecretsInFiles(absoluteFilePaths)
+	collected, err := collectFiles(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to check for secrets: %w", err)
+		return err
 	}
+	sourceFiles := collected.sourceFiles
 
-	if secretsFound {
+	if collected.hasFindings() {
 		// Choose logging level based on how we're handling the secrets
 		logFn := log.Error
 		if cfg.IgnoreSecrets || cfg.RedactSecrets {
 			logFn = log.Warn
 		}
 
-		for _, finding := range findings {
-			logFn().
-				Str("type", finding.Description).
-				Str("secret", finding.Secret).
-				Str("file", finding.File).
-				Int("line", finding.Line).
-				Msg("Detected possible secret")
-		}
+		collected.logFindings(logFn)
 
 		if !cfg.IgnoreSecrets && !cfg.RedactSecrets {
 			log.Fatal().Msg("Potential secrets detected in codebase. please review findings and remove sensitive data. use --ignore-secrets to bypass or --redact-secrets to redact (recommended)")
@@ -89,29 +68,36 @@ func Run(cfg *config.Config) error {
 		log.Info().Msg("No secrets detected in files")
 	}
 
-	if !cfg.DisableSort {
-		// If Git is available, attempt to sort files by commit frequency.
-		gitExecutor := NewDefaultGitExecutor()
-		git := NewGit(gitExecutor)
-
-		if git.IsAvailable() {
-			// If directory is within a Git repository, find the repository root
-			repoDir, err := git.FindRepositoryRoot(cfg.TargetDir)
-			if err != nil {
-				log.Warn().Err(err).Msg("Git repository not found, skipping commit frequency file sorting")
-			} else {
-				log.Info().Msgf("Found Git repository at %s, sorting files by commit frequency", repoDir)
-
-				files, err = git.SortFilesByCommitCounts(repoDir, files, git.GetCommitCounts)
-				if err != nil {
-					return fmt.Errorf("failed to sort files by commit frequency: %w", err)
-				}
-			}
-		} else {
-			log.Warn().Msg("Skipped sorting files by commit frequency: git executable not found")
+	serializeOpts := newSerializeOptions(cfg, collected)
+
+	// Pack files within the token budget, if one is set, omitting the files that do not fit.
+	if cfg.MaxTokens > 0 {
+		tokenCounts := serializer.MeasureTokens(sourceFiles, serializeOpts)
+		// Break ties between files of equal weight by churn, then by commit counts.
+		var commitCounts map[string]int
+		var churn map[string]float64
+		if files := collected.history.loadIfAvailable("the token budget"); files != nil {
+			commitCounts, churn = files.CommitCounts, files.Churn
 		}
-	} else {
-		log.Info().Msg("Skipped sorting files by commit frequency: sorting disabled by flag")
+		priorities := filePriorities(serializer.FilePaths(sourceFiles), commitCounts, churn, collected.history.prefix(), cfg.PriorityPatterns)
+
+		var omitted []omittedFile
+		var used int
+		totalFiles := len(sourceFiles)
+		sourceFiles, omitted, used = packWithinBudget(sourceFiles, tokenCounts, priorities, cfg.MaxTokens)
+
+		for _, file := range omitted {
+			log.Warn().Msgf("Omitted %s (%d tokens): it does not fit in the remaining token budget of %d tokens", file.path, file.tokens, file.remaining)
+			serializeOpts.OmittedFiles = append(serializeOpts.OmittedFiles, file.path)
+		}
+
+		p := message.NewPrinter(language.English)
+		log.Info().Msg(p.Sprintf("Packed %d of %d files using %d of %d tokens (%s)", len(sourceFiles), totalFiles, used, cfg.MaxTokens, tokens.Describe()))
+	}
+
+	// Write numbered, self-contained parts instead of a single document if requested.
+	if cfg.SplitTokens > 0 {
+		return writeParts(formatSerializer, sourceFiles, serializeOpts, cfg.OutputFile, cfg.SplitTokens, cfg.Force)
 	}
 
 	// Determine where to write output. If cfg.ShouldWriteFile(), create the file, otherwise use stdout.
@@ -132,42 +118,32 @@ func Run(cfg *config.Config) error {
 		writer = os.Stdout
 	}
 
-	// Create a token capturing writer that wraps the actual writer
-	tokenOpts := &tokens.TokenCounterOptions{}
-	captureWriter, err := tokens.NewCaptureWriter(writer, tokenOpts)
-	if err != nil {
-		return fmt.Errorf("failed to create token counter: %w", err)
-	}
-
-	// Create a serializer based on the configured format
-	formatSerializer, err := serializer.NewSerializer(cfg.Format)
-	if err != nil {
-		return fmt.Errorf("failed to create serializer: %w", err)
-	}
-
-	// Prepare redaction info if needed
-	var redactionInfo *serializer.RedactionInfo
-	if cfg.RedactSecrets && secretsFound {
-		redactionInfo = &serializer.RedactionInfo{
-			Enabled:  true,
-			Findings: findings,
-			BaseDir:  cfg.TargetDir,
+	// Write straight to the output if tokens are not counted, so that none of the output
+	// is tokenized.
+	if cfg.SkipTokenCount {
+		if err := formatSerializer.Serialize(writer, sourceFiles, serializeOpts); err != nil {
+			return fmt.Errorf("failed to serialize content: %w", err)
+		}
+	} else {
+		// Create a token capturing writer that wraps the actual writer
+		tokenOpts := &tokens.TokenCounterOptions{}
+		captureWriter, err := tokens.NewCaptureWriter(writer, tokenOpts)
+		if err != nil {
+			return fmt.Errorf("failed to create token counter: %w", err)
 		}
-	}
 
-	// Serialize files to the configured format
-	if err := formatSerializer.Serialize(captureWriter, cfg.TargetDir, files, cfg.ShowTree, redactionInfo, cfg.LargeFileSizeThreshold, cfg.HighTokenThreshold, cfg.SkipTokenCount); err != nil {
-		return fmt.Errorf("failed to serialize content: %w", err)
-	}
+		// Serialize files to the configured format
+		if err := formatSerializer.Serialize(captureWriter, sourceFiles, serializeOpts); err != nil {
+			return fmt.Errorf("failed to serialize content: %w", err)
+		}
 
-	if !cfg.SkipTokenCount {
 		// Count tokens in the output
 		if err := captureWriter.CountTokens(); err != nil {
 			log.Warn().Err(err).Msg("Failed to count tokens in output")
 		} else {
 			// Log token count information
 			p := message.NewPrinter(language.English)
-			log.Info().Msg(p.Sprintf("Output contains %d tokens", captureWriter.GetTokenCount()))
+			log.Info().Msg(p.Sprintf("Output contains %d tokens (%s)", captureWriter.GetTokenCount(), tokens.Describe()))
 		}
 	}
 
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// parseShebangInterpreter returns the interpreter named on the shebang line at the start of
+// content, or an empty string if content does not start with "#!". Both direct paths
+// ("#!/bin/bash -e") and env indirection ("#!/usr/bin/env -S deno run") are supported.
+// Version suffixes are stripped, so python3.12 is reported as python.
+func parseShebangInterpreter(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+
+	line, _, _ := strings.Cut(content[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env options such as -S or -i and variable assignments to find the command.
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+				continue
+			}
+			interpreter = filepath.Base(field)
+			break
+		}
+	}
+
+	// Strip version suffixes such as python3 or python3.12.
+	return strings.TrimRight(interpreter, "0123456789.")
+}
@@ -0,0 +1,29 @@
+package core
+
+import "testing"
+
+func TestParseShebangInterpreter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "No shebang", content: "print('hello')\n", expected: ""},
+		{name: "Empty shebang", content: "#!\n", expected: ""},
+		{name: "Direct path", content: "#!/bin/bash\necho hi\n", expected: "bash"},
+		{name: "Direct path with options", content: "#!/bin/sh -e\n", expected: "sh"},
+		{name: "Env indirection", content: "#!/usr/bin/env python\n", expected: "python"},
+		{name: "Env with version suffix", content: "#!/usr/bin/env python3.12\n", expected: "python"},
+		{name: "Env with options", content: "#!/usr/bin/env -S deno run --allow-all\n", expected: "deno"},
+		{name: "Env with variable assignment", content: "#!/usr/bin/env NODE_ENV=production node\n", expected: "node"},
+		{name: "No trailing newline", content: "#!/usr/bin/ruby", expected: "ruby"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseShebangInterpreter(tt.content); got != tt.expected {
+				t.Errorf("Interpreter mismatch: got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
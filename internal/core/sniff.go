@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/h2non/filetype"
+)
+
+// SniffSize is the number of bytes read from the start of a file to classify its content.
+const SniffSize = 8192
+
+// maxInvalidUTF8Ratio is the fraction of bytes that may be part of invalid UTF-8 sequences
+// before content is considered binary. A small allowance keeps Latin-1 text with the odd
+// accented character.
+const maxInvalidUTF8Ratio = 0.1
+
+// textualMagicTypes lists MIME types detected by magic number that are nevertheless text,
+// so they are classified by the remaining heuristics instead.
+var textualMagicTypes = map[string]bool{
+	"application/rtf":        true,
+	"application/postscript": true,
+}
+
+// readHead reads up to SniffSize bytes from the start of the file at path.
+func readHead(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, SniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return head[:n], nil
+}
+
+// sniffBinary inspects the start of a file's content and reports whether it is binary,
+// along with a human-readable reason. Content is considered binary if it has the magic
+// number of a known binary format, is UTF-16 or UTF-32 encoded, contains NUL bytes, or
+// consists largely of invalid UTF-8.
+func sniffBinary(head []byte) (bool, string) {
+	if len(head) == 0 {
+		return false, ""
+	}
+
+	if bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) ||
+		bytes.HasPrefix(head, []byte{0x00, 0x00, 0xFE, 0xFF}) {
+		return true, "content is UTF-16 or UTF-32 encoded"
+	}
+
+	if kind, err := filetype.Match(head); err == nil && kind != filetype.Unknown && !textualMagicTypes[kind.MIME.Value] {
+		return true, fmt.Sprintf("content looks like %s", kind.MIME.Value)
+	}
+
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true, "content contains NUL bytes"
+	}
+
+	// Ignore a multi-byte character cut off at the end of the sniffed block.
+	checked := head
+	if len(head) == SniffSize {
+		for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(head[i]) {
+				if !utf8.FullRune(head[i:]) {
+					checked = head[:i]
+				}
+				break
+			}
+		}
+	}
+
+	invalid := 0
+	for i := 0; i < len(checked); {
+		r, size := utf8.DecodeRune(checked[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		i += size
+	}
+
+	if float64(invalid)/float64(len(head)) > maxInvalidUTF8Ratio {
+		return true, fmt.Sprintf("%d of the first %d bytes are invalid UTF-8", invalid, len(head))
+	}
+
+	return false, ""
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSniffBinary(t *testing.T) {
+	// invalidRun builds content of the given length that starts with text and holds
+	// the given number of bytes that are invalid UTF-8.
+	invalidRun := func(length, invalid int) []byte {
+		content := bytes.Repeat([]byte("a"), length)
+		for i := 0; i < invalid; i++ {
+			content[length-1-2*i] = 0xFF
+		}
+		return content
+	}
+
+	// At SniffSize, 819 invalid bytes are just within the ratio. A multi-byte character
+	// cut off at the end of the block would push it over if it were counted.
+	cutRune := invalidRun(SniffSize-2, 819)
+	cutRune = append(cutRune, "€"[:2]...)
+
+	tests := []struct {
+		name   string
+		head   []byte
+		binary bool
+		reason string
+	}{
+		{name: "Empty", head: nil},
+		{name: "Plain text", head: []byte("package main\n\nfunc main() {}\n")},
+		{name: "Multi-byte UTF-8", head: []byte("héllo wörld, 你好, €100\n")},
+		{name: "NUL bytes", head: []byte("text\x00more text"), binary: true, reason: "NUL bytes"},
+		{name: "UTF-16LE BOM", head: []byte("\xFF\xFEh\x00i\x00"), binary: true, reason: "UTF-16 or UTF-32"},
+		{name: "UTF-16BE BOM", head: []byte("\xFE\xFF\x00h\x00i"), binary: true, reason: "UTF-16 or UTF-32"},
+		{name: "UTF-32LE BOM", head: []byte("\xFF\xFE\x00\x00h\x00\x00\x00"), binary: true, reason: "UTF-16 or UTF-32"},
+		{name: "UTF-32BE BOM", head: []byte("\x00\x00\xFE\xFF\x00\x00\x00h"), binary: true, reason: "UTF-16 or UTF-32"},
+		{name: "PNG header", head: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), binary: true, reason: "image/png"},
+		{name: "ZIP header", head: []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00"), binary: true, reason: "application/zip"},
+		{name: "Invalid UTF-8 just below the ratio", head: invalidRun(1000, 100)},
+		{name: "Invalid UTF-8 just above the ratio", head: invalidRun(1000, 101), binary: true, reason: "101 of the first 1000 bytes are invalid UTF-8"},
+		{name: "Multi-byte character cut at SniffSize", head: cutRune},
+		{name: "Invalid bytes at the end of SniffSize", head: invalidRun(SniffSize, 820), binary: true, reason: "820 of the first 8192 bytes"},
+		{name: "RTF", head: []byte("{\\rtf1\\ansi\\deff0 {\\fonttbl {\\f0 Times;}} Hello}")},
+		{name: "PostScript", head: []byte("%!PS-Adobe-3.0\n%%Title: page\nshowpage\n")},
+		{name: "SVG", head: []byte("<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, reason := sniffBinary(tt.head)
+			if binary != tt.binary {
+				t.Errorf("Binary mismatch: got %v (%s), want %v", binary, reason, tt.binary)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("Reason mismatch: got %q, want it to contain %q", reason, tt.reason)
+			}
+		})
+	}
+}
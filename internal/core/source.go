@@ -0,0 +1,51 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// FileSource provides the content of the files listed by a Walker, by path relative to
+// the directory that was walked.
+type FileSource interface {
+	// ReadFile returns the full content of the file at relPath.
+	ReadFile(relPath string) ([]byte, error)
+
+	// ReadHead returns up to SniffSize bytes from the start of the file at relPath.
+	ReadHead(relPath string) ([]byte, error)
+}
+
+// dirSource is a FileSource that reads files from a directory on the filesystem.
+type dirSource string
+
+// ReadFile reads the file at relPath within the directory.
+func (d dirSource) ReadFile(relPath string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(relPath)))
+}
+
+// ReadHead reads the start of the file at relPath within the directory.
+func (d dirSource) ReadHead(relPath string) ([]byte, error) {
+	return readHead(filepath.Join(string(d), filepath.FromSlash(relPath)))
+}
+
+// blobSource is a FileSource that serves file contents held in memory, such as the
+// contents of Git objects, keyed by relative path with forward slashes.
+type blobSource map[string][]byte
+
+// ReadFile returns the content held for relPath.
+func (b blobSource) ReadFile(relPath string) ([]byte, error) {
+	content, ok := b[filepath.ToSlash(relPath)]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: relPath, Err: os.ErrNotExist}
+	}
+	return content, nil
+}
+
+// ReadHead returns the start of the content held for relPath.
+func (b blobSource) ReadHead(relPath string) ([]byte, error) {
+	content, err := b.ReadFile(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return content[:min(len(content), SniffSize)], nil
+}
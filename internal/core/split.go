@@ -0,0 +1,269 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"github.com/foresturquhart/grimoire/internal/tokens"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// fileFramingTokens estimates the tokens that a format adds around each file, such as
+// its heading, code fence and entry in the directory tree, on top of twice the tokens
+// of its path.
+const fileFramingTokens = 8
+
+// maxPlanAttempts is the number of times that parts are planned again, with less room for
+// files, when a part turns out to exceed the limit once rendered.
+const maxPlanAttempts = 4
+
+// timestampSlackTokens is left free in each part when it is measured, since the token count
+// of the generation timestamp in its header varies between renders.
+const timestampSlackTokens = 4
+
+// segmentMarkerTokens is reserved in each segment of a split file for its continuation
+// markers, on top of twice the tokens of its path.
+const segmentMarkerTokens = 40
+
+// outputPart is one self-contained document of an output that is split into parts.
+type outputPart struct {
+	// files are the files in the part, including segments of files split across parts.
+	files []serializer.SourceFile
+
+	// entries describe the files in the part for the manifest.
+	entries []string
+
+	// tokens is the estimated token count of the files in the part.
+	tokens int
+}
+
+// partPath returns the path of the part with the given number, inserting ".partN"
+// before the extension of outputFile.
+func partPath(outputFile string, number int) string {
+	ext := filepath.Ext(outputFile)
+	return fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(outputFile, ext), number, ext)
+}
+
+// measureOutput returns the token count of the document that formatSerializer renders
+// for files with opts.
+func measureOutput(formatSerializer serializer.Serializer, files []serializer.SourceFile, opts serializer.SerializeOptions) (int, error) {
+	captureWriter, err := tokens.NewCaptureWriter(io.Discard, &tokens.TokenCounterOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create token counter: %w", err)
+	}
+
+	if err := formatSerializer.Serialize(captureWriter, files, opts); err != nil {
+		return 0, err
+	}
+
+	if err := captureWriter.CountTokens(); err != nil {
+		return 0, err
+	}
+
+	return captureWriter.GetTokenCount(), nil
+}
+
+// partOptions returns opts for the part at index i of parts, with the manifest of every part.
+func partOptions(opts serializer.SerializeOptions, parts []*outputPart, i int) serializer.SerializeOptions {
+	manifest := make([][]string, len(parts))
+	for j, part := range parts {
+		manifest[j] = part.entries
+	}
+
+	opts.Part = &serializer.PartInfo{Index: i + 1, Count: len(parts), Manifest: manifest}
+	return opts
+}
+
+// planParts distributes files, in order, across parts whose documents hold at most limit
+// tokens, less reserve. The overhead of a document is measured by rendering it without
+// files, and a file is added to the current part if its estimated tokens fit in what is
+// left. A file that does not fit in an empty part on its own is split into segments at
+// line boundaries, each starting a new part, with markers that tell where the file
+// continues.
+func planParts(formatSerializer serializer.Serializer, files []serializer.SourceFile, opts serializer.SerializeOptions, limit, reserve int) ([]*outputPart, error) {
+	// Measure the parts of a document that do not depend on its files, with a manifest
+	// that lists every file.
+	manifest := [][]string{serializer.FilePaths(files)}
+	overheadOpts := opts
+	overheadOpts.Part = &serializer.PartInfo{Index: 1, Count: 1, Manifest: manifest}
+	overhead, err := measureOutput(formatSerializer, nil, overheadOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure document overhead: %w", err)
+	}
+
+	capacity := limit - overhead - reserve
+	if capacity <= 0 {
+		return nil, fmt.Errorf("split size of %d tokens is too small for the document overhead of %d tokens", limit, overhead)
+	}
+
+	tokenCounts := serializer.MeasureTokens(files, opts)
+
+	var parts []*outputPart
+	current := &outputPart{}
+
+	closeCurrent := func() {
+		if len(current.files) > 0 {
+			parts = append(parts, current)
+			current = &outputPart{}
+		}
+	}
+
+	for i, file := range files {
+		pathTokens, err := tokens.CountTokens(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		framing := 2*pathTokens + fileFramingTokens
+		cost := tokenCounts[i] + framing
+
+		if cost <= capacity {
+			if current.tokens+cost > capacity {
+				closeCurrent()
+			}
+			current.files = append(current.files, file)
+			current.entries = append(current.entries, file.Path)
+			current.tokens += cost
+			continue
+		}
+
+		// The file is too large for a part of its own, so split it into segments.
+		closeCurrent()
+
+		segmentTokens := capacity - framing - 2*pathTokens - segmentMarkerTokens
+		if segmentTokens <= 0 {
+			return nil, fmt.Errorf("split size of %d tokens is too small to split %s", limit, file.Path)
+		}
+
+		content := serializer.ProcessContent(file, opts)
+		chunks, err := serializer.ChunkContent(content, segmentTokens, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split %s: %w", file.Path, err)
+		}
+
+		totalLines := strings.Count(content, "\n") + 1
+		for k, chunk := range chunks {
+			number := len(parts) + 1
+
+			var segment strings.Builder
+			if k == 0 {
+				fmt.Fprintf(&segment, "[Grimoire: %s is split across %d parts. Lines %d-%d of %d.]\n", file.Path, len(chunks), chunk.StartLine, chunk.EndLine, totalLines)
+			} else {
+				fmt.Fprintf(&segment, "[Grimoire: %s continued from part %d. Lines %d-%d of %d.]\n", file.Path, number-1, chunk.StartLine, chunk.EndLine, totalLines)
+			}
+			segment.WriteString(chunk.Content)
+			if k < len(chunks)-1 {
+				fmt.Fprintf(&segment, "\n[Grimoire: %s continues in part %d.]", file.Path, number+1)
+			}
+
+			current.files = append(current.files, serializer.SourceFile{Path: file.Path, Content: []byte(segment.String())})
+			current.entries = append(current.entries, fmt.Sprintf("%s (lines %d-%d of %d)", file.Path, chunk.StartLine, chunk.EndLine, totalLines))
+			current.tokens += chunk.Tokens + framing + segmentMarkerTokens
+
+			// Every segment but the last fills its part, so later files start a new one.
+			if k < len(chunks)-1 {
+				closeCurrent()
+			}
+		}
+	}
+	closeCurrent()
+
+	return parts, nil
+}
+
+// splitParts plans parts of at most limit tokens with planParts. Since the tokens of a
+// part are estimated from those of its files, each planned part is rendered and measured,
+// and if any exceeds limit, parts are planned again with the largest excess reserved.
+func splitParts(formatSerializer serializer.Serializer, files []serializer.SourceFile, opts serializer.SerializeOptions, limit int) ([]*outputPart, error) {
+	reserve := 0
+
+	for attempt := 1; ; attempt++ {
+		parts, err := planParts(formatSerializer, files, opts, limit, reserve)
+		if err != nil {
+			return nil, err
+		}
+
+		excess := 0
+		for i, part := range parts {
+			count, err := measureOutput(formatSerializer, part.files, partOptions(opts, parts, i))
+			if err != nil {
+				return nil, fmt.Errorf("failed to measure part %d: %w", i+1, err)
+			}
+			excess = max(excess, count+timestampSlackTokens-limit)
+		}
+
+		if excess <= 0 || attempt == maxPlanAttempts {
+			return parts, nil
+		}
+		reserve += excess
+	}
+}
+
+// writeParts splits files into parts of at most limit tokens with splitParts, and writes
+// each part as a self-contained document, with a manifest of every part, to a numbered
+// file next to outputFile. The token count of each part is measured as it is written.
+func writeParts(formatSerializer serializer.Serializer, files []serializer.SourceFile, opts serializer.SerializeOptions, outputFile string, limit int, force bool) error {
+	parts, err := splitParts(formatSerializer, files, opts, limit)
+	if err != nil {
+		return fmt.Errorf("failed to split output: %w", err)
+	}
+
+	p := message.NewPrinter(language.English)
+
+	for i, part := range parts {
+		path := partPath(outputFile, i+1)
+
+		if !force {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("output file %s already exists, use --force to overwrite", path)
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("error checking output file %s: %w", path, err)
+			}
+		}
+
+		count, err := writePart(formatSerializer, part.files, partOptions(opts, parts, i), path)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msg(p.Sprintf("Wrote part %d of %d to %s (%d files, %d tokens, %s)", i+1, len(parts), path, len(part.files), count, tokens.Describe()))
+		if count > limit {
+			log.Warn().Msg(p.Sprintf("Part %d has %d tokens, more than the split size of %d tokens", i+1, count, limit))
+		}
+	}
+
+	return nil
+}
+
+// writePart writes one part to path and returns its token count.
+func writePart(formatSerializer serializer.Serializer, files []serializer.SourceFile, opts serializer.SerializeOptions, path string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			log.Warn().Err(cerr).Msgf("Failed to close output file %s", path)
+		}
+	}()
+
+	captureWriter, err := tokens.NewCaptureWriter(file, &tokens.TokenCounterOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create token counter: %w", err)
+	}
+
+	if err := formatSerializer.Serialize(captureWriter, files, opts); err != nil {
+		return 0, fmt.Errorf("failed to serialize content: %w", err)
+	}
+
+	if err := captureWriter.CountTokens(); err != nil {
+		return 0, fmt.Errorf("failed to count tokens in %s: %w", path, err)
+	}
+
+	return captureWriter.GetTokenCount(), nil
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+func TestPartPath(t *testing.T) {
+	tests := []struct {
+		outputFile string
+		number     int
+		want       string
+	}{
+		{outputFile: "out/output.md", number: 1, want: "out/output.part1.md"},
+		{outputFile: "output.tar.xml", number: 12, want: "output.tar.part12.xml"},
+		{outputFile: "output", number: 2, want: "output.part2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outputFile, func(t *testing.T) {
+			if got := partPath(tt.outputFile, tt.number); got != tt.want {
+				t.Errorf("Path mismatch: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitParts(t *testing.T) {
+	var large strings.Builder
+	for i := range 400 {
+		fmt.Fprintf(&large, "line %d of a large file\n", i)
+	}
+
+	files := []serializer.SourceFile{
+		{Path: "a.txt", Content: []byte("small file a\n")},
+		{Path: "b.txt", Content: []byte("small file b\n")},
+		{Path: "large.txt", Content: []byte(large.String())},
+		{Path: "c.txt", Content: []byte("small file c\n")},
+	}
+	opts := serializer.SerializeOptions{ShowTree: true, LargeFileSizeThreshold: 1 << 20, Jobs: 1}
+	limit := 1500
+
+	formatSerializer, err := serializer.NewSerializer("md")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	parts, err := splitParts(formatSerializer, files, opts, limit)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(parts) < 3 {
+		t.Fatalf("Expected the large file to be split across parts, got %d parts", len(parts))
+	}
+
+	// Small files are kept whole and together, and the large file starts a new part.
+	if got := parts[0].entries; len(got) != 2 || got[0] != "a.txt" || got[1] != "b.txt" {
+		t.Errorf("First part mismatch: got %v", got)
+	}
+	if got := parts[len(parts)-1].entries; got[len(got)-1] != "c.txt" {
+		t.Errorf("Last part should end with c.txt, got %v", got)
+	}
+
+	var segments []string
+	for i, part := range parts {
+		count, err := measureOutput(formatSerializer, part.files, partOptions(opts, parts, i))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if count > limit {
+			t.Errorf("Part %d has %d tokens, more than %d", i+1, count, limit)
+		}
+
+		for _, file := range part.files {
+			if file.Path == "large.txt" {
+				segments = append(segments, string(file.Content))
+			}
+		}
+	}
+
+	if !strings.HasPrefix(segments[0], fmt.Sprintf("[Grimoire: large.txt is split across %d parts.", len(segments))) {
+		t.Errorf("First segment lacks the split marker: %q", segments[0][:80])
+	}
+	if !strings.Contains(segments[0], "[Grimoire: large.txt continues in part 3.]") {
+		t.Errorf("First segment lacks the continuation marker")
+	}
+	if !strings.HasPrefix(segments[1], "[Grimoire: large.txt continued from part 2.") {
+		t.Errorf("Second segment lacks the continued marker: %q", segments[1][:80])
+	}
+	if !strings.Contains(segments[len(segments)-1], "line 399 of a large file") {
+		t.Errorf("Last segment lacks the end of the file")
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 
@@ -16,73 +17,172 @@ const MaxTraversalDepth = 256
 // Walker defines an interface for traversing directories and returning a list of file paths.
 type Walker interface {
 	Walk() ([]string, error)
+
+	// Source returns the FileSource from which the content of the listed files is read.
+	Source() FileSource
 }
 
 // DefaultWalker is a concrete implementation of Walker that traverses a directory tree
 // starting at targetDir, while filtering files based on allowed extensions, ignored path patterns,
-// and ignore files (.gitignore and .grimoireignore). It also excludes a specific output file.
+// and ignore files (.gitignore and .grimoireignore) with the same precedence and anchoring
+// rules as Git, including ignore files in parent directories up to the repository root,
+// .git/info/exclude and the global excludes file. Binary content is detected by sniffing the
+// start of each candidate file. It also excludes a specific output file.
 type DefaultWalker struct {
+	*fileFilter
+
 	// targetDir is the base directory from which we begin walking.
 	targetDir string
 
+	// repoDir is the root of the Git repository containing targetDir, if any.
+	repoDir string
+
+	// globalExcludesFile is the path of the user's global Git excludes file, if any.
+	globalExcludesFile string
+}
+
+// fileFilter holds the filters shared by every Walker implementation.
+type fileFilter struct {
 	// outputFile is the absolute path of the file to exclude from the results.
 	outputFile string
 
 	// allowedFileExtensions is a set of allowed file extensions.
 	allowedFileExtensions map[string]bool
 
+	// allowedFileNames is a set of file names that are allowed regardless of extension.
+	allowedFileNames map[string]bool
+
+	// shebangInterpreters is a set of interpreters whose extensionless scripts are allowed.
+	shebangInterpreters map[string]bool
+
+	// anyText includes any file whose content is text, regardless of extension.
+	anyText bool
+
 	// ignoredPathRegexes is a slice of compiled regular expressions for paths that should be ignored.
 	ignoredPathRegexes []*regexp.Regexp
+
+	// keepFileNames is a set of file names that ignoredPathRegexes only apply to the
+	// directory of.
+	keepFileNames map[string]bool
+
+	// includes, if non-nil, is an allowlist: only files matching it are returned.
+	includes *gitignore.GitIgnore
+
+	// excludes, if non-nil, matches files and directories that should be skipped.
+	excludes *gitignore.GitIgnore
+
+	// source is used to read the start of candidate files for sniffing.
+	source FileSource
 }
 
-// NewDefaultWalker constructs and returns a new DefaultWalker configured with the given parameters.
-func NewDefaultWalker(targetDir string, allowedFileExtensions map[string]bool, ignoredPathRegexes []*regexp.Regexp, outputFile string) *DefaultWalker {
+// WalkerOptions holds the filtering options for a Walker.
+type WalkerOptions struct {
+	// AllowedFileExtensions is the set of file extensions to include.
+	AllowedFileExtensions map[string]bool
+
+	// AllowedFileNames is the set of file names to include regardless of extension.
+	AllowedFileNames map[string]bool
+
+	// ShebangInterpreters is the set of interpreters whose extensionless scripts are included,
+	// based on the file's shebang line. If empty, shebang detection is disabled.
+	ShebangInterpreters map[string]bool
+
+	// AnyText includes any file whose content is text, regardless of extension.
+	AnyText bool
+
+	// IgnoredPathRegexes is a slice of regular expressions for paths that should be ignored.
+	IgnoredPathRegexes []*regexp.Regexp
+
+	// KeepFileNames is the set of file names that IgnoredPathRegexes are matched against
+	// the directory of only, so that patterns matching the name itself do not apply.
+	KeepFileNames map[string]bool
+
+	// IncludePatterns is a list of gitignore-style patterns. If non-empty, only files
+	// matching at least one pattern are returned.
+	IncludePatterns []string
+
+	// ExcludePatterns is a list of gitignore-style patterns for files and directories to skip.
+	ExcludePatterns []string
+
+	// OutputFile is the absolute path of the file to exclude from the results.
+	OutputFile string
+
+	// RepoDir is the root of the Git repository containing the target directory. If set,
+	// ignore files in parent directories up to the repository root, .git/info/exclude
+	// and GlobalExcludesFile are honored as well.
+	RepoDir string
+
+	// GlobalExcludesFile is the path of the user's global Git excludes file (core.excludesFile).
+	GlobalExcludesFile string
+}
+
+// NewDefaultWalker constructs and returns a new DefaultWalker rooted at targetDir
+// and configured with the given options.
+func NewDefaultWalker(targetDir string, opts WalkerOptions) *DefaultWalker {
 	return &DefaultWalker{
-		targetDir:             targetDir,
-		allowedFileExtensions: allowedFileExtensions,
-		ignoredPathRegexes:    ignoredPathRegexes,
-		outputFile:            outputFile,
+		fileFilter:         newFileFilter(opts, dirSource(targetDir)),
+		targetDir:          targetDir,
+		repoDir:            opts.RepoDir,
+		globalExcludesFile: opts.GlobalExcludesFile,
+	}
+}
+
+// newFileFilter compiles the filtering options into a fileFilter that sniffs files read
+// from source.
+func newFileFilter(opts WalkerOptions, source FileSource) *fileFilter {
+	f := &fileFilter{
+		allowedFileExtensions: opts.AllowedFileExtensions,
+		allowedFileNames:      opts.AllowedFileNames,
+		shebangInterpreters:   opts.ShebangInterpreters,
+		anyText:               opts.AnyText,
+		ignoredPathRegexes:    opts.IgnoredPathRegexes,
+		keepFileNames:         opts.KeepFileNames,
+		outputFile:            opts.OutputFile,
+		source:                source,
+	}
+
+	if len(opts.IncludePatterns) > 0 {
+		f.includes = gitignore.CompileIgnoreLines(opts.IncludePatterns...)
+	}
+	if len(opts.ExcludePatterns) > 0 {
+		f.excludes = gitignore.CompileIgnoreLines(opts.ExcludePatterns...)
 	}
+
+	return f
 }
 
 // Walk initiates a recursive traversal starting at targetDir.
 // It returns a slice of file paths (relative to targetDir) that meet the specified filtering criteria.
 func (dw *DefaultWalker) Walk() ([]string, error) {
 	var files []string
-	// Start traversal with no inherited ignore rules.
-	if err := dw.traverse(dw.targetDir, nil, &files, 0); err != nil {
+	// Start traversal with the ignore rules that apply from outside targetDir, if any.
+	inheritedIgnores := loadRepositoryIgnoreRules(dw.repoDir, dw.targetDir, dw.globalExcludesFile)
+	if err := dw.traverse(dw.targetDir, inheritedIgnores, &files, 0); err != nil {
 		return nil, fmt.Errorf("directory traversal failed: %w", err)
 	}
 	return files, nil
 }
 
+// Source returns a FileSource that reads files from targetDir.
+func (dw *DefaultWalker) Source() FileSource {
+	return dirSource(dw.targetDir)
+}
+
 // traverse walks the directory tree starting at the given directory.
 // It accumulates ignore rules from any local .gitignore and .grimoireignore files,
-// applies the allowed extension and ignored path regex filters,
-// and appends any qualifying file paths (relative to targetDir) to the files slice.
-func (dw *DefaultWalker) traverse(dir string, inheritedIgnores []*gitignore.GitIgnore, files *[]string, depth int) error {
+// each anchored to the directory it lives in, applies the allowed extension and
+// ignored path regex filters, and appends any qualifying file paths (relative to
+// targetDir) to the files slice.
+func (dw *DefaultWalker) traverse(dir string, inheritedIgnores []*ignoreRules, files *[]string, depth int) error {
 	// Check if maximum depth has been reached
 	if depth >= MaxTraversalDepth {
 		return fmt.Errorf("maximum directory depth of %d exceeded at %s", MaxTraversalDepth, dir)
 	}
 
-	// Start with the ignore rules inherited from parent directories.
-	currentIgnores := append([]*gitignore.GitIgnore{}, inheritedIgnores...)
-
-	// Define the names of local ignore files to check.
-	ignoreFilenames := []string{".gitignore", ".grimoireignore"}
-
-	// For each ignore file, if it exists in the current directory, compile and add its rules.
-	for _, ignoreFilename := range ignoreFilenames {
-		ignorePath := filepath.Join(dir, ignoreFilename)
-		if info, err := os.Stat(ignorePath); err == nil && !info.IsDir() {
-			if gi, err := gitignore.CompileIgnoreFile(ignorePath); err == nil {
-				currentIgnores = append(currentIgnores, gi)
-			} else {
-				log.Warn().Err(err).Msgf("Error parsing ignore file at %s", ignorePath)
-			}
-		}
-	}
+	// Start with the ignore rules inherited from parent directories, and add the rules
+	// of any ignore files in the current directory, which take precedence over them.
+	currentIgnores := append([]*ignoreRules{}, inheritedIgnores...)
+	currentIgnores = append(currentIgnores, loadDirectoryIgnoreRules(dir)...)
 
 	// Read all entries (files and directories) in the current directory.
 	entries, err := os.ReadDir(dir)
@@ -104,32 +204,18 @@ func (dw *DefaultWalker) traverse(dir string, inheritedIgnores []*gitignore.GitI
 		// Normalize the relative path to use forward slashes.
 		relPath = filepath.ToSlash(relPath)
 
-		// Exclude the specific output file from being processed.
-		if fullPath == dw.outputFile {
+		// Exclude the output file and paths matching the ignored regex patterns.
+		if dw.skipPath(fullPath, relPath) {
 			continue
 		}
 
-		// Check if the relative path matches any of the default ignored regex patterns.
-		skipByPattern := false
-		for _, r := range dw.ignoredPathRegexes {
-			if r.MatchString(relPath) {
-				skipByPattern = true
-				break
-			}
-		}
-		if skipByPattern {
+		// Check the cumulative ignore rules (from .gitignore and .grimoireignore files).
+		if isIgnored(currentIgnores, fullPath, entry.IsDir()) {
 			continue
 		}
 
-		// Check the cumulative ignore rules (from .gitignore and .grimoireignore files).
-		skipByGitignore := false
-		for _, gi := range currentIgnores {
-			if gi.MatchesPath(relPath) {
-				skipByGitignore = true
-				break
-			}
-		}
-		if skipByGitignore {
+		// Check the explicit exclude patterns.
+		if dw.excludes != nil && dw.excludes.MatchesPath(relPath) {
 			continue
 		}
 
@@ -139,9 +225,8 @@ func (dw *DefaultWalker) traverse(dir string, inheritedIgnores []*gitignore.GitI
 				return err
 			}
 		} else {
-			// For files, check whether their extension is allowed.
-			ext := filepath.Ext(entry.Name())
-			if dw.allowedFileExtensions[ext] {
+			// For files, check the include allowlist and whether the file is allowed and contains text.
+			if dw.includeFile(relPath, entry.Name()) {
 				// Append the file's relative path to the list.
 				*files = append(*files, relPath)
 			}
@@ -150,3 +235,88 @@ func (dw *DefaultWalker) traverse(dir string, inheritedIgnores []*gitignore.GitI
 
 	return nil
 }
+
+// skipPath reports whether a file or directory should be skipped because it is the
+// output file or matches one of the ignored path regexes. Only the directory of a file
+// whose name is kept is matched, so that patterns matching its name do not apply.
+func (f *fileFilter) skipPath(fullPath, relPath string) bool {
+	// Exclude the specific output file from being processed.
+	if fullPath == f.outputFile {
+		return true
+	}
+
+	matchPath := relPath
+	if f.keepFileNames[path.Base(relPath)] {
+		dir := path.Dir(relPath)
+		if dir == "." {
+			return false
+		}
+		matchPath = dir + "/"
+	}
+
+	// Check if the relative path matches any of the default ignored regex patterns.
+	for _, r := range f.ignoredPathRegexes {
+		if r.MatchString(matchPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isCandidate reports whether a file may be included based on its path alone, before its
+// content is read. Files must match the include allowlist, if any, and have an allowed
+// extension or name, have no extension while shebang detection is enabled, or any-text
+// mode must be enabled.
+func (f *fileFilter) isCandidate(relPath, name string) bool {
+	if f.includes != nil && !f.includes.MatchesPath(relPath) {
+		return false
+	}
+
+	ext := filepath.Ext(name)
+	return f.allowedFileExtensions[ext] || f.allowedFileNames[name] ||
+		(ext == "" && len(f.shebangInterpreters) > 0) || f.anyText
+}
+
+// includeFile reports whether a file should be included. A candidate file, as reported by
+// isCandidate, is included if its extension or name is allowed, if it has no extension and
+// its shebang line names an allowed interpreter, or if any-text mode is enabled. Its start
+// is read from the filter's source and sniffed, and binary content is excluded with a
+// logged reason.
+func (f *fileFilter) includeFile(relPath, name string) bool {
+	// Avoid reading files that cannot be included.
+	if !f.isCandidate(relPath, name) {
+		return false
+	}
+
+	ext := filepath.Ext(name)
+	allowed := f.allowedFileExtensions[ext] || f.allowedFileNames[name]
+	checkShebang := ext == "" && len(f.shebangInterpreters) > 0
+
+	head, err := f.source.ReadHead(relPath)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Skipping file %s: failed to read content", relPath)
+		return false
+	}
+
+	if !allowed && checkShebang {
+		allowed = f.shebangInterpreters[parseShebangInterpreter(string(head))]
+	}
+
+	if !allowed && !f.anyText {
+		return false
+	}
+
+	if binary, reason := sniffBinary(head); binary {
+		// Binary files are expected among arbitrary files in any-text mode, so only
+		// warn about those that were selected by extension, name or shebang.
+		logFn := log.Debug
+		if allowed {
+			logFn = log.Warn
+		}
+		logFn().Msgf("Skipping binary file %s: %s", relPath, reason)
+		return false
+	}
+
+	return true
+}
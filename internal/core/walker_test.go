@@ -0,0 +1,285 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/config"
+)
+
+// writeFiles writes each of files, keyed by path relative to dir, creating directories
+// as needed.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func TestWalkerIncludeExclude(t *testing.T) {
+	targetDir := t.TempDir()
+	writeFiles(t, targetDir, map[string]string{
+		"main.go":                    "package main",
+		"main_test.go":               "package main",
+		"README.md":                  "readme",
+		"internal/core/run.go":       "package core",
+		"internal/core/run_test.go":  "package core",
+		"internal/core/notes.md":     "notes",
+		"internal/gen/gen.go":        "package gen",
+		"internal/gen/deep/deep.go":  "package deep",
+		"cmd/grimoire/main.go":       "package main",
+		"cmd/grimoire/main_test.go":  "package main",
+		"internal/util/util_test.go": "package util",
+	})
+
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:    "Include a recursive glob",
+			include: []string{"internal/**/*.go"},
+			expected: []string{
+				"internal/core/run.go", "internal/core/run_test.go", "internal/gen/deep/deep.go",
+				"internal/gen/gen.go", "internal/util/util_test.go",
+			},
+		},
+		{
+			name:    "Exclude test files anywhere",
+			exclude: []string{"**/*_test.go"},
+			expected: []string{
+				"README.md", "cmd/grimoire/main.go", "internal/core/notes.md", "internal/core/run.go",
+				"internal/gen/deep/deep.go", "internal/gen/gen.go", "main.go",
+			},
+		},
+		{
+			name:    "Exclude a directory",
+			exclude: []string{"internal/gen/"},
+			expected: []string{
+				"README.md", "cmd/grimoire/main.go", "cmd/grimoire/main_test.go", "internal/core/notes.md",
+				"internal/core/run.go", "internal/core/run_test.go", "internal/util/util_test.go", "main.go",
+				"main_test.go",
+			},
+		},
+		{
+			name:     "Exclude takes precedence over include",
+			include:  []string{"internal/**/*.go", "*.md"},
+			exclude:  []string{"**/*_test.go", "gen/"},
+			expected: []string{"README.md", "internal/core/notes.md", "internal/core/run.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walker := NewDefaultWalker(targetDir, WalkerOptions{
+				AllowedFileExtensions: map[string]bool{".go": true, ".md": true},
+				IncludePatterns:       tt.include,
+				ExcludePatterns:       tt.exclude,
+			})
+
+			got, err := walker.Walk()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slicesAreEqual(got, tt.expected) {
+				t.Errorf("Walked files mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWalkerResolvedExtensions(t *testing.T) {
+	targetDir := t.TempDir()
+	writeFiles(t, targetDir, map[string]string{
+		"main.go":      "package main",
+		"README.md":    "readme",
+		"schema.proto": "syntax = \"proto3\";",
+		"infra.hcl":    "resource {}",
+		"query.sql":    "select 1;",
+	})
+
+	tests := []struct {
+		name     string
+		layers   []*config.Settings
+		expected []string
+	}{
+		{
+			name:     "Defaults",
+			expected: []string{"README.md", "main.go", "query.sql", "schema.proto"},
+		},
+		{
+			name: "Per-run --ext and --no-ext",
+			layers: []*config.Settings{
+				{AddExtensions: []string{"hcl"}, RemoveExtensions: []string{".proto", "sql"}},
+			},
+			expected: []string{"README.md", "infra.hcl", "main.go"},
+		},
+		{
+			name: "--ext re-adds an extension removed by a lower layer",
+			layers: []*config.Settings{
+				{RemoveExtensions: []string{"md", "sql"}},
+				{AddExtensions: []string{".md"}},
+			},
+			expected: []string{"README.md", "main.go", "schema.proto"},
+		},
+		{
+			name: "--ext on top of a replaced list",
+			layers: []*config.Settings{
+				{Extensions: []string{"go"}},
+				{AddExtensions: []string{"hcl"}},
+			},
+			expected: []string{"infra.hcl", "main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := config.NewResolver()
+			for _, layer := range tt.layers {
+				resolver.Apply(layer, config.Source{Layer: config.LayerFlag})
+			}
+
+			walker := NewDefaultWalker(targetDir, WalkerOptions{
+				AllowedFileExtensions: resolver.Settings().ResolveExtensions(),
+			})
+
+			got, err := walker.Walk()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slicesAreEqual(got, tt.expected) {
+				t.Errorf("Walked files mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWalkerDefaultIgnoredPaths(t *testing.T) {
+	targetDir := t.TempDir()
+	writeFiles(t, targetDir, map[string]string{
+		".env":                           "SECRET=1",
+		".env.local":                     "SECRET=1",
+		".env.qa":                        "SECRET=1",
+		".env.uat":                       "SECRET=1",
+		".env.secret":                    "SECRET=1",
+		".env.preprod":                   "SECRET=1",
+		"app/.env.staging":               "SECRET=1",
+		".env.example":                   "SECRET=",
+		"app/.env.sample":                "SECRET=",
+		".env.template":                  "SECRET=",
+		".env.dist":                      "SECRET=",
+		"node_modules/pkg/.env.example":  "SECRET=",
+		"bin/tool":                       "#!/bin/sh\necho tool\n",
+		"bin/app":                        "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+		"bin/Debug/net8.0/app.deps.go":   "package main",
+		"bin/Release/net8.0/app.deps.go": "package main",
+		"src/App/bin/Debug/generated.go": "package app",
+		"cmd/bin/app.go":                 "package main",
+		"main.go":                        "package main",
+	})
+
+	regexes := make([]*regexp.Regexp, len(config.DefaultIgnoredPathPatterns))
+	for i, pattern := range config.DefaultIgnoredPathPatterns {
+		regexes[i] = regexp.MustCompile(pattern)
+	}
+	allowedFileNames := map[string]bool{".env.local": true}
+	for _, name := range config.DefaultAllowedFileNames {
+		allowedFileNames[name] = true
+	}
+	keepFileNames := make(map[string]bool)
+	for _, name := range config.DefaultKeepFileNames {
+		keepFileNames[name] = true
+	}
+
+	tests := []struct {
+		name          string
+		keepFileNames map[string]bool
+		expected      []string
+	}{
+		{
+			name:          "Default kept file names",
+			keepFileNames: keepFileNames,
+			expected: []string{
+				".env.dist", ".env.example", ".env.template", "app/.env.sample", "bin/tool", "cmd/bin/app.go",
+				"main.go",
+			},
+		},
+		{
+			name:     "No kept file names",
+			expected: []string{"bin/tool", "cmd/bin/app.go", "main.go"},
+		},
+		{
+			name:          "Custom kept file name",
+			keepFileNames: map[string]bool{".env.local": true},
+			expected:      []string{".env.local", "bin/tool", "cmd/bin/app.go", "main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walker := NewDefaultWalker(targetDir, WalkerOptions{
+				AllowedFileExtensions: map[string]bool{".go": true},
+				AllowedFileNames:      allowedFileNames,
+				ShebangInterpreters:   map[string]bool{"sh": true},
+				IgnoredPathRegexes:    regexes,
+				KeepFileNames:         tt.keepFileNames,
+			})
+
+			got, err := walker.Walk()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slicesAreEqual(got, tt.expected) {
+				t.Errorf("Walked files mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWalkerAnyText(t *testing.T) {
+	targetDir := t.TempDir()
+	writeFiles(t, targetDir, map[string]string{
+		"main.go":       "package main",
+		"scripts/build": "#!/usr/bin/env crystal\nputs \"build\"\n",
+		"NOTICE":        "Copyright the authors.\n",
+		"data/blob":     "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+		"data/random":   "\x01\x02\x03\x00\xfe\xfd",
+		"logo.png":      "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+	})
+
+	tests := []struct {
+		name     string
+		anyText  bool
+		expected []string
+	}{
+		{name: "By extension only", expected: []string{"main.go"}},
+		{name: "Any text", anyText: true, expected: []string{"NOTICE", "main.go", "scripts/build"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walker := NewDefaultWalker(targetDir, WalkerOptions{
+				AllowedFileExtensions: map[string]bool{".go": true},
+				AnyText:               tt.anyText,
+			})
+
+			got, err := walker.Walk()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slicesAreEqual(got, tt.expected) {
+				t.Errorf("Walked files mismatch: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
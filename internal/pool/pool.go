@@ -0,0 +1,81 @@
+package pool
+
+import (
+	"runtime"
+	"sync"
+)
+
+// DefaultJobs returns the default number of concurrent jobs, which is the number of CPUs.
+func DefaultJobs() int {
+	return runtime.NumCPU()
+}
+
+// Ordered processes n items on a bounded pool of jobs workers, calling process for each
+// index concurrently, and calls emit with the results strictly in index order from the
+// calling goroutine. At most twice as many results as there are workers are held while
+// waiting for an earlier one, so slow emitters bound memory use.
+//
+// If emit returns an error or panics, no further items are started, and the error is
+// returned or the panic resumed once the items already in progress have finished.
+func Ordered[T any](n, jobs int, process func(i int) T, emit func(i int, result T) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// Each result gets its own buffered channel so workers never block on delivery.
+	results := make([]chan T, n)
+	for i := range results {
+		results[i] = make(chan T, 1)
+	}
+
+	// window limits how far workers may run ahead of the emitter.
+	window := make(chan struct{}, 2*jobs)
+	indices := make(chan int)
+	done := make(chan struct{})
+
+	// Dispatch indices to the workers as window slots become available.
+	go func() {
+		defer close(indices)
+		for i := 0; i < n; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case indices <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	// Stop dispatching and wait for the workers on return, including when emit panics.
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] <- process(i)
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < n; i++ {
+		result := <-results[i]
+		<-window
+		if err = emit(i, result); err != nil {
+			break
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestOrdered(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		jobs int
+	}{
+		{name: "No items", n: 0, jobs: 4},
+		{name: "Single worker", n: 50, jobs: 1},
+		{name: "More workers than items", n: 3, jobs: 16},
+		{name: "Many items", n: 500, jobs: 8},
+		{name: "Non-positive jobs", n: 10, jobs: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var emitted []int
+			err := Ordered(tt.n, tt.jobs, func(i int) int {
+				// Finish items out of order.
+				time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+				return i * i
+			}, func(i int, result int) error {
+				if result != i*i {
+					t.Errorf("Result mismatch for %d: got %d, want %d", i, result, i*i)
+				}
+				emitted = append(emitted, i)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(emitted) != tt.n {
+				t.Fatalf("Emitted %d items, want %d", len(emitted), tt.n)
+			}
+			for i, got := range emitted {
+				if got != i {
+					t.Fatalf("Items emitted out of order: got %v", emitted)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderedStopsOnError(t *testing.T) {
+	errStop := errors.New("stop")
+
+	emitted := 0
+	err := Ordered(1000, 4, func(i int) int {
+		return i
+	}, func(i int, result int) error {
+		emitted++
+		if i == 10 {
+			return errStop
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected stop error, got %v", err)
+	}
+	if emitted != 11 {
+		t.Errorf("Expected 11 items to be emitted, got %d", emitted)
+	}
+}
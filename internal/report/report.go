@@ -0,0 +1,280 @@
+// Package report builds and writes reports of the size of the files that would be
+// included in an output, per file and per directory, so that users can decide what to
+// exclude before sending the output to a model.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Formats lists the supported report formats.
+var Formats = []string{"table", "json", "csv"}
+
+// Entry is the size of a file, or of all files in a directory.
+type Entry struct {
+	// Path is the path of the file or directory relative to the target directory.
+	// Directory paths end with a slash.
+	Path string `json:"path"`
+
+	// Files is the number of files in a directory, including its subdirectories, or 1
+	// for a file.
+	Files int `json:"files"`
+
+	// Bytes is the size in bytes of the processed content.
+	Bytes int `json:"bytes"`
+
+	// Lines is the number of lines of the processed content.
+	Lines int `json:"lines"`
+
+	// Tokens is the token count of the processed content.
+	Tokens int `json:"tokens"`
+
+	// Percent is the share of the total tokens, from 0 to 100.
+	Percent float64 `json:"percent"`
+
+	// Churn is the churn score of a file, or the sum of the churn scores of the files in
+	// a directory. It is omitted if zero or if churn scores are unavailable.
+	Churn float64 `json:"churn,omitempty"`
+}
+
+// Report describes the size of the files of an output.
+type Report struct {
+	// Target is the directory that paths are relative to.
+	Target string `json:"target"`
+
+	// Tokenizer describes how tokens were counted.
+	Tokenizer string `json:"tokenizer"`
+
+	// Total is the size of all files. Its path is empty.
+	Total Entry `json:"total"`
+
+	// Directories lists every directory containing files, by descending token count.
+	Directories []Entry `json:"directories"`
+
+	// Files lists every file, by descending token count.
+	Files []Entry `json:"files"`
+
+	// HasChurn indicates whether entries have churn scores, which adds a churn column to
+	// tables and CSV.
+	HasChurn bool `json:"-"`
+}
+
+// Build returns a report of the given file measurements. churn holds the churn score of
+// each file keyed by its path with forward slashes, or is nil if churn scores are
+// unavailable. Files and directories are sorted by descending token count, then by path.
+func Build(target, tokenizer string, stats []serializer.FileStats, churn map[string]float64) *Report {
+	r := &Report{
+		Target:      target,
+		Tokenizer:   tokenizer,
+		Directories: []Entry{},
+		Files:       make([]Entry, 0, len(stats)),
+		HasChurn:    churn != nil,
+	}
+
+	directories := make(map[string]*Entry)
+
+	for _, fileStats := range stats {
+		filePath := filepath.ToSlash(fileStats.Path)
+		entry := Entry{
+			Path:   filePath,
+			Files:  1,
+			Bytes:  fileStats.Bytes,
+			Lines:  fileStats.Lines,
+			Tokens: fileStats.Tokens,
+			Churn:  churn[filePath],
+		}
+		r.Files = append(r.Files, entry)
+		r.Total.add(entry)
+
+		// Add the file to each of its ancestor directories.
+		for dir := path.Dir(filePath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			dirEntry, ok := directories[dir]
+			if !ok {
+				dirEntry = &Entry{Path: dir + "/"}
+				directories[dir] = dirEntry
+			}
+			dirEntry.add(entry)
+		}
+	}
+
+	for _, dirEntry := range directories {
+		r.Directories = append(r.Directories, *dirEntry)
+	}
+
+	for _, entries := range [][]Entry{r.Files, r.Directories} {
+		for i := range entries {
+			entries[i].Percent = percentOf(entries[i].Tokens, r.Total.Tokens)
+		}
+		sortEntries(entries)
+	}
+	if r.Total.Tokens > 0 {
+		r.Total.Percent = 100
+	}
+
+	return r
+}
+
+// add adds the size of a file to the entry.
+func (e *Entry) add(file Entry) {
+	e.Files += file.Files
+	e.Bytes += file.Bytes
+	e.Lines += file.Lines
+	e.Tokens += file.Tokens
+	e.Churn += file.Churn
+}
+
+// percentOf returns part as a percentage of total, rounded to two decimals.
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
+
+// sortEntries sorts entries by descending token count, then by path.
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tokens != entries[j].Tokens {
+			return entries[i].Tokens > entries[j].Tokens
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// Write writes the report to w in the given format, one of Formats.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		return r.writeTable(w)
+	case "json":
+		return r.writeJSON(w)
+	case "csv":
+		return r.writeCSV(w)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeTable writes the report as aligned, human-readable tables of directories and files.
+func (r *Report) writeTable(w io.Writer) error {
+	p := message.NewPrinter(language.English)
+
+	var b strings.Builder
+	p.Fprintf(&b, "Token report for %s (%s)\n", r.Target, r.Tokenizer)
+	p.Fprintf(&b, "Total: %d files, %d bytes, %d lines, %d tokens\n", r.Total.Files, r.Total.Bytes, r.Total.Lines, r.Total.Tokens)
+
+	sections := []struct {
+		title     string
+		entries   []Entry
+		showFiles bool
+	}{
+		{title: "Directories", entries: r.Directories, showFiles: true},
+		{title: "Files", entries: r.Files},
+	}
+
+	for _, section := range sections {
+		if len(section.entries) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s\n\n", section.title)
+
+		// Numbers are right-aligned, and an empty column separates them from the paths.
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+		header := "TOKENS\t%\t"
+		if section.showFiles {
+			header += "FILES\t"
+		}
+		header += "LINES\tBYTES\t"
+		if r.HasChurn {
+			header += "CHURN\t"
+		}
+		fmt.Fprintln(tw, header+"\tPATH")
+
+		for _, entry := range section.entries {
+			p.Fprintf(tw, "%d\t%.2f%%\t", entry.Tokens, entry.Percent)
+			if section.showFiles {
+				p.Fprintf(tw, "%d\t", entry.Files)
+			}
+			p.Fprintf(tw, "%d\t%d\t", entry.Lines, entry.Bytes)
+			if r.HasChurn {
+				p.Fprintf(tw, "%.2f\t", entry.Churn)
+			}
+			fmt.Fprintf(tw, "\t%s\n", entry.Path)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeJSON writes the report as an indented JSON object.
+func (r *Report) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// writeCSV writes the report as CSV, with a row per directory and per file after a row
+// for the total. The type column is "total", "directory" or "file", and a churn column
+// is added if entries have churn scores.
+func (r *Report) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"type", "path", "files", "bytes", "lines", "tokens", "percent"}
+	if r.HasChurn {
+		header = append(header, "churn")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	rows := []struct {
+		kind    string
+		entries []Entry
+	}{
+		{kind: "total", entries: []Entry{r.Total}},
+		{kind: "directory", entries: r.Directories},
+		{kind: "file", entries: r.Files},
+	}
+
+	for _, row := range rows {
+		for _, entry := range row.entries {
+			record := []string{
+				row.kind,
+				entry.Path,
+				strconv.Itoa(entry.Files),
+				strconv.Itoa(entry.Bytes),
+				strconv.Itoa(entry.Lines),
+				strconv.Itoa(entry.Tokens),
+				strconv.FormatFloat(entry.Percent, 'f', 2, 64),
+			}
+			if r.HasChurn {
+				record = append(record, strconv.FormatFloat(entry.Churn, 'f', 2, 64))
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
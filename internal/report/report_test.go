@@ -0,0 +1,157 @@
+package report
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/serializer"
+)
+
+func TestBuild(t *testing.T) {
+	stats := []serializer.FileStats{
+		{Path: "README.md", Bytes: 100, Lines: 10, Tokens: 25},
+		{Path: "internal/core/run.go", Bytes: 400, Lines: 40, Tokens: 100},
+		{Path: "internal/core/walk.go", Bytes: 200, Lines: 20, Tokens: 50},
+		{Path: "internal/pool/pool.go", Bytes: 100, Lines: 10, Tokens: 25},
+	}
+
+	r := Build("/repo", "o200k_base encoding", stats, nil)
+
+	wantTotal := Entry{Files: 4, Bytes: 800, Lines: 80, Tokens: 200, Percent: 100}
+	if r.Total != wantTotal {
+		t.Errorf("Total mismatch: got %+v, want %+v", r.Total, wantTotal)
+	}
+
+	wantDirectories := []Entry{
+		{Path: "internal/", Files: 3, Bytes: 700, Lines: 70, Tokens: 175, Percent: 87.5},
+		{Path: "internal/core/", Files: 2, Bytes: 600, Lines: 60, Tokens: 150, Percent: 75},
+		{Path: "internal/pool/", Files: 1, Bytes: 100, Lines: 10, Tokens: 25, Percent: 12.5},
+	}
+	if !reflect.DeepEqual(r.Directories, wantDirectories) {
+		t.Errorf("Directories mismatch:\ngot  %+v\nwant %+v", r.Directories, wantDirectories)
+	}
+
+	var paths []string
+	for _, entry := range r.Files {
+		paths = append(paths, entry.Path)
+	}
+	wantPaths := []string{"internal/core/run.go", "internal/core/walk.go", "README.md", "internal/pool/pool.go"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("File order mismatch: got %v, want %v", paths, wantPaths)
+	}
+}
+
+func TestBuildChurn(t *testing.T) {
+	stats := []serializer.FileStats{
+		{Path: "a/b.go", Bytes: 1200, Lines: 30, Tokens: 300},
+		{Path: "a/c.go", Bytes: 400, Lines: 10, Tokens: 100},
+		{Path: "d.txt", Bytes: 400, Lines: 10, Tokens: 100},
+	}
+	r := Build("/repo", "o200k_base encoding", stats, map[string]float64{"a/b.go": 2.5, "a/c.go": 0.25})
+
+	if r.Directories[0].Churn != 2.75 {
+		t.Errorf("Directory churn mismatch: got %v, want %v", r.Directories[0].Churn, 2.75)
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "table",
+			want: []string{
+				"  TOKENS       %  FILES  LINES  BYTES  CHURN  PATH\n     400  80.00%      2     40  1,600   2.75  a/\n",
+				"     100  20.00%     10    400   0.00  d.txt\n",
+			},
+		},
+		{
+			format: "csv",
+			want: []string{
+				"type,path,files,bytes,lines,tokens,percent,churn\n",
+				"file,a/b.go,1,1200,30,300,60.00,2.50\n",
+			},
+		},
+		{
+			format: "json",
+			want: []string{
+				`"churn": 2.5`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := r.Write(&buf, tt.format); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output lacks %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := Build("/repo", "o200k_base encoding", []serializer.FileStats{
+		{Path: "a/b.go", Bytes: 1200, Lines: 30, Tokens: 300},
+		{Path: "c, d.txt", Bytes: 400, Lines: 10, Tokens: 100},
+	}, nil)
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "table",
+			want: []string{
+				"Token report for /repo (o200k_base encoding)",
+				"Total: 2 files, 1,600 bytes, 40 lines, 400 tokens",
+				"  TOKENS       %  FILES  LINES  BYTES  PATH\n     300  75.00%      1     30  1,200  a/\n",
+				"  TOKENS       %  LINES  BYTES  PATH\n     300  75.00%     30  1,200  a/b.go\n     100  25.00%     10    400  c, d.txt\n",
+			},
+		},
+		{
+			format: "csv",
+			want: []string{
+				"type,path,files,bytes,lines,tokens,percent\n",
+				"total,,2,1600,40,400,100.00\n",
+				"directory,a/,1,1200,30,300,75.00\n",
+				"file,a/b.go,1,1200,30,300,75.00\n",
+				"file,\"c, d.txt\",1,400,10,100,25.00\n",
+			},
+		},
+		{
+			format: "json",
+			want: []string{
+				`"tokenizer": "o200k_base encoding"`,
+				`"path": "a/b.go",`,
+				`"percent": 75`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := r.Write(&buf, tt.format); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output lacks %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+
+	if err := r.Write(&bytes.Buffer{}, "yaml"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/zricethezav/gitleaks/v8/config"
 	"github.com/zricethezav/gitleaks/v8/detect"
-	"github.com/zricethezav/gitleaks/v8/sources"
 )
 
 //go:embed gitleaks.toml
@@ -45,30 +44,28 @@ func NewDetector() (*Detector, error) {
 	}, nil
 }
 
-// DetectSecretsInFiles scans the provided file paths for secrets
-// Returns a slice of findings and a boolean indicating if any secrets were found
-func (d *Detector) DetectSecretsInFiles(filePaths []string) ([]Finding, bool, error) {
-	if len(filePaths) == 0 {
-		return nil, false, nil
+// DetectSecrets scans the content of the file at path for secrets and returns the findings.
+// The path is used to apply path-based allowlists and is recorded in each finding.
+// It is safe to call concurrently.
+func (d *Detector) DetectSecrets(path string, content []byte) []Finding {
+	if len(content) == 0 {
+		return nil
 	}
 
-	scanTargetChan := make(chan sources.ScanTarget, len(filePaths))
-	for _, path := range filePaths {
-		// Make sure the path is absolute
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Failed to get absolute path for %s", path)
-			absPath = path // Fall back to original path
-		}
-		scanTargetChan <- sources.ScanTarget{Path: absPath}
-	}
-	close(scanTargetChan)
-
-	gitleaksFindings, err := d.detector.DetectFiles(scanTargetChan)
+	// Make sure the path is absolute
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to detect secrets: %w", err)
+		log.Warn().Err(err).Msgf("Failed to get absolute path for %s", path)
+		absPath = path // Fall back to original path
 	}
 
+	gitleaksFindings := d.detector.Detect(detect.Fragment{
+		Raw:       string(content),
+		Bytes:     content,
+		FilePath:  absPath,
+		StartLine: 1,
+	})
+
 	// Convert findings to our simplified format
 	findings := make([]Finding, 0, len(gitleaksFindings))
 	for _, f := range gitleaksFindings {
@@ -80,5 +77,5 @@ func (d *Detector) DetectSecretsInFiles(filePaths []string) ([]Finding, bool, er
 		})
 	}
 
-	return findings, len(findings) > 0, nil
+	return findings
 }
@@ -0,0 +1,97 @@
+package serializer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeSet describes the changes that the files of an output were selected from, such as
+// the changes since a Git ref.
+type ChangeSet struct {
+	// Description describes what the changes are relative to, such as "since main".
+	Description string
+
+	// Deleted lists the paths of deleted files.
+	Deleted []string
+
+	// Renamed lists renamed files.
+	Renamed []Rename
+}
+
+// Rename is a file that was moved from one path to another.
+type Rename struct {
+	// From is the previous path of the file.
+	From string `json:"from"`
+
+	// To is the new path of the file.
+	To string `json:"to"`
+}
+
+// changesNotice returns the summary line that explains that the output only contains
+// changed files, or an empty string if it contains all files.
+func changesNotice(opts SerializeOptions) string {
+	if opts.Changes == nil {
+		return ""
+	}
+	return fmt.Sprintf("- This file only contains the files changed %s. Each file is marked with its change status, and deleted and renamed files are listed in the changes section.\n", opts.Changes.Description)
+}
+
+// changesText returns the deleted and renamed files of a change set as plain text.
+func changesText(changes *ChangeSet) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "Changes %s.\n", changes.Description)
+
+	if len(changes.Deleted) == 0 && len(changes.Renamed) == 0 {
+		builder.WriteString("\nNo files were deleted or renamed.\n")
+		return builder.String()
+	}
+
+	if len(changes.Deleted) > 0 {
+		builder.WriteString("\nDeleted files:\n")
+		for _, path := range changes.Deleted {
+			builder.WriteString("  - ")
+			builder.WriteString(path)
+			builder.WriteString("\n")
+		}
+	}
+
+	if len(changes.Renamed) > 0 {
+		builder.WriteString("\nRenamed files:\n")
+		for _, rename := range changes.Renamed {
+			builder.WriteString("  - ")
+			builder.WriteString(rename.From)
+			builder.WriteString(" -> ")
+			builder.WriteString(rename.To)
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// diffNotice returns the summary line that explains where diffs are, or an empty string
+// if they are not included.
+func diffNotice(opts SerializeOptions) string {
+	switch {
+	case opts.Diffs == DiffPerFile && opts.DiffOnly:
+		return "- Each changed file is shown as a unified diff instead of its full content.\n"
+	case opts.Diffs == DiffPerFile:
+		return "- The unified diff of each changed file follows its full content.\n"
+	case opts.Diffs == DiffCombined && opts.DiffOnly:
+		return "- The changes are shown as a single unified diff instead of the full content of the files.\n"
+	case opts.Diffs == DiffCombined:
+		return "- A single unified diff of all changed files follows the files.\n"
+	default:
+		return ""
+	}
+}
+
+// statusLabel returns the change status of a file for display, such as "modified" or
+// "renamed from old/path.go", or an empty string if the file has no status.
+func statusLabel(status, oldPath string) string {
+	if oldPath != "" {
+		return status + " from " + oldPath
+	}
+	return status
+}
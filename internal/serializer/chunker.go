@@ -0,0 +1,152 @@
+package serializer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/foresturquhart/grimoire/internal/tokens"
+)
+
+// Chunk is a contiguous range of lines of a file, sized to fit a token budget.
+type Chunk struct {
+	// Index is the position of the chunk within its file, starting at 0.
+	Index int
+
+	// StartLine is the first line of the chunk, starting at 1.
+	StartLine int
+
+	// EndLine is the last line of the chunk, inclusive.
+	EndLine int
+
+	// Tokens is the token count of Content.
+	Tokens int
+
+	// Content is the text of the chunk.
+	Content string
+}
+
+// reFunctionStart matches lines that commonly start a function, method, class or type
+// definition in popular languages.
+var reFunctionStart = regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(pub(\([a-z]+\))?\s+)?(async\s+)?(func|function|def|class|fn|impl|interface|struct|enum|trait|module|type|public|private|protected|internal|static|sub)\b`)
+
+// reCommentLine matches lines that hold only a comment or an annotation, which are kept
+// together with the definition that follows them.
+var reCommentLine = regexp.MustCompile(`^\s*(//|#|/\*|\*|--|@|;;)`)
+
+// ChunkContent splits content into chunks of at most maxTokens tokens, where consecutive
+// chunks share up to overlap tokens of whole lines. Chunks end at line boundaries, and a
+// boundary before a blank line or a function start (together with its leading comments)
+// is preferred over filling a chunk completely. A single line that exceeds maxTokens on
+// its own is cut at token boundaries. Token counts of individual lines are approximate,
+// so the token count of each chunk is measured on its final content.
+func ChunkContent(content string, maxTokens, overlap int) ([]Chunk, error) {
+	if maxTokens <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", maxTokens)
+	}
+	if content == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(content, "\n")
+
+	// Count the tokens of each line, including its newline.
+	lineTokens := make([]int, len(lines))
+	for i, line := range lines {
+		count, err := tokens.CountTokens(line + "\n")
+		if err != nil {
+			return nil, err
+		}
+		lineTokens[i] = count
+	}
+
+	var chunks []Chunk
+	addChunk := func(startLine, endLine int, text string) error {
+		count, err := tokens.CountTokens(text)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, Chunk{
+			Index:     len(chunks),
+			StartLine: startLine,
+			EndLine:   endLine,
+			Tokens:    count,
+			Content:   text,
+		})
+		return nil
+	}
+
+	for start := 0; start < len(lines); {
+		// Grow the chunk by whole lines while it fits.
+		end, total := start, 0
+		for end < len(lines) && total+lineTokens[end] <= maxTokens {
+			total += lineTokens[end]
+			end++
+		}
+
+		// A line that does not fit on its own is cut at token boundaries.
+		if end == start {
+			pieces, err := tokens.SplitText(lines[start], maxTokens)
+			if err != nil {
+				return nil, err
+			}
+			for _, piece := range pieces {
+				if err := addChunk(start+1, start+1, piece); err != nil {
+					return nil, err
+				}
+			}
+			start++
+			continue
+		}
+
+		if end < len(lines) {
+			end = preferredBoundary(lines, lineTokens, start, end, maxTokens)
+		}
+
+		if err := addChunk(start+1, end, strings.Join(lines[start:end], "\n")); err != nil {
+			return nil, err
+		}
+
+		if end == len(lines) {
+			break
+		}
+
+		// Start the next chunk with as many trailing lines as fit in the overlap,
+		// while always making progress.
+		next, repeated := end, 0
+		for next-1 > start && repeated+lineTokens[next-1] <= overlap {
+			repeated += lineTokens[next-1]
+			next--
+		}
+		start = next
+	}
+
+	return chunks, nil
+}
+
+// preferredBoundary returns the end (exclusive) of the chunk lines[start:end] that has
+// been filled to capacity, moved back to the latest blank line or function start found
+// in its second half, if any. A function start also takes the comment lines directly
+// above it into the next chunk.
+func preferredBoundary(lines []string, lineTokens []int, start, end, maxTokens int) int {
+	// Only consider boundaries that keep the chunk at least half full.
+	minEnd, filled := start, 0
+	for minEnd < end && filled < maxTokens/2 {
+		filled += lineTokens[minEnd]
+		minEnd++
+	}
+
+	for boundary := end; boundary > minEnd; boundary-- {
+		if reFunctionStart.MatchString(lines[boundary]) {
+			for boundary-1 > minEnd && reCommentLine.MatchString(lines[boundary-1]) {
+				boundary--
+			}
+			return boundary
+		}
+		if strings.TrimSpace(lines[boundary-1]) == "" {
+			return boundary
+		}
+	}
+
+	return end
+}
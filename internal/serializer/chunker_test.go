@@ -0,0 +1,98 @@
+package serializer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestChunkContent(t *testing.T) {
+	var builder strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&builder, "// helper%d returns its index.\nfunc helper%d() int {\n\treturn %d\n}\n\n", i, i, i)
+	}
+	content := strings.TrimSpace(builder.String())
+	lines := strings.Split(content, "\n")
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		overlap   int
+	}{
+		{name: "Without overlap", maxTokens: 100, overlap: 0},
+		{name: "With overlap", maxTokens: 100, overlap: 20},
+		{name: "Single chunk", maxTokens: 100000, overlap: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := ChunkContent(content, tt.maxTokens, tt.overlap)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(chunks) == 0 {
+				t.Fatalf("Expected chunks, got none")
+			}
+
+			if chunks[0].StartLine != 1 || chunks[len(chunks)-1].EndLine != len(lines) {
+				t.Errorf("Chunks do not cover the content: first starts at %d, last ends at %d of %d lines",
+					chunks[0].StartLine, chunks[len(chunks)-1].EndLine, len(lines))
+			}
+
+			for i, chunk := range chunks {
+				if chunk.Index != i {
+					t.Errorf("Chunk %d has index %d", i, chunk.Index)
+				}
+				if chunk.Tokens > tt.maxTokens {
+					t.Errorf("Chunk %d has %d tokens, exceeding %d", i, chunk.Tokens, tt.maxTokens)
+				}
+				if want := strings.Join(lines[chunk.StartLine-1:chunk.EndLine], "\n"); chunk.Content != want {
+					t.Errorf("Chunk %d content does not match lines %d-%d", i, chunk.StartLine, chunk.EndLine)
+				}
+
+				if i == 0 {
+					continue
+				}
+				previous := chunks[i-1]
+				if chunk.StartLine <= previous.StartLine || chunk.StartLine > previous.EndLine+1 {
+					t.Errorf("Chunk %d starts at line %d after chunk ending at line %d", i, chunk.StartLine, previous.EndLine)
+				}
+				if tt.overlap == 0 && chunk.StartLine != previous.EndLine+1 {
+					t.Errorf("Chunk %d overlaps the previous chunk without overlap", i)
+				}
+
+				// Chunks should be cut before a function's doc comment, or after a blank line.
+				first := lines[chunk.StartLine-1]
+				if tt.overlap == 0 && !strings.HasPrefix(first, "// helper") && strings.TrimSpace(lines[chunk.StartLine-2]) != "" {
+					t.Errorf("Chunk %d starts at a hard cut: %q", i, first)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkContentLongLine(t *testing.T) {
+	content := strings.Repeat("word ", 500)
+
+	chunks, err := ChunkContent(content, 50, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected the line to be split, got %d chunks", len(chunks))
+	}
+
+	var joined strings.Builder
+	for _, chunk := range chunks {
+		if chunk.StartLine != 1 || chunk.EndLine != 1 {
+			t.Errorf("Chunk %d spans lines %d-%d, want 1-1", chunk.Index, chunk.StartLine, chunk.EndLine)
+		}
+		if chunk.Tokens > 50 {
+			t.Errorf("Chunk %d has %d tokens, exceeding 50", chunk.Index, chunk.Tokens)
+		}
+		joined.WriteString(chunk.Content)
+	}
+	if joined.String() != content {
+		t.Errorf("Split chunks do not reassemble the line")
+	}
+}
@@ -0,0 +1,209 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JSONSerializer provides methods to write multiple files' contents into a single
+// JSON document for post-processing by scripts. The document is written as it is
+// encoded: metadata and the directory tree first, followed by one object per file. The
+// files themselves are already in memory.
+type JSONSerializer struct{}
+
+// NewJSONSerializer returns a new instance of JSONSerializer.
+func NewJSONSerializer() *JSONSerializer {
+	return &JSONSerializer{}
+}
+
+// jsonMetadata is the metadata object at the start of a JSON document.
+type jsonMetadata struct {
+	Generator   string         `json:"generator"`
+	Version     string         `json:"version"`
+	GeneratedAt string         `json:"generated_at"`
+	Target      string         `json:"target"`
+	Redacted    bool           `json:"redacted"`
+	Omitted     []string       `json:"omitted_files,omitempty"`
+	Changes     *jsonChanges   `json:"changes,omitempty"`
+	Part        *jsonPart      `json:"part,omitempty"`
+	Config      map[string]any `json:"config,omitempty"`
+}
+
+// jsonChanges describes the changes that the files were selected from in the metadata of
+// a JSON document.
+type jsonChanges struct {
+	Description string   `json:"description"`
+	Deleted     []string `json:"deleted"`
+	Renamed     []Rename `json:"renamed"`
+}
+
+// jsonPart identifies the part of a split output in the metadata of a JSON document.
+type jsonPart struct {
+	Index    int        `json:"index"`
+	Count    int        `json:"count"`
+	Manifest [][]string `json:"manifest"`
+}
+
+// jsonTreeNode is a node of the directory tree in a JSON document.
+type jsonTreeNode struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Children []*jsonTreeNode `json:"children,omitempty"`
+	Omitted  bool            `json:"omitted,omitempty"`
+}
+
+// jsonFile is the object written for each file in a JSON document.
+type jsonFile struct {
+	Path       string `json:"path"`
+	Status     string `json:"status,omitempty"`
+	OldPath    string `json:"old_path,omitempty"`
+	Language   string `json:"language"`
+	Size       int64  `json:"size"`
+	Lines      int    `json:"lines"`
+	Tokens     *int   `json:"tokens"`
+	Redactions int    `json:"redactions"`
+	Content    string `json:"content"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+// Serialize writes the processed records of files to writer as a JSON document with
+// "metadata", "tree" and "files" members. The tree is only included if opts.ShowTree
+// is true, and file token counts are null if token counting is skipped.
+// Records are produced by ProcessFiles, so this only renders them.
+func (s *JSONSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
+	var part *jsonPart
+	if opts.Part != nil {
+		part = &jsonPart{Index: opts.Part.Index, Count: opts.Part.Count, Manifest: opts.Part.Manifest}
+	}
+
+	var changes *jsonChanges
+	if opts.Changes != nil {
+		// Empty lists are encoded as [] rather than null
+		changes = &jsonChanges{
+			Description: opts.Changes.Description,
+			Deleted:     append([]string{}, opts.Changes.Deleted...),
+			Renamed:     append([]Rename{}, opts.Changes.Renamed...),
+		}
+	}
+
+	metadata, err := s.marshal(jsonMetadata{
+		Generator:   "grimoire",
+		Version:     opts.Version,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Target:      opts.BaseDir,
+		Redacted:    opts.redactionEnabled(),
+		Omitted:     opts.OmittedFiles,
+		Changes:     changes,
+		Part:        part,
+		Config:      opts.ConfigSummary,
+	}, "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(writer, "{\n  \"metadata\": %s,\n", metadata); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	// Add directory tree if requested
+	if opts.ShowTree {
+		rootNode := fileTree(files, opts)
+
+		tree, err := s.marshal(s.convertTree(rootNode).Children, "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode directory tree: %w", err)
+		}
+
+		if _, err := fmt.Fprintf(writer, "  \"tree\": %s,\n", tree); err != nil {
+			return fmt.Errorf("failed to write directory tree: %w", err)
+		}
+	}
+
+	if _, err := writer.Write([]byte("  \"files\": [")); err != nil {
+		return fmt.Errorf("failed to write files opening: %w", err)
+	}
+
+	// Process files concurrently, writing each one in order as soon as it is ready
+	err = ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		file := jsonFile{
+			Path:       record.Path,
+			Status:     record.Status,
+			OldPath:    record.OldPath,
+			Language:   Language(record.Path),
+			Size:       record.Size,
+			Lines:      record.Lines,
+			Redactions: record.Redactions,
+			Content:    record.Content,
+			Diff:       record.Diff,
+		}
+		if !opts.SkipTokenCount {
+			file.Tokens = &record.Tokens
+		}
+
+		encoded, err := s.marshal(file, "    ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", record.Path, err)
+		}
+
+		// Separate files with commas, except before the first one
+		separator := ",\n    "
+		if i == 0 {
+			separator = "\n    "
+		}
+
+		if _, err := fmt.Fprintf(writer, "%s%s", separator, encoded); err != nil {
+			return fmt.Errorf("failed to write content for %s: %w", record.Path, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	closing := "]\n}\n"
+	if len(files) > 0 {
+		closing = "\n  ]\n}\n"
+	}
+
+	if _, err := writer.Write([]byte(closing)); err != nil {
+		return fmt.Errorf("failed to write files closing: %w", err)
+	}
+
+	return nil
+}
+
+// marshal encodes v as indented JSON, with every line after the first prefixed by prefix.
+// Unlike json.MarshalIndent, characters such as < and & are not escaped, since the output
+// is not embedded in HTML.
+func (s *JSONSerializer) marshal(v any, prefix string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(prefix, "  ")
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// convertTree recursively converts a TreeNode into its JSON representation.
+func (s *JSONSerializer) convertTree(node *TreeNode) *jsonTreeNode {
+	converted := &jsonTreeNode{Name: node.Name, Type: "file", Omitted: node.Omitted}
+	if node.IsDir {
+		converted.Type = "directory"
+		converted.Children = make([]*jsonTreeNode, 0, len(node.Children))
+	}
+
+	for _, child := range node.Children {
+		converted.Children = append(converted.Children, s.convertTree(child))
+	}
+
+	return converted
+}
@@ -0,0 +1,76 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSerializer(t *testing.T) {
+	files := []SourceFile{
+		{Path: "cmd/main.go", Content: []byte("package main\n\nfunc main() {}\n")},
+		{Path: "web/index.html", Content: []byte("<p>\"a\" & b</p>")},
+	}
+
+	var buf bytes.Buffer
+	err := NewJSONSerializer().Serialize(&buf, files, SerializeOptions{
+		BaseDir:                "/repo",
+		ShowTree:               true,
+		LargeFileSizeThreshold: 1 << 20,
+		Jobs:                   2,
+		Version:                "1.2.3",
+		ConfigSummary:          map[string]any{"format": "json"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var document struct {
+		Metadata struct {
+			Version string         `json:"version"`
+			Target  string         `json:"target"`
+			Config  map[string]any `json:"config"`
+		} `json:"metadata"`
+		Tree []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Children []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"children"`
+		} `json:"tree"`
+		Files []struct {
+			Path     string `json:"path"`
+			Language string `json:"language"`
+			Size     int64  `json:"size"`
+			Lines    int    `json:"lines"`
+			Tokens   *int   `json:"tokens"`
+			Content  string `json:"content"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if document.Metadata.Version != "1.2.3" || document.Metadata.Target != "/repo" || document.Metadata.Config["format"] != "json" {
+		t.Errorf("Metadata mismatch: got %+v", document.Metadata)
+	}
+
+	if len(document.Tree) != 2 || document.Tree[0].Name != "cmd" || document.Tree[0].Type != "directory" ||
+		len(document.Tree[0].Children) != 1 || document.Tree[0].Children[0].Type != "file" {
+		t.Errorf("Tree mismatch: got %+v", document.Tree)
+	}
+
+	if len(document.Files) != 2 {
+		t.Fatalf("Got %d files, want 2", len(document.Files))
+	}
+
+	main := document.Files[0]
+	if main.Path != "cmd/main.go" || main.Language != "go" || main.Size != 29 || main.Lines != 3 || main.Tokens == nil || *main.Tokens == 0 {
+		t.Errorf("File mismatch: got %+v", main)
+	}
+
+	if document.Files[1].Content != "<p>\"a\" & b</p>" {
+		t.Errorf("Content mismatch: got %q", document.Files[1].Content)
+	}
+}
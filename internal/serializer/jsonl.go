@@ -0,0 +1,82 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/foresturquhart/grimoire/internal/pool"
+)
+
+// JSONLSerializer provides methods to write files as JSON Lines, one record per chunk,
+// for retrieval pipelines that index a codebase in pieces. Each file is split into
+// chunks of a configurable token size with ChunkContent.
+type JSONLSerializer struct{}
+
+// NewJSONLSerializer returns a new instance of JSONLSerializer.
+func NewJSONLSerializer() *JSONLSerializer {
+	return &JSONLSerializer{}
+}
+
+// jsonlChunk is the record written for each chunk.
+type jsonlChunk struct {
+	Path      string `json:"path"`
+	Status    string `json:"status,omitempty"`
+	OldPath   string `json:"old_path,omitempty"`
+	Chunk     int    `json:"chunk"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+	Content   string `json:"content"`
+}
+
+// chunkedRecord is a processed file together with its chunks.
+type chunkedRecord struct {
+	record *FileRecord
+	chunks []Chunk
+	err    error
+}
+
+// Serialize splits the processed records of files into chunks of at most opts.ChunkTokens
+// tokens, overlapping by opts.ChunkOverlap tokens, and writes one JSON object per line for
+// each chunk, in file order. There is no header, summary or directory tree.
+func (s *JSONLSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
+	// Process and chunk files concurrently, writing each one in order as soon as it is ready
+	return pool.Ordered(len(files), opts.Jobs, func(i int) chunkedRecord {
+		record := processFile(files[i], opts)
+		chunks, err := ChunkContent(record.Content, opts.ChunkTokens, opts.ChunkOverlap)
+		return chunkedRecord{record: record, chunks: chunks, err: err}
+	}, func(i int, result chunkedRecord) error {
+		reportRecord(result.record, opts)
+
+		if result.err != nil {
+			return fmt.Errorf("failed to chunk %s: %w", result.record.Path, result.err)
+		}
+
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+
+		for _, chunk := range result.chunks {
+			if err := encoder.Encode(jsonlChunk{
+				Path:      result.record.Path,
+				Status:    result.record.Status,
+				OldPath:   result.record.OldPath,
+				Chunk:     chunk.Index,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Tokens:    chunk.Tokens,
+				Content:   chunk.Content,
+			}); err != nil {
+				return fmt.Errorf("failed to encode chunk %d of %s: %w", chunk.Index, result.record.Path, err)
+			}
+		}
+
+		if _, err := writer.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write chunks for %s: %w", result.record.Path, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,119 @@
+package serializer
+
+import (
+	"path"
+	"strings"
+)
+
+// languagesByExtension maps lowercase file extensions to language identifiers, using the
+// names commonly understood by syntax highlighters.
+var languagesByExtension = map[string]string{
+	".bash":       "bash",
+	".bat":        "batch",
+	".c":          "c",
+	".cc":         "cpp",
+	".cfg":        "ini",
+	".cjs":        "javascript",
+	".clj":        "clojure",
+	".cljs":       "clojure",
+	".cmake":      "cmake",
+	".conf":       "ini",
+	".cpp":        "cpp",
+	".cs":         "csharp",
+	".css":        "css",
+	".cxx":        "cpp",
+	".dart":       "dart",
+	".diff":       "diff",
+	".dockerfile": "dockerfile",
+	".el":         "elisp",
+	".erl":        "erlang",
+	".ex":         "elixir",
+	".exs":        "elixir",
+	".fish":       "fish",
+	".fs":         "fsharp",
+	".go":         "go",
+	".gradle":     "groovy",
+	".graphql":    "graphql",
+	".groovy":     "groovy",
+	".h":          "c",
+	".hcl":        "hcl",
+	".hpp":        "cpp",
+	".hs":         "haskell",
+	".htm":        "html",
+	".html":       "html",
+	".ini":        "ini",
+	".java":       "java",
+	".jl":         "julia",
+	".js":         "javascript",
+	".json":       "json",
+	".jsx":        "jsx",
+	".kt":         "kotlin",
+	".kts":        "kotlin",
+	".less":       "less",
+	".lua":        "lua",
+	".m":          "objectivec",
+	".markdown":   "markdown",
+	".md":         "markdown",
+	".mjs":        "javascript",
+	".ml":         "ocaml",
+	".nix":        "nix",
+	".php":        "php",
+	".pl":         "perl",
+	".proto":      "protobuf",
+	".ps1":        "powershell",
+	".py":         "python",
+	".r":          "r",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".sass":       "sass",
+	".scala":      "scala",
+	".scss":       "scss",
+	".sh":         "bash",
+	".sql":        "sql",
+	".svelte":     "svelte",
+	".swift":      "swift",
+	".tf":         "hcl",
+	".toml":       "toml",
+	".ts":         "typescript",
+	".tsx":        "tsx",
+	".vue":        "vue",
+	".xml":        "xml",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".zig":        "zig",
+	".zsh":        "zsh",
+}
+
+// languagesByFilename maps well-known file names to language identifiers.
+var languagesByFilename = map[string]string{
+	"Dockerfile":     "dockerfile",
+	"Containerfile":  "dockerfile",
+	"Makefile":       "makefile",
+	"GNUmakefile":    "makefile",
+	"CMakeLists.txt": "cmake",
+	"Jenkinsfile":    "groovy",
+	"Rakefile":       "ruby",
+	"Gemfile":        "ruby",
+	"Vagrantfile":    "ruby",
+	"go.mod":         "go.mod",
+	"go.work":        "go.work",
+	".bashrc":        "bash",
+	".zshrc":         "zsh",
+	".env.example":   "dotenv",
+}
+
+// Language returns the language identifier of the file at the given path, based on its
+// file name or extension, or an empty string if the language is not known.
+func Language(filePath string) string {
+	name := path.Base(filePath)
+	if language, ok := languagesByFilename[name]; ok {
+		return language
+	}
+	// Variants such as Dockerfile.dev are named after their base file
+	if base, _, found := strings.Cut(name, "."); found {
+		if language, ok := languagesByFilename[base]; ok {
+			return language
+		}
+	}
+	return languagesByExtension[strings.ToLower(path.Ext(name))]
+}
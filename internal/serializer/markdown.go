@@ -3,18 +3,13 @@ package serializer
 import (
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
-
-	"github.com/foresturquhart/grimoire/internal/tokens"
-	"github.com/rs/zerolog/log"
 )
 
 // MarkdownSerializer provides methods to write multiple files' contents into a
 // Markdown-formatted document. Each file is written under an H2 heading,
-// and its content is placed inside a fenced code block.
+// and its content is placed inside a fenced code block tagged with its language.
 type MarkdownSerializer struct{}
 
 // NewMarkdownSerializer returns a new instance of MarkdownSerializer.
@@ -22,17 +17,10 @@ func NewMarkdownSerializer() *MarkdownSerializer {
 	return &MarkdownSerializer{}
 }
 
-// Serialize takes a list of file paths relative to baseDir, reads and normalizes
-// each file's content, and writes them to writer in Markdown format. If reading
-// any file fails, it logs a warning and skips that file.
-// If showTree is true, it prepends a directory tree visualization.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// largeFileSizeThreshold defines the size in bytes above which a file is considered "large"
-// and a warning will be logged.
-// highTokenThreshold defines the token count above which a file is considered
-// to have a high token count and a warning will be logged.
-// skipTokenCount indicates whether to skip token counting entirely for warnings.
-func (s *MarkdownSerializer) Serialize(writer io.Writer, baseDir string, filePaths []string, showTree bool, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) error {
+// Serialize writes the processed records of files to writer in Markdown format.
+// If opts.ShowTree is true, it prepends a directory tree visualization.
+// Records are produced by ProcessFiles, so this only renders them.
+func (s *MarkdownSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
 	// Write the header with timestamp
 	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
 	header := fmt.Sprintf("This document contains a structured representation of the entire codebase, merging all files into a single Markdown file.\n\nGenerated by Grimoire on: %s\n\n", timestamp)
@@ -49,13 +37,17 @@ func (s *MarkdownSerializer) Serialize(writer io.Writer, baseDir string, filePat
 	summary += "- When processing this file, use the file path headings to distinguish between different files.\n"
 	summary += "- This file may contain sensitive information and should be handled with appropriate care.\n"
 
-	if redactionInfo != nil && redactionInfo.Enabled {
+	if opts.redactionEnabled() {
 		summary += "- Detected secrets have been redacted with the format [REDACTED SECRET: description].\n"
 	}
 
 	summary += "- Some files may have been excluded based on .gitignore rules and Grimoire's configuration.\n"
+	summary += omittedNotice(opts)
+	summary += changesNotice(opts)
+	summary += diffNotice(opts)
+	summary += partNotice(opts)
 
-	if showTree {
+	if opts.ShowTree {
 		summary += "- The file begins with this summary, followed by the directory structure, and then includes all codebase files.\n\n"
 	} else {
 		summary += "- The file begins with this summary, followed by all codebase files.\n\n"
@@ -65,10 +57,25 @@ func (s *MarkdownSerializer) Serialize(writer io.Writer, baseDir string, filePat
 		return fmt.Errorf("failed to write summary: %w", err)
 	}
 
+	// Add the manifest if the output is split into parts
+	if opts.Part != nil {
+		manifest := "## Manifest\n\n" + manifestText(opts.Part) + "\n"
+		if _, err := writer.Write([]byte(manifest)); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	// List deleted and renamed files if only changed files are included
+	if opts.Changes != nil {
+		changes := "## Changes\n\n" + changesText(opts.Changes) + "\n"
+		if _, err := writer.Write([]byte(changes)); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
+	}
+
 	// Add directory tree if requested
-	if showTree && len(filePaths) > 0 {
-		treeGen := NewDefaultTreeGenerator()
-		rootNode := treeGen.GenerateTree(filePaths)
+	if opts.ShowTree && len(files) > 0 {
+		rootNode := fileTree(files, opts)
 
 		treeContent := "## Directory Structure\n\n"
 		treeContent += s.renderTreeAsMarkdownList(rootNode, 0)
@@ -80,50 +87,99 @@ func (s *MarkdownSerializer) Serialize(writer io.Writer, baseDir string, filePat
 	}
 
 	// Write files heading
-	filesHeading := "## Files\n\n"
-	if _, err := writer.Write([]byte(filesHeading)); err != nil {
-		return fmt.Errorf("failed to write files heading: %w", err)
+	if opts.showFiles() {
+		filesHeading := "## Files\n\n"
+		if _, err := writer.Write([]byte(filesHeading)); err != nil {
+			return fmt.Errorf("failed to write files heading: %w", err)
+		}
 	}
 
-	// Process each file
-	for i, relPath := range filePaths {
-		// Write the heading (e.g. ## path/to/file.ext)
-		heading := fmt.Sprintf("### File: %s\n\n", relPath)
-		if _, err := writer.Write([]byte(heading)); err != nil {
-			return fmt.Errorf("failed to write heading for %s: %w", relPath, err)
-		}
+	// Diffs of all files, collected for a combined diff section
+	var combinedDiff []string
 
-		// Read and normalize file content
-		content, isLargeFile, err := s.readAndNormalizeContent(baseDir, relPath, redactionInfo, largeFileSizeThreshold, highTokenThreshold, skipTokenCount)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Skipping file %s due to read error", relPath)
-			continue
+	// Process files concurrently, writing each one in order as soon as it is ready
+	err := ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		relPath := record.Path
+
+		if opts.Diffs == DiffCombined && record.Diff != "" {
+			combinedDiff = append(combinedDiff, record.Diff)
+		}
+		if !opts.showFiles() {
+			return nil
 		}
 
-		if isLargeFile {
-			log.Warn().Msgf("File %s exceeds the large file threshold (%d bytes). Including in output but this may impact performance.", relPath, largeFileSizeThreshold)
+		// Write the heading (e.g. ## path/to/file.ext), with the change status if any
+		heading := "### File: " + relPath
+		if label := statusLabel(record.Status, record.OldPath); label != "" {
+			heading += " (" + label + ")"
+		}
+		heading += "\n\n"
+		if _, err := writer.Write([]byte(heading)); err != nil {
+			return fmt.Errorf("failed to write heading for %s: %w", relPath, err)
 		}
 
-		// Check if the file is minified (only applicable file type)
-		if IsMinifiedFile(content, relPath, DefaultMinifiedFileThresholds) {
-			log.Warn().Msgf("File %s appears to be minified. Consider excluding it to reduce token counts.", relPath)
+		// Wrap content in a fenced code block that the content cannot close, tagged with
+		// its language for syntax highlighting, followed by the diff if included
+		var blocks []string
+		if !opts.DiffOnly || record.Diff == "" {
+			fence := codeFence(record.Content)
+			blocks = append(blocks, fmt.Sprintf("%s%s\n%s\n%s", fence, Language(relPath), record.Content, fence))
 		}
+		if opts.Diffs == DiffPerFile && record.Diff != "" {
+			fence := codeFence(record.Diff)
+			blocks = append(blocks, fmt.Sprintf("%sdiff\n%s\n%s", fence, record.Diff, fence))
+		}
+		formattedContent := strings.Join(blocks, "\n\n")
 
-		// Wrap content in fenced code block
-		formattedContent := fmt.Sprintf("```\n%s\n```", content)
 		// Add an extra blank line between files, except for the last one
-		if i < len(filePaths)-1 {
+		if i < len(files)-1 {
 			formattedContent += "\n\n"
 		}
 
 		if _, err := writer.Write([]byte(formattedContent)); err != nil {
 			return fmt.Errorf("failed to write content for %s: %w", relPath, err)
 		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the combined diff after the files
+	if len(combinedDiff) > 0 {
+		diff := strings.Join(combinedDiff, "\n")
+		fence := codeFence(diff)
+		section := fmt.Sprintf("## Diff\n\n%sdiff\n%s\n%s", fence, diff, fence)
+		if opts.showFiles() && len(files) > 0 {
+			section = "\n\n" + section
+		}
+
+		if _, err := writer.Write([]byte(section)); err != nil {
+			return fmt.Errorf("failed to write diff: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// codeFence returns a backtick fence for a fenced code block wrapping content. The fence
+// is at least three backticks long, and longer than the longest run of backticks in
+// content, so that no line of content can close the block early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	return strings.Repeat("`", max(3, longest+1))
+}
+
 // renderTreeAsMarkdownList recursively builds a nested Markdown list representation of the tree.
 // This is specific to the Markdown serializer's formatting needs.
 func (s *MarkdownSerializer) renderTreeAsMarkdownList(node *TreeNode, depth int) string {
@@ -148,6 +204,11 @@ func (s *MarkdownSerializer) renderTreeAsMarkdownList(node *TreeNode, depth int)
 			builder.WriteString("/")
 		}
 
+		// Mark files that were left out of the output
+		if node.Omitted {
+			builder.WriteString(" (omitted)")
+		}
+
 		builder.WriteString("\n")
 	}
 
@@ -163,62 +224,3 @@ func (s *MarkdownSerializer) renderTreeAsMarkdownList(node *TreeNode, depth int)
 
 	return builder.String()
 }
-
-// readAndNormalizeContent reads a file from baseDir/relPath and normalizes its
-// content by trimming surrounding whitespace and trailing spaces on each line.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// It also checks if the file exceeds the large file size threshold and returns a flag if it does.
-func (s *MarkdownSerializer) readAndNormalizeContent(baseDir, relPath string, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) (string, bool, error) {
-	fullPath := filepath.Join(baseDir, relPath)
-
-	// Check file size before reading
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to stat file %s: %w", fullPath, err)
-	}
-
-	// Check if file exceeds large file threshold
-	isLargeFile := fileInfo.Size() > largeFileSizeThreshold
-
-	contentBytes, err := os.ReadFile(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to read file %s: %w", fullPath, err)
-	}
-
-	// Convert bytes to string and normalize
-	content := string(contentBytes)
-	normalizedContent := s.normalizeContent(content)
-
-	// If redaction is enabled, redact any secrets
-	if redactionInfo != nil && redactionInfo.Enabled {
-		fileFindings := GetFindingsForFile(redactionInfo, relPath, baseDir)
-		if len(fileFindings) > 0 {
-			normalizedContent = RedactSecrets(normalizedContent, fileFindings)
-		}
-	}
-
-	// Count tokens for this file and warn if it exceeds the threshold
-	if !skipTokenCount && highTokenThreshold > 0 {
-		tokenCount, err := tokens.CountFileTokens(relPath, normalizedContent)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Failed to count tokens for file %s", relPath)
-		} else if tokenCount > highTokenThreshold {
-			log.Warn().Msgf("File %s has a high token count (%d tokens, threshold: %d). This will consume significant LLM context.", relPath, tokenCount, highTokenThreshold)
-		}
-	}
-
-	return normalizedContent, isLargeFile, nil
-}
-
-// normalizeContent trims surrounding whitespace and trailing spaces from each line
-// of the input text, then returns the transformed string.
-func (s *MarkdownSerializer) normalizeContent(content string) string {
-	content = strings.TrimSpace(content)
-	lines := strings.Split(content, "\n")
-
-	for i, line := range lines {
-		lines[i] = strings.TrimRight(line, " \t")
-	}
-
-	return strings.Join(lines, "\n")
-}
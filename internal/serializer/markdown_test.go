@@ -0,0 +1,66 @@
+package serializer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownSerializerFences(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		content   string
+		wantBlock string
+	}{
+		{
+			name:      "Plain Go source",
+			path:      "main.go",
+			content:   "package main",
+			wantBlock: "```go\npackage main\n```",
+		},
+		{
+			name:      "Markdown with a fenced block",
+			path:      "docs/README.md",
+			content:   "# Usage\n\n```bash\ngrimoire .\n```",
+			wantBlock: "````markdown\n# Usage\n\n```bash\ngrimoire .\n```\n````",
+		},
+		{
+			name:      "Long backtick run inside a line",
+			path:      "web/App.tsx",
+			content:   "const s = `a` + ``````;",
+			wantBlock: "```````tsx\nconst s = `a` + ``````;\n```````",
+		},
+		{
+			name:      "Dockerfile variant",
+			path:      "deploy/Dockerfile.dev",
+			content:   "FROM scratch",
+			wantBlock: "```dockerfile\nFROM scratch\n```",
+		},
+		{
+			name:      "Unknown language",
+			path:      "data.unknownext",
+			content:   "x",
+			wantBlock: "```\nx\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []SourceFile{{Path: tt.path, Content: []byte(tt.content)}}
+
+			var buf bytes.Buffer
+			err := NewMarkdownSerializer().Serialize(&buf, files, SerializeOptions{
+				LargeFileSizeThreshold: 1 << 20,
+				SkipTokenCount:         true,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !strings.HasSuffix(buf.String(), "### File: "+tt.path+"\n\n"+tt.wantBlock) {
+				t.Errorf("Code block mismatch: got output ending in\n%s\nwant\n%s", buf.String()[max(0, buf.Len()-200):], tt.wantBlock)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package serializer
+
+import (
+	"strings"
+
+	"github.com/foresturquhart/grimoire/internal/pool"
+)
+
+// FileStats are the measurements of a file after the content-processing stage.
+type FileStats struct {
+	// Path is the path of the file relative to the base directory.
+	Path string
+
+	// Bytes is the size in bytes of the processed content, including its diff if any.
+	Bytes int
+
+	// Lines is the number of lines of the processed content, including its diff if any.
+	Lines int
+
+	// Tokens is the token count of the processed content, including its diff if any.
+	Tokens int
+}
+
+// MeasureFiles runs the content-processing stage over files on a pool of opts.Jobs workers
+// and returns the measurements of each processed file, in the order of files. Tokens are
+// counted even if opts.SkipTokenCount is set, and no warnings about the files are logged.
+func MeasureFiles(files []SourceFile, opts SerializeOptions) []FileStats {
+	opts.SkipTokenCount = false
+
+	stats := make([]FileStats, len(files))
+	_ = pool.Ordered(len(files), opts.Jobs, func(i int) FileStats {
+		record := processFile(files[i], opts)
+		fileStats := FileStats{
+			Path:   record.Path,
+			Bytes:  len(record.Content),
+			Lines:  record.Lines,
+			Tokens: record.Tokens,
+		}
+		if record.Diff != "" {
+			fileStats.Bytes += len(record.Diff)
+			fileStats.Lines += strings.Count(record.Diff, "\n") + 1
+		}
+		return fileStats
+	}, func(i int, fileStats FileStats) error {
+		stats[i] = fileStats
+		return nil
+	})
+
+	return stats
+}
+
+// MeasureTokens returns the token count of each file after the content-processing stage,
+// in the order of files, as measured by MeasureFiles.
+func MeasureTokens(files []SourceFile, opts SerializeOptions) []int {
+	counts := make([]int, len(files))
+	for i, fileStats := range MeasureFiles(files, opts) {
+		counts[i] = fileStats.Tokens
+	}
+
+	return counts
+}
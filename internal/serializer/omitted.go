@@ -0,0 +1,25 @@
+package serializer
+
+// fileTree returns the directory tree of files, together with the files in
+// opts.OmittedFiles marked as omitted.
+func fileTree(files []SourceFile, opts SerializeOptions) *TreeNode {
+	paths := append(FilePaths(files), opts.OmittedFiles...)
+
+	treeGen := NewDefaultTreeGenerator()
+	rootNode := treeGen.GenerateTree(paths)
+	MarkOmitted(rootNode, opts.OmittedFiles)
+
+	return rootNode
+}
+
+// omittedNotice returns the summary line that explains omitted files, or an empty string
+// if there are none.
+func omittedNotice(opts SerializeOptions) string {
+	if len(opts.OmittedFiles) == 0 {
+		return ""
+	}
+	if opts.ShowTree {
+		return "- Some files were omitted to fit a token budget. They are marked as (omitted) in the directory structure.\n"
+	}
+	return "- Some files were omitted to fit a token budget.\n"
+}
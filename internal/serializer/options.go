@@ -0,0 +1,84 @@
+package serializer
+
+// SerializeOptions holds the options that control serialization. New options should be
+// added here rather than as parameters of Serialize.
+type SerializeOptions struct {
+	// BaseDir is the directory that file paths are relative to.
+	BaseDir string
+
+	// ShowTree includes a directory tree visualization before the files.
+	ShowTree bool
+
+	// Redaction, if not nil and enabled, describes the secrets to redact from the output.
+	Redaction *RedactionInfo
+
+	// LargeFileSizeThreshold is the size in bytes above which a file is considered large
+	// and a warning is logged.
+	LargeFileSizeThreshold int64
+
+	// HighTokenThreshold is the token count above which a file is considered to have
+	// a high token count and a warning is logged.
+	HighTokenThreshold int
+
+	// SkipTokenCount skips counting the tokens of each file.
+	SkipTokenCount bool
+
+	// Jobs is the number of files processed concurrently. Output order is unaffected.
+	Jobs int
+
+	// StrictXML makes the xml format produce well-formed XML, with escaped attributes and
+	// content in CDATA sections, instead of the loose LLM-friendly style.
+	StrictXML bool
+
+	// Version is the version of Grimoire, included in formats that carry metadata.
+	Version string
+
+	// ChunkTokens is the maximum number of tokens per chunk, for formats that split files into chunks.
+	ChunkTokens int
+
+	// ChunkOverlap is the number of tokens repeated from the end of one chunk at the
+	// start of the next, for formats that split files into chunks.
+	ChunkOverlap int
+
+	// OmittedFiles lists the paths of files that exist but are left out of the output,
+	// such as files that did not fit a token budget. They appear in the directory tree
+	// marked as omitted.
+	OmittedFiles []string
+
+	// Changes, if not nil, describes the changes that the files were selected from when
+	// the output only contains changed files.
+	Changes *ChangeSet
+
+	// Diffs selects how the diffs of changed files are included: DiffPerFile after each
+	// file, DiffCombined in one section after all files, or DiffNone to leave them out.
+	Diffs string
+
+	// DiffOnly leaves out the content of files that have a diff, so that only the diff is
+	// included. With DiffCombined, the files section is left out entirely.
+	DiffOnly bool
+
+	// Part, if not nil, identifies the part being serialized when the output is split
+	// into several documents.
+	Part *PartInfo
+
+	// ConfigSummary describes the configuration of the run, included in formats that carry metadata.
+	ConfigSummary map[string]any
+}
+
+// Ways of including the diffs of changed files, for SerializeOptions.Diffs.
+const (
+	DiffNone     = ""
+	DiffPerFile  = "file"
+	DiffCombined = "combined"
+)
+
+// showFiles reports whether the files section is included, which it is unless only the
+// combined diff is.
+func (o SerializeOptions) showFiles() bool {
+	return !(o.DiffOnly && o.Diffs == DiffCombined)
+}
+
+// redactionEnabled reports whether secrets should be redacted from the output.
+func (o SerializeOptions) redactionEnabled() bool {
+	return o.Redaction != nil && o.Redaction.Enabled
+}
@@ -0,0 +1,52 @@
+package serializer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PartInfo describes one part of an output that is split into several self-contained documents.
+type PartInfo struct {
+	// Index is the number of this part, starting at 1.
+	Index int
+
+	// Count is the total number of parts.
+	Count int
+
+	// Manifest lists the entries of every part, in order. An entry is a file path,
+	// followed by its range of lines if the file is split across parts.
+	Manifest [][]string
+}
+
+// partNotice returns the summary line that identifies the part, or an empty string if
+// the output is not split.
+func partNotice(opts SerializeOptions) string {
+	if opts.Part == nil {
+		return ""
+	}
+	return fmt.Sprintf("- This file is part %d of %d of the output. The manifest lists the files in every part.\n", opts.Part.Index, opts.Part.Count)
+}
+
+// manifestText returns the manifest of a split output as plain text, listing the
+// entries of each part and marking the current one.
+func manifestText(part *PartInfo) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "This is part %d of %d.\n\n", part.Index, part.Count)
+
+	for i, entries := range part.Manifest {
+		fmt.Fprintf(&builder, "Part %d", i+1)
+		if i+1 == part.Index {
+			builder.WriteString(" (this part)")
+		}
+		builder.WriteString(":\n")
+
+		for _, entry := range entries {
+			builder.WriteString("  - ")
+			builder.WriteString(entry)
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
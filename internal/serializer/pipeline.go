@@ -0,0 +1,163 @@
+package serializer
+
+import (
+	"strings"
+
+	"github.com/foresturquhart/grimoire/internal/pool"
+	"github.com/foresturquhart/grimoire/internal/tokens"
+	"github.com/rs/zerolog/log"
+)
+
+// FileRecord is a file that has been through the content-processing stage and is ready
+// to be rendered by a format.
+type FileRecord struct {
+	// Path is the path of the file relative to the base directory.
+	Path string
+
+	// Content is the normalized content of the file, with secrets redacted if enabled.
+	Content string
+
+	// Status is the change status of the file, or empty if the output contains all files.
+	Status string
+
+	// OldPath is the previous path of a renamed or copied file, or empty.
+	OldPath string
+
+	// Diff is the unified diff of the file without a trailing newline, with secrets
+	// redacted if enabled. It is empty if diffs are not included or the file has none.
+	Diff string
+
+	// Size is the size in bytes of the original file.
+	Size int64
+
+	// Lines is the number of lines of Content.
+	Lines int
+
+	// Redactions is the number of secrets redacted from Content.
+	Redactions int
+
+	// Tokens is the token count of Content and Diff. It is zero if token counting is skipped.
+	Tokens int
+
+	// IsLarge indicates that the file exceeds the large file size threshold.
+	IsLarge bool
+
+	// IsHighTokenCount indicates that the file exceeds the high token threshold.
+	IsHighTokenCount bool
+
+	// IsMinified indicates that the file appears to be minified.
+	IsMinified bool
+}
+
+// ProcessFiles runs the content-processing stage over files on a pool of opts.Jobs workers,
+// and calls render with the record of each file strictly in the order of files, along with
+// its index. Warnings about large, high token count and minified files are logged in the
+// same order. Rendering stops at the first error returned by render.
+func ProcessFiles(files []SourceFile, opts SerializeOptions, render func(i int, record *FileRecord) error) error {
+	return pool.Ordered(len(files), opts.Jobs, func(i int) *FileRecord {
+		return processFile(files[i], opts)
+	}, func(i int, record *FileRecord) error {
+		reportRecord(record, opts)
+		return render(i, record)
+	})
+}
+
+// ProcessContent runs the content-processing stage over file and returns its normalized
+// content, with secrets redacted if enabled. Tokens are not counted.
+func ProcessContent(file SourceFile, opts SerializeOptions) string {
+	opts.SkipTokenCount = true
+	return processFile(file, opts).Content
+}
+
+// reportRecord logs warnings about the conditions flagged on a record.
+func reportRecord(record *FileRecord, opts SerializeOptions) {
+	if record.IsLarge {
+		log.Warn().Msgf("File %s exceeds the large file threshold (%d bytes). Including in output but this may impact performance.", record.Path, opts.LargeFileSizeThreshold)
+	}
+
+	if record.IsHighTokenCount {
+		log.Warn().Msgf("File %s has a high token count (%d tokens, threshold: %d). This will consume significant LLM context.", record.Path, record.Tokens, opts.HighTokenThreshold)
+	}
+
+	if record.IsMinified {
+		log.Warn().Msgf("File %s appears to be minified. Consider excluding it to reduce token counts.", record.Path)
+	}
+}
+
+// processFile normalizes a file's content, redacts secrets if enabled, counts its tokens
+// and checks it for the conditions recorded as flags. It is safe to call concurrently.
+func processFile(file SourceFile, opts SerializeOptions) *FileRecord {
+	record := &FileRecord{
+		Path:    file.Path,
+		Content: normalizeContent(string(file.Content)),
+		Size:    int64(len(file.Content)),
+		Status:  file.Status,
+		OldPath: file.OldPath,
+	}
+
+	// Check if file exceeds large file threshold
+	record.IsLarge = record.Size > opts.LargeFileSizeThreshold
+
+	// Include the diff if requested, leaving out the content if only the diff is wanted
+	if opts.Diffs != DiffNone && len(file.Diff) > 0 {
+		record.Diff = strings.TrimRight(string(file.Diff), "\n")
+		if opts.DiffOnly {
+			record.Content = ""
+		}
+	}
+
+	// If redaction is enabled, redact any secrets
+	if opts.redactionEnabled() {
+		fileFindings := GetFindingsForFile(opts.Redaction, file.Path, opts.BaseDir)
+		if len(fileFindings) > 0 && record.Content != "" {
+			record.Content = RedactSecrets(record.Content, fileFindings)
+			record.Redactions = len(fileFindings)
+		}
+
+		// Secrets in diffs were detected separately, with lines relative to the diff
+		diffFindings := GetFindingsForFile(&RedactionInfo{Enabled: true, Findings: opts.Redaction.DiffFindings}, file.Path, opts.BaseDir)
+		if len(diffFindings) > 0 && record.Diff != "" {
+			record.Diff = RedactSecrets(record.Diff, diffFindings)
+			record.Redactions += len(diffFindings)
+		}
+	}
+
+	if record.Content != "" {
+		record.Lines = strings.Count(record.Content, "\n") + 1
+	}
+
+	// Count tokens for this file and flag it if it exceeds the threshold
+	if !opts.SkipTokenCount {
+		tokenCount, err := tokens.CountFileTokens(file.Path, record.Content)
+		if err == nil && record.Diff != "" {
+			// Diffs are counted as .diff files, whatever the language of the file
+			var diffTokens int
+			diffTokens, err = tokens.CountFileTokens(file.Path+".diff", record.Diff)
+			tokenCount += diffTokens
+		}
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to count tokens for file %s", file.Path)
+		} else {
+			record.Tokens = tokenCount
+			record.IsHighTokenCount = opts.HighTokenThreshold > 0 && tokenCount > opts.HighTokenThreshold
+		}
+	}
+
+	// Check if the file is minified (only applicable file types)
+	record.IsMinified = IsMinifiedFile(record.Content, file.Path, DefaultMinifiedFileThresholds)
+
+	return record
+}
+
+// normalizeContent trims surrounding whitespace and trailing spaces from each line
+// of the input text, then returns the transformed string.
+func normalizeContent(content string) string {
+	content = strings.TrimSpace(content)
+	lines := strings.Split(content, "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,147 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/foresturquhart/grimoire/internal/secrets"
+)
+
+func TestProcessFiles(t *testing.T) {
+	baseDir := t.TempDir()
+
+	var files []SourceFile
+	for i := 0; i < 20; i++ {
+		files = append(files, SourceFile{
+			Path:    fmt.Sprintf("file%02d.go", i),
+			Content: []byte(fmt.Sprintf("\n\npackage p%d   \n\n", i)),
+		})
+	}
+	files = append(files, SourceFile{Path: "secret.go", Content: []byte("key := \"hunter2\"\n")})
+
+	opts := SerializeOptions{
+		BaseDir: baseDir,
+		Redaction: &RedactionInfo{
+			Enabled: true,
+			Findings: []secrets.Finding{
+				{Description: "Password", Secret: "hunter2", File: filepath.Join(baseDir, "secret.go"), Line: 1},
+			},
+			BaseDir: baseDir,
+		},
+		LargeFileSizeThreshold: 16,
+		HighTokenThreshold:     5,
+		Jobs:                   4,
+	}
+
+	var records []*FileRecord
+	err := ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		if record.Path != files[i].Path {
+			t.Errorf("Record %d out of order: got %s, want %s", i, record.Path, files[i].Path)
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(records) != len(files) {
+		t.Fatalf("Got %d records, want %d", len(records), len(files))
+	}
+
+	first := records[0]
+	if first.Content != "package p0" {
+		t.Errorf("Content not normalized: got %q", first.Content)
+	}
+	if first.Size != int64(len(files[0].Content)) {
+		t.Errorf("Size mismatch: got %d, want %d", first.Size, len(files[0].Content))
+	}
+	if !first.IsLarge {
+		t.Errorf("Expected %s to be flagged as large", first.Path)
+	}
+	if first.Tokens == 0 || first.IsHighTokenCount {
+		t.Errorf("Unexpected token count for %s: %d (high: %v)", first.Path, first.Tokens, first.IsHighTokenCount)
+	}
+
+	secret := records[len(records)-1]
+	if secret.Content != "key := \"[REDACTED SECRET: Password]\"" {
+		t.Errorf("Secret not redacted: got %q", secret.Content)
+	}
+	if !secret.IsHighTokenCount {
+		t.Errorf("Expected %s to be flagged as having a high token count (%d tokens)", secret.Path, secret.Tokens)
+	}
+
+	// An error from render stops processing.
+	errStop := errors.New("stop")
+	rendered := 0
+	err = ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		rendered++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || rendered != 1 {
+		t.Errorf("Expected processing to stop after the first error, got %v after %d records", err, rendered)
+	}
+}
+
+func TestProcessFileDiffs(t *testing.T) {
+	baseDir := t.TempDir()
+
+	file := SourceFile{
+		Path:    "config.go",
+		Content: []byte("package config\n"),
+		Status:  "modified",
+		Diff:    []byte("--- a/config.go\n+++ b/config.go\n-key := \"hunter2\"\n+package config\n"),
+	}
+	redaction := &RedactionInfo{
+		Enabled: true,
+		// The secret was only found in the diff, on its third line
+		DiffFindings: []secrets.Finding{
+			{Description: "Password", Secret: "hunter2", File: filepath.Join(baseDir, "config.go"), Line: 3},
+		},
+		BaseDir: baseDir,
+	}
+
+	tests := []struct {
+		name        string
+		opts        SerializeOptions
+		wantContent string
+		wantDiff    string
+	}{
+		{
+			name:        "Diffs not included",
+			opts:        SerializeOptions{},
+			wantContent: "package config",
+		},
+		{
+			name:        "Diff redacted",
+			opts:        SerializeOptions{Diffs: DiffPerFile, Redaction: redaction},
+			wantContent: "package config",
+			wantDiff:    "--- a/config.go\n+++ b/config.go\n-key := \"[REDACTED SECRET: Password]\"\n+package config",
+		},
+		{
+			name:     "Diff only",
+			opts:     SerializeOptions{Diffs: DiffCombined, DiffOnly: true},
+			wantDiff: "--- a/config.go\n+++ b/config.go\n-key := \"hunter2\"\n+package config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.BaseDir = baseDir
+
+			record := processFile(file, opts)
+			if record.Content != tt.wantContent {
+				t.Errorf("Content mismatch: got %q, want %q", record.Content, tt.wantContent)
+			}
+			if record.Diff != tt.wantDiff {
+				t.Errorf("Diff mismatch: got %q, want %q", record.Diff, tt.wantDiff)
+			}
+			if record.Status != "modified" {
+				t.Errorf("Status mismatch: got %q, want %q", record.Status, "modified")
+			}
+		})
+	}
+}
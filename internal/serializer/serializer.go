@@ -21,22 +21,48 @@ type RedactionInfo struct {
 
 	// BaseDir is the base directory, used to normalize paths.
 	BaseDir string
+
+	// DiffFindings contains the secrets detected in the diffs of files. Their lines are
+	// relative to the diffs rather than to the file contents.
+	DiffFindings []secrets.Finding
+}
+
+// SourceFile is a file to be serialized, with its content already read.
+type SourceFile struct {
+	// Path is the path of the file relative to the base directory.
+	Path string
+
+	// Content is the raw content of the file.
+	Content []byte
+
+	// Status is the change status of the file, such as "added" or "modified", when the
+	// output only contains changed files. It is empty otherwise.
+	Status string
+
+	// OldPath is the previous path of a renamed or copied file, or empty.
+	OldPath string
+
+	// Diff is the unified diff of the file when diffs are included, or nil.
+	Diff []byte
+}
+
+// FilePaths returns the paths of the given files, in order.
+func FilePaths(files []SourceFile) []string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	return paths
 }
 
 // Serializer defines an interface for serializing multiple files into a desired format.
 // Implementations should handle the specifics of formatting and output.
 type Serializer interface {
-	// Serialize writes the contents of the specified files, located relative to baseDir,
-	// into the provided writer in a serialized format.
-	// If showTree is true, it includes a directory tree visualization.
-	// If redactionInfo is not nil, secrets should be redacted from the output.
+	// Serialize writes the contents of the specified files into the provided writer in
+	// a serialized format, in the order given. Options such as the directory tree,
+	// redaction and token counting are controlled by opts.
 	// It returns an error if the serialization process fails.
-	// largeFileSizeThreshold defines the size in bytes above which a file is considered "large"
-	// and a warning will be logged.
-	// highTokenThreshold defines the token count above which a file is considered
-	// to have a high token count and a warning will be logged.
-	// skipTokenCount indicates whether to skip token counting entirely for warnings.
-	Serialize(writer io.Writer, baseDir string, filePaths []string, showTree bool, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) error
+	Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error
 }
 
 // NewSerializer creates serializers based on the specified format string
@@ -48,6 +74,10 @@ func NewSerializer(format string) (Serializer, error) {
 		return NewXMLSerializer(), nil
 	case "txt", "text", "plain", "plaintext":
 		return NewPlainTextSerializer(), nil
+	case "json":
+		return NewJSONSerializer(), nil
+	case "jsonl", "ndjson":
+		return NewJSONLSerializer(), nil
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
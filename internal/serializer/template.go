@@ -0,0 +1,307 @@
+package serializer
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinTemplates holds the templates shipped with Grimoire, which reproduce the
+// layouts of the md, xml and txt formats.
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// templateExtension is the file extension of templates.
+const templateExtension = ".tmpl"
+
+// errStopFiles is returned from the render function of ProcessFiles when a template
+// stops ranging over files early.
+var errStopFiles = errors.New("template stopped ranging over files")
+
+// TemplateData is the data model passed to output templates.
+type TemplateData struct {
+	// Generator is the name of the program that generated the output, "grimoire".
+	Generator string
+
+	// Version is the version of Grimoire.
+	Version string
+
+	// GeneratedAt is the time of generation, formatted as RFC 3339 in UTC.
+	GeneratedAt string
+
+	// Target is the directory that file paths are relative to.
+	Target string
+
+	// Redacted indicates that detected secrets have been redacted from file contents.
+	Redacted bool
+
+	// ShowTree indicates that the directory tree was requested.
+	ShowTree bool
+
+	// Config describes the configuration of the run, keyed by settings key.
+	Config map[string]any
+
+	// Tree is the root of the directory tree. It is nil if the tree was not requested
+	// or there are no files. The root itself has no name.
+	Tree *TreeNode
+
+	// FileCount is the number of files.
+	FileCount int
+
+	// OmittedFiles lists the paths of files left out of the output to fit a token budget.
+	OmittedFiles []string
+
+	// Changes describes the changes that the files were selected from if the output only
+	// contains changed files, or is nil.
+	Changes *ChangeSet
+
+	// Diffs is how the diffs of changed files are included: "file" after each file,
+	// "combined" in one section after all files, or empty if they are not included.
+	Diffs string
+
+	// DiffOnly indicates that files with a diff are shown as their diff only, without
+	// their content.
+	DiffOnly bool
+
+	// ShowFiles indicates that the files section is included, which it is unless only the
+	// combined diff is.
+	ShowFiles bool
+
+	// Part identifies this part if the output is split into several documents, or is nil.
+	Part *PartInfo
+
+	// Files yields every file in order. Files are processed as the template ranges over
+	// them, so they are never all held in memory.
+	Files iter.Seq[*TemplateFile]
+
+	// combinedDiff collects the diffs of files as Files yields them, if Diffs is "combined".
+	combinedDiff []string
+}
+
+// CombinedDiff returns the diffs of the files yielded so far, joined into one, if Diffs is
+// "combined". Templates call it after ranging over Files.
+func (d *TemplateData) CombinedDiff() string {
+	return strings.Join(d.combinedDiff, "\n")
+}
+
+// TemplateFile is a file as seen by output templates.
+type TemplateFile struct {
+	// Index is the position of the file in the output, starting at 0.
+	Index int
+
+	// Last indicates that this is the last file.
+	Last bool
+
+	// Path is the path of the file relative to the target directory.
+	Path string
+
+	// Status is the change status of the file, such as "added" or "modified", if the
+	// output only contains changed files, or empty.
+	Status string
+
+	// OldPath is the previous path of a renamed or copied file, or empty.
+	OldPath string
+
+	// Diff is the unified diff of the file if diffs are included, with secrets redacted
+	// if enabled, or empty.
+	Diff string
+
+	// Language is the language identifier of the file, or empty if unknown.
+	Language string
+
+	// Content is the normalized content of the file, with secrets redacted if enabled.
+	Content string
+
+	// Size is the size in bytes of the original file.
+	Size int64
+
+	// Lines is the number of lines of Content.
+	Lines int
+
+	// Tokens is the token count of Content. It is zero if token counting is skipped.
+	Tokens int
+
+	// Redactions is the number of secrets redacted from Content.
+	Redactions int
+}
+
+// templateFuncs are the functions available to output templates, in addition to the
+// text/template built-ins.
+var templateFuncs = template.FuncMap{
+	// fence returns a Markdown code fence that the given content cannot close.
+	"fence": codeFence,
+
+	// treeList renders a tree as a nested Markdown list.
+	"treeList": func(node *TreeNode) string {
+		return NewMarkdownSerializer().renderTreeAsMarkdownList(node, 0)
+	},
+
+	// treeText renders a tree as plain text, indented by two spaces per level.
+	"treeText": func(node *TreeNode) string {
+		return NewPlainTextSerializer().renderTreeAsPlainText(node, 0)
+	},
+
+	// manifest renders the manifest of a split output as plain text.
+	"manifest": manifestText,
+
+	// changes renders the deleted and renamed files of a change set as plain text.
+	"changes": changesText,
+
+	// status returns the change status of a file for display, such as "renamed from
+	// old/path.go", or an empty string if it has none.
+	"status": func(file *TemplateFile) string {
+		return statusLabel(file.Status, file.OldPath)
+	},
+
+	// repeat returns s repeated count times.
+	"repeat": func(s string, count int) string {
+		return strings.Repeat(s, count)
+	},
+
+	// xmlAttr escapes a string for use in a double-quoted XML attribute value.
+	"xmlAttr": escapeXMLAttr,
+
+	// xmlText escapes a string for use as XML character data.
+	"xmlText": escapeXMLText,
+
+	// cdata wraps a string in an XML CDATA section.
+	"cdata": wrapCDATA,
+}
+
+// TemplateSerializer writes files using a user-defined text/template, which receives
+// a TemplateData.
+type TemplateSerializer struct {
+	tmpl *template.Template
+}
+
+// NewTemplateSerializer parses text as a template with the given name and returns a
+// TemplateSerializer that executes it.
+func NewTemplateSerializer(name, text string) (*TemplateSerializer, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	return &TemplateSerializer{tmpl: tmpl}, nil
+}
+
+// LoadTemplate returns a TemplateSerializer for the template referenced by ref. If ref
+// contains a path separator or ends in .tmpl, it is read as a file. Otherwise it is a
+// template name, looked up as <name>.tmpl in templatesDir and then among the built-in
+// templates. templatesDir may be empty to only consider built-in templates.
+func LoadTemplate(ref, templatesDir string) (*TemplateSerializer, error) {
+	if IsTemplatePath(ref) {
+		content, err := os.ReadFile(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		return NewTemplateSerializer(filepath.Base(ref), string(content))
+	}
+
+	if templatesDir != "" {
+		content, err := os.ReadFile(filepath.Join(templatesDir, ref+templateExtension))
+		if err == nil {
+			return NewTemplateSerializer(ref, string(content))
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+	}
+
+	content, err := builtinTemplates.ReadFile(path.Join("templates", ref+templateExtension))
+	if err != nil {
+		return nil, fmt.Errorf("template %q not found, built-in templates are: %s", ref, strings.Join(BuiltinTemplateNames(), ", "))
+	}
+
+	return NewTemplateSerializer(ref, string(content))
+}
+
+// IsTemplatePath reports whether a template reference is a file path rather than a name.
+func IsTemplatePath(ref string) bool {
+	return strings.ContainsRune(ref, '/') || strings.ContainsRune(ref, filepath.Separator) || strings.HasSuffix(ref, templateExtension)
+}
+
+// BuiltinTemplateNames returns the sorted names of the built-in templates.
+func BuiltinTemplateNames() []string {
+	entries, _ := builtinTemplates.ReadDir("templates")
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), templateExtension))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Serialize executes the template with a TemplateData describing files and opts, and
+// writes the result to writer. Files are processed by ProcessFiles as the template
+// ranges over them.
+func (s *TemplateSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
+	data := &TemplateData{
+		Generator:    "grimoire",
+		Version:      opts.Version,
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+		Target:       opts.BaseDir,
+		Redacted:     opts.redactionEnabled(),
+		ShowTree:     opts.ShowTree,
+		Config:       opts.ConfigSummary,
+		FileCount:    len(files),
+		OmittedFiles: opts.OmittedFiles,
+		Changes:      opts.Changes,
+		Diffs:        opts.Diffs,
+		DiffOnly:     opts.DiffOnly,
+		ShowFiles:    opts.showFiles(),
+		Part:         opts.Part,
+	}
+
+	if opts.ShowTree && len(files) > 0 {
+		data.Tree = fileTree(files, opts)
+	}
+
+	data.Files = func(yield func(*TemplateFile) bool) {
+		// Rendering only fails when the template stops ranging early, so there is no
+		// error to report.
+		_ = ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+			if opts.Diffs == DiffCombined && record.Diff != "" {
+				data.combinedDiff = append(data.combinedDiff, record.Diff)
+			}
+
+			file := &TemplateFile{
+				Index:      i,
+				Last:       i == len(files)-1,
+				Path:       record.Path,
+				Status:     record.Status,
+				OldPath:    record.OldPath,
+				Diff:       record.Diff,
+				Language:   Language(record.Path),
+				Content:    record.Content,
+				Size:       record.Size,
+				Lines:      record.Lines,
+				Tokens:     record.Tokens,
+				Redactions: record.Redactions,
+			}
+			if !yield(file) {
+				return errStopFiles
+			}
+			return nil
+		})
+	}
+
+	if err := s.tmpl.Execute(writer, data); err != nil {
+		return fmt.Errorf("failed to execute template %s: %w", s.tmpl.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package serializer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// reGeneratedAt matches the generation timestamp, which differs between runs.
+var reGeneratedAt = regexp.MustCompile(`Generated by Grimoire on: \S+`)
+
+func TestBuiltinTemplateParity(t *testing.T) {
+	files := []SourceFile{
+		{Path: "README.md", Content: []byte("# Demo\n\n```go\nfmt.Println()\n```\n")},
+		{Path: "cmd/main.go", Content: []byte("package main\n\nfunc main() {}\n")},
+		{Path: "web/index.html", Content: []byte("<p>\"a\" & b</p>   \n")},
+	}
+
+	changed := []SourceFile{
+		{Path: "cmd/main.go", Content: []byte("package main\n"), Status: "modified"},
+		{Path: "web/app.js", Content: []byte("run()\n"), Status: "renamed", OldPath: "web/main.js"},
+	}
+	diffed := []SourceFile{
+		{Path: "cmd/main.go", Content: []byte("package main\n\nfunc main() {}\n"), Status: "modified", Diff: []byte("--- a/cmd/main.go\n+++ b/cmd/main.go\n@@ -1 +1,3 @@\n package main\n+\n+func main() {}\n")},
+		{Path: "docs/notes.md", Content: []byte("```\nnotes\n```\n"), Status: "added", Diff: []byte("--- /dev/null\n+++ b/docs/notes.md\n@@ -0,0 +1,3 @@\n+```\n+notes\n+```\n")},
+		{Path: "link", Content: []byte("target\n"), Status: "type changed"},
+	}
+	changes := &ChangeSet{Description: "since main", Deleted: []string{"old.go"}, Renamed: []Rename{{From: "web/main.js", To: "web/app.js"}}}
+
+	tests := []struct {
+		name  string
+		files []SourceFile
+		opts  SerializeOptions
+	}{
+		{name: "With tree", opts: SerializeOptions{ShowTree: true}},
+		{name: "Without tree", opts: SerializeOptions{ShowTree: false}},
+		{name: "With redaction", opts: SerializeOptions{ShowTree: true, Redaction: &RedactionInfo{Enabled: true}}},
+		{name: "With omitted files", opts: SerializeOptions{ShowTree: true, OmittedFiles: []string{"cmd/big.go", "docs/big.md"}}},
+		{name: "With omitted files without tree", opts: SerializeOptions{OmittedFiles: []string{"docs/big.md"}}},
+		{name: "As a part", opts: SerializeOptions{ShowTree: true, Part: &PartInfo{Index: 2, Count: 2, Manifest: [][]string{{"big.go (lines 1-90 of 120)"}, {"big.go (lines 91-120 of 120)", "cmd/main.go"}}}}},
+		{name: "With changes", files: changed, opts: SerializeOptions{ShowTree: true, Changes: changes}},
+		{name: "With diffs", files: diffed, opts: SerializeOptions{ShowTree: true, Changes: changes, Diffs: DiffPerFile}},
+		{name: "With diffs only", files: diffed, opts: SerializeOptions{Changes: changes, Diffs: DiffPerFile, DiffOnly: true}},
+		{name: "With combined diff", files: diffed, opts: SerializeOptions{ShowTree: true, Changes: changes, Diffs: DiffCombined}},
+		{name: "With combined diff only", files: diffed, opts: SerializeOptions{ShowTree: true, Changes: changes, Diffs: DiffCombined, DiffOnly: true}},
+		{name: "Without deletions or renames", files: changed[:1], opts: SerializeOptions{Changes: &ChangeSet{Description: "in the working tree"}}},
+	}
+
+	for _, format := range []string{"md", "xml", "txt"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				opts := tt.opts
+				opts.LargeFileSizeThreshold = 1 << 20
+				opts.SkipTokenCount = true
+				files := files
+				if tt.files != nil {
+					files = tt.files
+				}
+
+				native, err := NewSerializer(format)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				templated, err := LoadTemplate(format, "")
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				var want, got bytes.Buffer
+				if err := native.Serialize(&want, files, opts); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if err := templated.Serialize(&got, files, opts); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				wantText := reGeneratedAt.ReplaceAllString(want.String(), "")
+				gotText := reGeneratedAt.ReplaceAllString(got.String(), "")
+				if gotText != wantText {
+					t.Errorf("Template output differs from the %s format.\nGot:\n%s\nWant:\n%s", format, gotText, wantText)
+				}
+			})
+		}
+	}
+}
+
+func TestTemplateSerializer(t *testing.T) {
+	files := []SourceFile{
+		{Path: "a.go", Content: []byte("package a")},
+		{Path: "b.py", Content: []byte("print('b')")},
+		{Path: "c.txt", Content: []byte("c")},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "Document blocks",
+			template: `<documents>{{range .Files}}<document index="{{.Index}}"><source>{{xmlAttr .Path}}</source><document_content>{{.Content}}</document_content></document>{{end}}</documents>`,
+			want:     `<documents><document index="0"><source>a.go</source><document_content>package a</document_content></document><document index="1"><source>b.py</source><document_content>print('b')</document_content></document><document index="2"><source>c.txt</source><document_content>c</document_content></document></documents>`,
+		},
+		{
+			name:     "Metadata and languages",
+			template: `{{.Generator}} {{.Version}} {{.FileCount}}{{range .Files}} {{.Path}}={{.Language}}{{if .Last}}.{{end}}{{end}}`,
+			want:     `grimoire 1.2.3 3 a.go=go b.py=python c.txt=.`,
+		},
+		{
+			name:     "Break",
+			template: `{{range .Files}}{{if eq .Index 1}}{{break}}{{end}}{{.Path}};{{end}}done`,
+			want:     `a.go;done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serializer, err := NewTemplateSerializer(tt.name, tt.template)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			err = serializer.Serialize(&buf, files, SerializeOptions{
+				LargeFileSizeThreshold: 1 << 20,
+				SkipTokenCount:         true,
+				Jobs:                   2,
+				Version:                "1.2.3",
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if buf.String() != tt.want {
+				t.Errorf("Output mismatch:\ngot  %s\nwant %s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	templatesDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templatesDir, "house.tmpl"), []byte("house"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, "md.tmpl"), []byte("custom md"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(t.TempDir(), "file.tmpl")
+	if err := os.WriteFile(filePath, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{name: "Name from templates directory", ref: "house", want: "house"},
+		{name: "Templates directory overrides built-in", ref: "md", want: "custom md"},
+		{name: "Built-in", ref: "txt", want: "This document contains"},
+		{name: "Path", ref: filePath, want: "file"},
+		{name: "Unknown name", ref: "missing", wantErr: true},
+		{name: "Missing path", ref: filepath.Join(templatesDir, "missing.tmpl"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serializer, err := LoadTemplate(tt.ref, templatesDir)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for %s", tt.ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := serializer.Serialize(&buf, nil, SerializeOptions{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.want) {
+				t.Errorf("Output mismatch: got %q, want prefix %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
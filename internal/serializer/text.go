@@ -3,13 +3,8 @@ package serializer
 import (
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
-
-	"github.com/foresturquhart/grimoire/internal/tokens"
-	"github.com/rs/zerolog/log"
 )
 
 // PlainTextSerializer provides methods to write multiple files' contents into a
@@ -21,17 +16,10 @@ func NewPlainTextSerializer() *PlainTextSerializer {
 	return &PlainTextSerializer{}
 }
 
-// Serialize takes a list of file paths relative to baseDir, reads and normalizes
-// each file's content, and writes them to writer in plain text format with separators.
-// If reading any file fails, it logs a warning and skips that file.
-// If showTree is true, it includes a directory tree visualization.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// largeFileSizeThreshold defines the size in bytes above which a file is considered "large"
-// and a warning will be logged.
-// highTokenThreshold defines the token count above which a file is considered
-// to have a high token count and a warning will be logged.
-// skipTokenCount indicates whether to skip token counting entirely for warnings.
-func (s *PlainTextSerializer) Serialize(writer io.Writer, baseDir string, filePaths []string, showTree bool, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) error {
+// Serialize writes the processed records of files to writer in plain text format with separators.
+// If opts.ShowTree is true, it includes a directory tree visualization.
+// Records are produced by ProcessFiles, so this only renders them.
+func (s *PlainTextSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
 	// Write the header with timestamp
 	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
 
@@ -52,13 +40,17 @@ func (s *PlainTextSerializer) Serialize(writer io.Writer, baseDir string, filePa
 	summary += "- When processing this file, use the file path headings to distinguish between different files.\n"
 	summary += "- This file may contain sensitive information and should be handled with appropriate care.\n"
 
-	if redactionInfo != nil && redactionInfo.Enabled {
+	if opts.redactionEnabled() {
 		summary += "- Detected secrets have been redacted with the format [REDACTED SECRET: description].\n"
 	}
 
 	summary += "- Some files may have been excluded based on .gitignore rules and Grimoire's configuration.\n"
+	summary += omittedNotice(opts)
+	summary += changesNotice(opts)
+	summary += diffNotice(opts)
+	summary += partNotice(opts)
 
-	if showTree {
+	if opts.ShowTree {
 		summary += "- The file begins with this summary, followed by the directory structure, and then includes all codebase files.\n\n"
 	} else {
 		summary += "- The file begins with this summary, followed by all codebase files.\n\n"
@@ -68,14 +60,29 @@ func (s *PlainTextSerializer) Serialize(writer io.Writer, baseDir string, filePa
 		return fmt.Errorf("failed to write summary: %w", err)
 	}
 
+	// Add the manifest if the output is split into parts
+	if opts.Part != nil {
+		manifest := s.formatHeading("Manifest") + manifestText(opts.Part) + "\n"
+		if _, err := writer.Write([]byte(manifest)); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	// List deleted and renamed files if only changed files are included
+	if opts.Changes != nil {
+		changes := s.formatHeading("Changes") + changesText(opts.Changes) + "\n"
+		if _, err := writer.Write([]byte(changes)); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
+	}
+
 	// Add directory tree if requested
-	if showTree && len(filePaths) > 0 {
+	if opts.ShowTree && len(files) > 0 {
 		if _, err := writer.Write([]byte(s.formatHeading("Directory Structure"))); err != nil {
 			return fmt.Errorf("failed to write directory tree heading: %w", err)
 		}
 
-		treeGen := NewDefaultTreeGenerator()
-		rootNode := treeGen.GenerateTree(filePaths)
+		rootNode := fileTree(files, opts)
 
 		treeContent := s.renderTreeAsPlainText(rootNode, 0)
 		treeContent += "\n"
@@ -86,37 +93,60 @@ func (s *PlainTextSerializer) Serialize(writer io.Writer, baseDir string, filePa
 	}
 
 	// Write files heading
-	if _, err := writer.Write([]byte(s.formatHeading("Files"))); err != nil {
-		return fmt.Errorf("failed to write files heading: %w", err)
+	if opts.showFiles() {
+		if _, err := writer.Write([]byte(s.formatHeading("Files"))); err != nil {
+			return fmt.Errorf("failed to write files heading: %w", err)
+		}
 	}
 
-	// Process each file
-	for _, relPath := range filePaths {
+	// Diffs of all files, collected for a combined diff section
+	var combinedDiff []string
+
+	// Process files concurrently, writing each one in order as soon as it is ready
+	err := ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		relPath := record.Path
+
+		if opts.Diffs == DiffCombined && record.Diff != "" {
+			combinedDiff = append(combinedDiff, record.Diff)
+		}
+		if !opts.showFiles() {
+			return nil
+		}
+
 		// Write the file heading
-		fileHeading := s.formatFileHeading(relPath)
+		fileHeading := s.formatFileHeading(relPath, statusLabel(record.Status, record.OldPath))
 		if _, err := writer.Write([]byte(fileHeading)); err != nil {
 			return fmt.Errorf("failed to write heading for %s: %w", relPath, err)
 		}
 
-		// Read and normalize file content
-		content, isLargeFile, err := s.readAndNormalizeContent(baseDir, relPath, redactionInfo, largeFileSizeThreshold, highTokenThreshold, skipTokenCount)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Skipping file %s due to read error", relPath)
-			continue
+		// Write content with spacing, followed by the diff if included. The diff follows
+		// the file heading directly if it replaces the content.
+		var formattedContent string
+		if !opts.DiffOnly || record.Diff == "" {
+			formattedContent = record.Content + "\n\n"
+			if opts.Diffs == DiffPerFile && record.Diff != "" {
+				formattedContent += s.formatDiffHeading(relPath)
+			}
 		}
-
-		if isLargeFile {
-			log.Warn().Msgf("File %s exceeds the large file threshold (%d bytes). Including in output but this may impact performance.", relPath, largeFileSizeThreshold)
+		if opts.Diffs == DiffPerFile && record.Diff != "" {
+			formattedContent += record.Diff + "\n\n"
 		}
 
-		// Check if the file is minified (only if applicable file type)
-		if IsMinifiedFile(content, relPath, DefaultMinifiedFileThresholds) {
-			log.Warn().Msgf("File %s appears to be minified. Consider excluding it to reduce token counts.", relPath)
+		if _, err := writer.Write([]byte(formattedContent)); err != nil {
+			return fmt.Errorf("failed to write content for %s: %w", relPath, err)
 		}
 
-		// Write content with spacing
-		if _, err := writer.Write([]byte(content + "\n\n")); err != nil {
-			return fmt.Errorf("failed to write content for %s: %w", relPath, err)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write the combined diff after the files
+	if len(combinedDiff) > 0 {
+		section := s.formatHeading("Diff") + strings.Join(combinedDiff, "\n") + "\n\n"
+		if _, err := writer.Write([]byte(section)); err != nil {
+			return fmt.Errorf("failed to write diff: %w", err)
 		}
 	}
 
@@ -129,12 +159,23 @@ func (s *PlainTextSerializer) formatHeading(heading string) string {
 	return separator + heading + "\n" + separator + "\n"
 }
 
-// formatFileHeading creates a file heading with shorter separator lines
-func (s *PlainTextSerializer) formatFileHeading(path string) string {
+// formatFileHeading creates a file heading with shorter separator lines, followed by the
+// change status of the file if label is not empty
+func (s *PlainTextSerializer) formatFileHeading(path, label string) string {
 	separator := strings.Repeat("=", 16) + "\n"
+	if label != "" {
+		path += " (" + label + ")"
+	}
 	return separator + "File: " + path + "\n" + separator + "\n"
 }
 
+// formatDiffHeading creates the heading of the diff of a file, with the same separator
+// lines as file headings
+func (s *PlainTextSerializer) formatDiffHeading(path string) string {
+	separator := strings.Repeat("=", 16) + "\n"
+	return separator + "Diff: " + path + "\n" + separator + "\n"
+}
+
 // renderTreeAsPlainText recursively builds a plain text representation of the tree.
 func (s *PlainTextSerializer) renderTreeAsPlainText(node *TreeNode, depth int) string {
 	if node == nil {
@@ -156,6 +197,10 @@ func (s *PlainTextSerializer) renderTreeAsPlainText(node *TreeNode, depth int) s
 			builder.WriteString("/")
 		}
 
+		if node.Omitted {
+			builder.WriteString(" (omitted)")
+		}
+
 		builder.WriteString("\n")
 	}
 
@@ -171,62 +216,3 @@ func (s *PlainTextSerializer) renderTreeAsPlainText(node *TreeNode, depth int) s
 
 	return builder.String()
 }
-
-// readAndNormalizeContent reads a file from baseDir/relPath and normalizes its
-// content by trimming surrounding whitespace and trailing spaces on each line.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// It also checks if the file exceeds the large file size threshold and returns a flag if it does.
-func (s *PlainTextSerializer) readAndNormalizeContent(baseDir, relPath string, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) (string, bool, error) {
-	fullPath := filepath.Join(baseDir, relPath)
-
-	// Check file size before reading
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to stat file %s: %w", fullPath, err)
-	}
-
-	// Check if file exceeds large file threshold
-	isLargeFile := fileInfo.Size() > largeFileSizeThreshold
-
-	contentBytes, err := os.ReadFile(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to read file %s: %w", fullPath, err)
-	}
-
-	// Convert bytes to string and normalize
-	content := string(contentBytes)
-	normalizedContent := s.normalizeContent(content)
-
-	// If redaction is enabled, redact any secrets
-	if redactionInfo != nil && redactionInfo.Enabled {
-		fileFindings := GetFindingsForFile(redactionInfo, relPath, baseDir)
-		if len(fileFindings) > 0 {
-			normalizedContent = RedactSecrets(normalizedContent, fileFindings)
-		}
-	}
-
-	// Count tokens for this file and warn if it exceeds the threshold
-	if !skipTokenCount && highTokenThreshold > 0 {
-		tokenCount, err := tokens.CountFileTokens(relPath, normalizedContent)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Failed to count tokens for file %s", relPath)
-		} else if tokenCount > highTokenThreshold {
-			log.Warn().Msgf("File %s has a high token count (%d tokens, threshold: %d). This will consume significant LLM context.", relPath, tokenCount, highTokenThreshold)
-		}
-	}
-
-	return normalizedContent, isLargeFile, nil
-}
-
-// normalizeContent trims surrounding whitespace and trailing spaces from each line
-// of the input text, then returns the transformed string.
-func (s *PlainTextSerializer) normalizeContent(content string) string {
-	content = strings.TrimSpace(content)
-	lines := strings.Split(content, "\n")
-
-	for i, line := range lines {
-		lines[i] = strings.TrimRight(line, " \t")
-	}
-
-	return strings.Join(lines, "\n")
-}
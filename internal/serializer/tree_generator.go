@@ -17,6 +17,10 @@ type TreeNode struct {
 	Name     string
 	IsDir    bool
 	Children []*TreeNode
+
+	// Omitted marks a file that exists but was left out of the output, such as a file
+	// that did not fit a token budget.
+	Omitted bool
 }
 
 // DefaultTreeGenerator is a concrete implementation of TreeGenerator that creates
@@ -100,3 +104,33 @@ func (g *DefaultTreeGenerator) GenerateTree(filePaths []string) *TreeNode {
 
 	return root
 }
+
+// MarkOmitted marks the file nodes of the tree rooted at root whose paths are in
+// omittedPaths as omitted.
+func MarkOmitted(root *TreeNode, omittedPaths []string) {
+	if len(omittedPaths) == 0 {
+		return
+	}
+
+	omitted := make(map[string]bool, len(omittedPaths))
+	for _, path := range omittedPaths {
+		omitted[filepath.ToSlash(path)] = true
+	}
+
+	var mark func(node *TreeNode, path string)
+	mark = func(node *TreeNode, path string) {
+		for _, child := range node.Children {
+			childPath := child.Name
+			if path != "" {
+				childPath = path + "/" + child.Name
+			}
+
+			if child.IsDir {
+				mark(child, childPath)
+			} else if omitted[childPath] {
+				child.Omitted = true
+			}
+		}
+	}
+	mark(root, "")
+}
@@ -1,17 +1,17 @@
 package serializer
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
-
-	"github.com/foresturquhart/grimoire/internal/tokens"
-	"github.com/rs/zerolog/log"
+	"unicode/utf8"
 )
 
+// xmlDescription is the sentence that introduces an XML document.
+const xmlDescription = "This document contains a structured representation of the entire codebase, merging all files into a single XML file."
+
 // XMLSerializer provides methods to write multiple files' contents into an
 // XML-formatted document optimized for LLM parsing.
 type XMLSerializer struct{}
@@ -21,59 +21,53 @@ func NewXMLSerializer() *XMLSerializer {
 	return &XMLSerializer{}
 }
 
-// Serialize takes a list of file paths relative to baseDir, reads and normalizes
-// each file's content, and writes them to writer in a simplified XML format for LLMs.
-// If reading any file fails, it logs a warning and skips that file.
-// If showTree is true, it includes a plain text directory tree visualization.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// largeFileSizeThreshold defines the size in bytes above which a file is considered "large"
-// and a warning will be logged.
-// highTokenThreshold defines the token count above which a file is considered
-// to have a high token count and a warning will be logged.
-// skipTokenCount indicates whether to skip token counting entirely for warnings.
-func (s *XMLSerializer) Serialize(writer io.Writer, baseDir string, filePaths []string, showTree bool, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) error {
+// Serialize writes the processed records of files to writer in a simplified XML format for LLMs.
+// If opts.ShowTree is true, it includes a plain text directory tree visualization.
+// If opts.StrictXML is true, the document is well-formed XML instead (see serializeStrict).
+// Records are produced by ProcessFiles, so this only renders them.
+func (s *XMLSerializer) Serialize(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
+	if opts.StrictXML {
+		return s.serializeStrict(writer, files, opts)
+	}
+
 	// Write header as plain text before XML content
 	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
-	header := fmt.Sprintf("This document contains a structured representation of the entire codebase, merging all files into a single XML file.\n\nGenerated by Grimoire on: %s\n\n", timestamp)
+	header := fmt.Sprintf("%s\n\nGenerated by Grimoire on: %s\n\n", xmlDescription, timestamp)
 
 	if _, err := writer.Write([]byte(header)); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
 	// Write the summary section
-	summary := "<summary>\n"
-	summary += "This file contains a packed representation of the entire codebase's contents. "
-	summary += "It is designed to be easily consumable by AI systems for analysis, code review, or other automated processes.\n\n"
-	summary += "- This file should be treated as read-only. Any changes should be made to the original codebase files.\n"
-	summary += "- When processing this file, use the file path attributes to distinguish between different files.\n"
-	summary += "- This file may contain sensitive information and should be handled with appropriate care.\n"
+	summary := "<summary>\n" + s.summary(opts) + "</summary>\n\n"
 
-	if redactionInfo != nil && redactionInfo.Enabled {
-		summary += "- Detected secrets have been redacted with the format [REDACTED SECRET: description].\n"
+	if _, err := writer.Write([]byte(summary)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
 	}
 
-	summary += "- Some files may have been excluded based on .gitignore rules and Grimoire's configuration.\n"
-
-	if showTree {
-		summary += "- The file begins with this summary, followed by the directory structure, and then includes all codebase files.\n"
-	} else {
-		summary += "- The file begins with this summary, followed by all codebase files.\n"
+	// Add the manifest if the output is split into parts
+	if opts.Part != nil {
+		manifest := "<manifest>\n" + manifestText(opts.Part) + "</manifest>\n\n"
+		if _, err := writer.Write([]byte(manifest)); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
 	}
 
-	summary += "</summary>\n\n"
-
-	if _, err := writer.Write([]byte(summary)); err != nil {
-		return fmt.Errorf("failed to write summary: %w", err)
+	// List deleted and renamed files if only changed files are included
+	if opts.Changes != nil {
+		changes := "<changes>\n" + changesText(opts.Changes) + "</changes>\n\n"
+		if _, err := writer.Write([]byte(changes)); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
 	}
 
 	// Add directory tree if requested
-	if showTree && len(filePaths) > 0 {
+	if opts.ShowTree && len(files) > 0 {
 		if _, err := writer.Write([]byte("<directory_structure>\n")); err != nil {
 			return fmt.Errorf("failed to write directory structure opening tag: %w", err)
 		}
 
-		treeGen := NewDefaultTreeGenerator()
-		rootNode := treeGen.GenerateTree(filePaths)
+		rootNode := fileTree(files, opts)
 
 		// Generate plain text tree with indentation
 		treeContent := s.renderTreeAsPlainText(rootNode, 0)
@@ -88,53 +82,236 @@ func (s *XMLSerializer) Serialize(writer io.Writer, baseDir string, filePaths []
 	}
 
 	// Write files opening tag
-	if _, err := writer.Write([]byte("<files>\n")); err != nil {
-		return fmt.Errorf("failed to write files opening tag: %w", err)
+	if opts.showFiles() {
+		if _, err := writer.Write([]byte("<files>\n")); err != nil {
+			return fmt.Errorf("failed to write files opening tag: %w", err)
+		}
 	}
 
-	// Process each file
-	for _, relPath := range filePaths {
-		// Read and normalize file content
-		content, isLargeFile, err := s.readAndNormalizeContent(baseDir, relPath, redactionInfo, largeFileSizeThreshold, highTokenThreshold, skipTokenCount)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Skipping file %s due to read error", relPath)
-			continue
+	// Diffs of all files, collected for a combined diff element
+	var combinedDiff []string
+
+	// Process files concurrently, writing each one in order as soon as it is ready
+	err := ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		relPath := record.Path
+
+		if opts.Diffs == DiffCombined && record.Diff != "" {
+			combinedDiff = append(combinedDiff, record.Diff)
 		}
+		if !opts.showFiles() {
+			return nil
+		}
+
+		attrs := statusAttrs(record, func(s string) string { return s })
+
+		if !opts.DiffOnly || record.Diff == "" {
+			// Write file tag with path and change status attributes
+			fileOpenTag := fmt.Sprintf("<file path=\"%s\"%s>\n", relPath, attrs)
+			if _, err := writer.Write([]byte(fileOpenTag)); err != nil {
+				return fmt.Errorf("failed to write file opening tag for %s: %w", relPath, err)
+			}
+
+			// Write file content directly inside the file tag
+			if _, err := writer.Write([]byte(record.Content)); err != nil {
+				return fmt.Errorf("failed to write content for %s: %w", relPath, err)
+			}
 
-		if isLargeFile {
-			log.Warn().Msgf("File %s exceeds the large file threshold (%d bytes). Including in output but this may impact performance.", relPath, largeFileSizeThreshold)
+			// Write file closing tag
+			if _, err := writer.Write([]byte("\n</file>\n")); err != nil {
+				return fmt.Errorf("failed to write file closing tag for %s: %w", relPath, err)
+			}
 		}
 
-		// Check if the file is minified (only if applicable file type)
-		if IsMinifiedFile(content, relPath, DefaultMinifiedFileThresholds) {
-			log.Warn().Msgf("File %s appears to be minified. Consider excluding it to reduce token counts.", relPath)
+		// Write the diff after the file, with the same attributes
+		if opts.Diffs == DiffPerFile && record.Diff != "" {
+			diff := fmt.Sprintf("<diff path=\"%s\"%s>\n%s\n</diff>\n", relPath, attrs, record.Diff)
+			if _, err := writer.Write([]byte(diff)); err != nil {
+				return fmt.Errorf("failed to write diff for %s: %w", relPath, err)
+			}
 		}
 
-		// Write file tag with path attribute
-		fileOpenTag := fmt.Sprintf("<file path=\"%s\">\n", relPath)
-		if _, err := writer.Write([]byte(fileOpenTag)); err != nil {
-			return fmt.Errorf("failed to write file opening tag for %s: %w", relPath, err)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write files closing tag
+	if opts.showFiles() {
+		if _, err := writer.Write([]byte("</files>\n")); err != nil {
+			return fmt.Errorf("failed to write files closing tag: %w", err)
 		}
+	}
 
-		// Write file content directly inside the file tag
-		if _, err := writer.Write([]byte(content)); err != nil {
-			return fmt.Errorf("failed to write content for %s: %w", relPath, err)
+	// Write the combined diff after the files
+	if len(combinedDiff) > 0 {
+		if _, err := writer.Write([]byte("<diff>\n" + strings.Join(combinedDiff, "\n") + "\n</diff>\n")); err != nil {
+			return fmt.Errorf("failed to write diff: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// serializeStrict writes the processed records of files to writer as a well-formed XML
+// document: an XML declaration, then a <codebase> root element holding the summary, the
+// directory tree if opts.ShowTree is true, a <file> element per file, and <diff> elements
+// if diffs are included. Attributes and the summary are escaped, while the tree, file
+// contents and diffs are wrapped in CDATA sections so they read naturally.
+func (s *XMLSerializer) serializeStrict(writer io.Writer, files []SourceFile, opts SerializeOptions) error {
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	header := fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!-- %s -->\n<codebase generator=\"grimoire\" version=\"%s\" generated_at=\"%s\">\n",
+		xmlDescription, escapeXMLAttr(opts.Version), timestamp)
+
+	if _, err := writer.Write([]byte(header)); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	summary := "<summary>\n" + escapeXMLText(s.summary(opts)) + "</summary>\n"
+
+	if _, err := writer.Write([]byte(summary)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
 
-		// Write file closing tag
-		if _, err := writer.Write([]byte("\n</file>\n")); err != nil {
-			return fmt.Errorf("failed to write file closing tag for %s: %w", relPath, err)
+	// Add the manifest if the output is split into parts
+	if opts.Part != nil {
+		manifest := fmt.Sprintf("<manifest part=\"%d\" parts=\"%d\">\n%s</manifest>\n", opts.Part.Index, opts.Part.Count, escapeXMLText(manifestText(opts.Part)))
+		if _, err := writer.Write([]byte(manifest)); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
 		}
 	}
 
-	// Write files closing tag
-	if _, err := writer.Write([]byte("</files>\n")); err != nil {
-		return fmt.Errorf("failed to write files closing tag: %w", err)
+	// List deleted and renamed files if only changed files are included
+	if opts.Changes != nil {
+		if _, err := writer.Write([]byte(strictChanges(opts.Changes))); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
+	}
+
+	// Add directory tree if requested
+	if opts.ShowTree && len(files) > 0 {
+		rootNode := fileTree(files, opts)
+
+		tree := "<directory_structure>" + wrapCDATA("\n"+s.renderTreeAsPlainText(rootNode, 0)) + "</directory_structure>\n"
+
+		if _, err := writer.Write([]byte(tree)); err != nil {
+			return fmt.Errorf("failed to write directory tree: %w", err)
+		}
+	}
+
+	if opts.showFiles() {
+		if _, err := writer.Write([]byte("<files>\n")); err != nil {
+			return fmt.Errorf("failed to write files opening tag: %w", err)
+		}
+	}
+
+	// Diffs of all files, collected for a combined diff element
+	var combinedDiff []string
+
+	// Process files concurrently, writing each one in order as soon as it is ready
+	err := ProcessFiles(files, opts, func(i int, record *FileRecord) error {
+		if opts.Diffs == DiffCombined && record.Diff != "" {
+			combinedDiff = append(combinedDiff, record.Diff)
+		}
+		if !opts.showFiles() {
+			return nil
+		}
+
+		path := escapeXMLAttr(record.Path)
+		attrs := statusAttrs(record, escapeXMLAttr)
+
+		var element string
+		if !opts.DiffOnly || record.Diff == "" {
+			element = fmt.Sprintf("<file path=\"%s\"%s>%s</file>\n", path, attrs, wrapCDATA("\n"+record.Content+"\n"))
+		}
+		if opts.Diffs == DiffPerFile && record.Diff != "" {
+			element += fmt.Sprintf("<diff path=\"%s\"%s>%s</diff>\n", path, attrs, wrapCDATA("\n"+record.Diff+"\n"))
+		}
+
+		if _, err := writer.Write([]byte(element)); err != nil {
+			return fmt.Errorf("failed to write content for %s: %w", record.Path, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var closing string
+	if opts.showFiles() {
+		closing = "</files>\n"
+	}
+	if len(combinedDiff) > 0 {
+		closing += "<diff>" + wrapCDATA("\n"+strings.Join(combinedDiff, "\n")+"\n") + "</diff>\n"
+	}
+	closing += "</codebase>\n"
+
+	if _, err := writer.Write([]byte(closing)); err != nil {
+		return fmt.Errorf("failed to write closing tags: %w", err)
 	}
 
 	return nil
 }
 
+// statusAttrs returns the status and from attributes of a file element, with a leading
+// space, or an empty string if the file has no change status. Values are passed through
+// escape.
+func statusAttrs(record *FileRecord, escape func(string) string) string {
+	if record.Status == "" {
+		return ""
+	}
+	attrs := fmt.Sprintf(" status=\"%s\"", escape(record.Status))
+	if record.OldPath != "" {
+		attrs += fmt.Sprintf(" from=\"%s\"", escape(record.OldPath))
+	}
+	return attrs
+}
+
+// strictChanges returns the changes element of a strict XML document, with an element
+// per deleted and renamed file.
+func strictChanges(changes *ChangeSet) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "<changes description=\"%s\">\n", escapeXMLAttr(changes.Description))
+	for _, path := range changes.Deleted {
+		fmt.Fprintf(&builder, "<deleted path=\"%s\"/>\n", escapeXMLAttr(path))
+	}
+	for _, rename := range changes.Renamed {
+		fmt.Fprintf(&builder, "<renamed from=\"%s\" to=\"%s\"/>\n", escapeXMLAttr(rename.From), escapeXMLAttr(rename.To))
+	}
+	builder.WriteString("</changes>\n")
+
+	return builder.String()
+}
+
+// summary returns the text of the summary section, without its tags.
+func (s *XMLSerializer) summary(opts SerializeOptions) string {
+	summary := "This file contains a packed representation of the entire codebase's contents. "
+	summary += "It is designed to be easily consumable by AI systems for analysis, code review, or other automated processes.\n\n"
+	summary += "- This file should be treated as read-only. Any changes should be made to the original codebase files.\n"
+	summary += "- When processing this file, use the file path attributes to distinguish between different files.\n"
+	summary += "- This file may contain sensitive information and should be handled with appropriate care.\n"
+
+	if opts.redactionEnabled() {
+		summary += "- Detected secrets have been redacted with the format [REDACTED SECRET: description].\n"
+	}
+
+	summary += "- Some files may have been excluded based on .gitignore rules and Grimoire's configuration.\n"
+	summary += omittedNotice(opts)
+	summary += changesNotice(opts)
+	summary += diffNotice(opts)
+	summary += partNotice(opts)
+
+	if opts.ShowTree {
+		summary += "- The file begins with this summary, followed by the directory structure, and then includes all codebase files.\n"
+	} else {
+		summary += "- The file begins with this summary, followed by all codebase files.\n"
+	}
+
+	return summary
+}
+
 // renderTreeAsPlainText recursively builds a plain text representation of the tree with
 // indentation for easier LLM parsing.
 func (s *XMLSerializer) renderTreeAsPlainText(node *TreeNode, depth int) string {
@@ -157,6 +334,10 @@ func (s *XMLSerializer) renderTreeAsPlainText(node *TreeNode, depth int) string
 			builder.WriteString("/")
 		}
 
+		if node.Omitted {
+			builder.WriteString(" (omitted)")
+		}
+
 		builder.WriteString("\n")
 	}
 
@@ -173,61 +354,54 @@ func (s *XMLSerializer) renderTreeAsPlainText(node *TreeNode, depth int) string
 	return builder.String()
 }
 
-// readAndNormalizeContent reads a file from baseDir/relPath and normalizes its
-// content by trimming surrounding whitespace and trailing spaces on each line.
-// If redactionInfo is not nil, it redacts secrets from the output.
-// It also checks if the file exceeds the large file size threshold and returns a flag if it does.
-func (s *XMLSerializer) readAndNormalizeContent(baseDir, relPath string, redactionInfo *RedactionInfo, largeFileSizeThreshold int64, highTokenThreshold int, skipTokenCount bool) (string, bool, error) {
-	fullPath := filepath.Join(baseDir, relPath)
-
-	// Check file size before reading
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to stat file %s: %w", fullPath, err)
-	}
-
-	// Check if file exceeds large file threshold
-	isLargeFile := fileInfo.Size() > largeFileSizeThreshold
+// escapeXMLAttr returns s escaped for use in a double-quoted XML attribute value.
+// Whitespace such as newlines is escaped too, so it survives attribute normalization.
+// Characters that are not allowed in XML are replaced with U+FFFD.
+func escapeXMLAttr(s string) string {
+	var builder strings.Builder
+	// Writing to a strings.Builder never fails
+	_ = xml.EscapeText(&builder, []byte(s))
+	return builder.String()
+}
 
-	contentBytes, err := os.ReadFile(fullPath)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to read file %s: %w", fullPath, err)
-	}
+// xmlTextEscaper escapes the characters that are special in XML character data.
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
 
-	// Convert bytes to string and normalize
-	content := string(contentBytes)
-	normalizedContent := s.normalizeContent(content)
+// escapeXMLText returns s escaped for use as XML character data, leaving whitespace as is.
+// Characters that are not allowed in XML are replaced with U+FFFD.
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(sanitizeXML(s))
+}
 
-	// If redaction is enabled, redact any secrets
-	if redactionInfo != nil && redactionInfo.Enabled {
-		fileFindings := GetFindingsForFile(redactionInfo, relPath, baseDir)
-		if len(fileFindings) > 0 {
-			normalizedContent = RedactSecrets(normalizedContent, fileFindings)
-		}
-	}
+// wrapCDATA returns s wrapped in a CDATA section. Any "]]>" in s, which would end the
+// section early, is split across two adjacent sections, and characters that are not
+// allowed in XML are replaced with U+FFFD.
+func wrapCDATA(s string) string {
+	return "<![CDATA[" + strings.ReplaceAll(sanitizeXML(s), "]]>", "]]]]><![CDATA[>") + "]]>"
+}
 
-	// Count tokens for this file and warn if it exceeds the threshold
-	if !skipTokenCount && highTokenThreshold > 0 {
-		tokenCount, err := tokens.CountFileTokens(relPath, normalizedContent)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Failed to count tokens for file %s", relPath)
-		} else if tokenCount > highTokenThreshold {
-			log.Warn().Msgf("File %s has a high token count (%d tokens, threshold: %d). This will consume significant LLM context.", relPath, tokenCount, highTokenThreshold)
+// sanitizeXML returns s with characters that are not allowed in XML, including invalid
+// UTF-8, replaced with U+FFFD.
+func sanitizeXML(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isXMLChar(r) {
+			return r
 		}
-	}
-
-	return normalizedContent, isLargeFile, nil
+		return utf8.RuneError
+	}, s)
 }
 
-// normalizeContent trims surrounding whitespace and trailing spaces from each line
-// of the input text, then returns the transformed string.
-func (s *XMLSerializer) normalizeContent(content string) string {
-	content = strings.TrimSpace(content)
-	lines := strings.Split(content, "\n")
-
-	for i, line := range lines {
-		lines[i] = strings.TrimRight(line, " \t")
+// isXMLChar reports whether r is allowed in an XML 1.0 document.
+func isXMLChar(r rune) bool {
+	switch {
+	case r == utf8.RuneError:
+		// Keep replacement characters, including those strings.Map produces for invalid UTF-8
+		return true
+	case r == '\t', r == '\n', r == '\r':
+		return true
+	case r >= 0x20 && r <= 0xD7FF, r >= 0xE000 && r <= 0xFFFD, r >= 0x10000 && r <= 0x10FFFF:
+		return true
+	default:
+		return false
 	}
-
-	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,106 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestXMLSerializerStrict(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		content     string
+		wantContent string
+	}{
+		{
+			name:        "Markup",
+			path:        "web/index.html",
+			content:     "<p class=\"x\">a & b</p>\n</file>\n</files>",
+			wantContent: "<p class=\"x\">a & b</p>\n</file>\n</files>",
+		},
+		{
+			name:        "CDATA terminator",
+			path:        "data/cdata.xml",
+			content:     "<![CDATA[x]]>\nif a[b[0]]>1 {}",
+			wantContent: "<![CDATA[x]]>\nif a[b[0]]>1 {}",
+		},
+		{
+			name:        "Special characters in path",
+			path:        "docs/\"quoted\" & <angled>.md",
+			content:     "# Title",
+			wantContent: "# Title",
+		},
+		{
+			name:        "Invalid characters",
+			path:        "logs/colors.txt",
+			content:     "\x1b[31mred\x1b[0m\x00",
+			wantContent: "\uFFFD[31mred\uFFFD[0m\uFFFD",
+		},
+		{
+			name:        "Empty file",
+			path:        "empty.txt",
+			content:     "",
+			wantContent: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []SourceFile{{Path: tt.path, Content: []byte(tt.content)}}
+
+			var buf bytes.Buffer
+			err := NewXMLSerializer().Serialize(&buf, files, SerializeOptions{
+				ShowTree:               true,
+				LargeFileSizeThreshold: 1 << 20,
+				SkipTokenCount:         true,
+				StrictXML:              true,
+				Version:                "1.2.3",
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !strings.HasPrefix(buf.String(), "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n") {
+				t.Errorf("Output does not start with an XML declaration")
+			}
+
+			var document struct {
+				XMLName   xml.Name `xml:"codebase"`
+				Version   string   `xml:"version,attr"`
+				Summary   string   `xml:"summary"`
+				Directory string   `xml:"directory_structure"`
+				Files     []struct {
+					Path    string `xml:"path,attr"`
+					Content string `xml:",chardata"`
+				} `xml:"files>file"`
+			}
+			decoder := xml.NewDecoder(&buf)
+			decoder.Strict = true
+			if err := decoder.Decode(&document); err != nil {
+				t.Fatalf("Output is not well-formed XML: %v", err)
+			}
+
+			if document.Version != "1.2.3" || !strings.Contains(document.Summary, "packed representation") {
+				t.Errorf("Metadata mismatch: version %q, summary %q", document.Version, document.Summary)
+			}
+
+			if !strings.Contains(document.Directory, tt.path[strings.LastIndex(tt.path, "/")+1:]) {
+				t.Errorf("Directory structure does not list the file: %q", document.Directory)
+			}
+
+			if len(document.Files) != 1 {
+				t.Fatalf("Got %d files, want 1", len(document.Files))
+			}
+
+			if document.Files[0].Path != tt.path {
+				t.Errorf("Path mismatch: got %q, want %q", document.Files[0].Path, tt.path)
+			}
+
+			if got := strings.TrimPrefix(strings.TrimSuffix(document.Files[0].Content, "\n"), "\n"); got != tt.wantContent {
+				t.Errorf("Content mismatch: got %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+}
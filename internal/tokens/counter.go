@@ -2,58 +2,302 @@ package tokens
 
 import (
 	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/tiktoken-go/tokenizer"
 )
 
-// encoderCache provides a singleton instance of the encoder to avoid repeated initialization
+// Mode is a token counting mode.
+type Mode string
+
+const (
+	// ModeFast counts with the tokenizer, but estimates the count of texts larger than
+	// fastThreshold from evenly spaced samples instead of encoding them in full, and
+	// likewise samples streamed output beyond fastThreshold.
+	ModeFast Mode = "fast"
+
+	// ModeExact counts every text in full with the tokenizer.
+	ModeExact Mode = "exact"
+
+	// ModeApproximate estimates counts from runs of letters, digits, punctuation and
+	// whitespace, calibrated per file type, without a tokenizer. It suits models whose
+	// tokenizer is not available.
+	ModeApproximate Mode = "approximate"
+)
+
+// DefaultTokenizer is the name of the tokenizer used unless another is configured.
+const DefaultTokenizer = "o200k"
+
+// Encodings maps the tokenizer names accepted by Configure to their encodings.
+var Encodings = map[string]tokenizer.Encoding{
+	"o200k":  tokenizer.O200kBase,
+	"cl100k": tokenizer.Cl100kBase,
+	"p50k":   tokenizer.P50kBase,
+	"r50k":   tokenizer.R50kBase,
+}
+
+// fastThreshold is the size in bytes above which fast mode estimates token counts from
+// samples.
+const fastThreshold = 1 << 20
+
+// fastSamples and fastSampleSize are the number and approximate size in bytes of the
+// samples that fast mode encodes.
+const (
+	fastSamples    = 32
+	fastSampleSize = 8 << 10
+)
+
+// The token costs of runs of characters in approximate mode, which model how BPE
+// encodings tend to split source code: a word becomes a token per few letters, numbers a
+// token per three digits, and punctuation a token per pair of symbols, while a single
+// space merges into the word that follows it.
+const (
+	lettersPerToken       = 7
+	digitsPerToken        = 3
+	punctuationPerToken   = 2
+	whitespaceRunTokens   = 0.5
+	newlineRunTokens      = 0.6
+	nonASCIIBytesPerToken = 3
+)
+
+// calibration holds the ratio of estimated to actual tokens in approximate mode, keyed
+// by file extension, for file types whose ratio differs noticeably from 1. The ratios
+// were measured with the o200k encoding on open source code, and estimates are divided
+// by them.
+var calibration = map[string]float64{
+	".cfg":   0.8,
+	".diff":  0.82,
+	".h":     0.88,
+	".html":  1.08,
+	".md":    1.09,
+	".patch": 0.82,
+	".py":    1.05,
+	".rst":   1.17,
+	".s":     0.76,
+	".toml":  1.05,
+	".txt":   0.85,
+}
+
+// Settings that apply to every count. They are set by Configure before any counting.
 var (
-	encoder     tokenizer.Codec
-	encoderOnce sync.Once
-	encoderErr  error
+	activeTokenizer = DefaultTokenizer
+	activeMode      = ModeFast
 )
 
+// encoderCache provides singleton instances of the encoders to avoid repeated initialization
+var (
+	encoders   = make(map[tokenizer.Encoding]tokenizer.Codec)
+	encodersMu sync.Mutex
+)
+
+// Configure selects the tokenizer, by a name from Encodings, and the counting mode for
+// all subsequent counts. It must be called before counting starts.
+func Configure(name string, mode Mode) error {
+	if _, ok := Encodings[name]; !ok {
+		return fmt.Errorf("unsupported tokenizer: %s", name)
+	}
+
+	switch mode {
+	case ModeFast, ModeExact, ModeApproximate:
+	default:
+		return fmt.Errorf("unsupported token count mode: %s", mode)
+	}
+
+	activeTokenizer = name
+	activeMode = mode
+	return nil
+}
+
+// Describe returns a short description of how tokens are counted, for reports, such as
+// "o200k_base encoding" or "approximate, from character classes".
+func Describe() string {
+	switch activeMode {
+	case ModeApproximate:
+		return "approximate, from character classes"
+	case ModeFast:
+		return fmt.Sprintf("%s encoding, sampled above %d MiB", Encodings[activeTokenizer], fastThreshold>>20)
+	default:
+		return fmt.Sprintf("%s encoding", Encodings[activeTokenizer])
+	}
+}
+
 // getEncoder returns a cached encoder instance to avoid repeated initialization costs
 func getEncoder() (tokenizer.Codec, error) {
-	encoderOnce.Do(func() {
-		encoder, encoderErr = tokenizer.Get(tokenizer.O200kBase)
-	})
-	return encoder, encoderErr
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	encoding := Encodings[activeTokenizer]
+	if enc, ok := encoders[encoding]; ok {
+		return enc, nil
+	}
+
+	enc, err := tokenizer.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	encoders[encoding] = enc
+	return enc, nil
 }
 
-// CountTokens counts the number of tokens in the provided text using the specified encoder.
-// It returns the token count and any error that occurred during counting.
-func CountTokens(text string) (int, error) {
+// countText returns the token count of text according to the active mode. factor is the
+// calibration that approximate estimates are divided by.
+func countText(text string, factor float64) (int, error) {
+	if activeMode == ModeApproximate {
+		return estimateTokens(text, factor), nil
+	}
+
 	enc, err := getEncoder()
 	if err != nil {
 		return 0, err
 	}
 
-	count, err := enc.Count(text)
-	if err != nil {
-		return 0, err
+	if activeMode == ModeFast && len(text) > fastThreshold {
+		return sampleTokens(enc, text)
 	}
 
-	return count, nil
+	return enc.Count(text)
+}
+
+// estimateTokens estimates the token count of text by adding up the costs of its runs of
+// letters, digits, punctuation, whitespace and non-ASCII characters, divided by factor.
+func estimateTokens(text string, factor float64) int {
+	tokens := 0.0
+
+	for i := 0; i < len(text); {
+		class := charClass(text[i])
+		j := i + 1
+		for j < len(text) && charClass(text[j]) == class {
+			j++
+		}
+		n := j - i
+
+		switch class {
+		case classLetter:
+			tokens += float64((n + lettersPerToken - 1) / lettersPerToken)
+		case classDigit:
+			tokens += float64((n + digitsPerToken - 1) / digitsPerToken)
+		case classPunctuation:
+			tokens += float64((n + punctuationPerToken - 1) / punctuationPerToken)
+		case classSpace:
+			if n > 1 {
+				tokens += whitespaceRunTokens
+			}
+		case classNewline:
+			tokens += newlineRunTokens
+		default:
+			tokens += float64((n + nonASCIIBytesPerToken - 1) / nonASCIIBytesPerToken)
+		}
+
+		i = j
+	}
+
+	return int(math.Ceil(tokens / factor))
 }
 
-// StreamingTokenCounter maintains an incremental token count for streaming content
+// Character classes of approximate mode.
+const (
+	classLetter = iota
+	classDigit
+	classPunctuation
+	classSpace
+	classNewline
+	classNonASCII
+)
+
+// charClass returns the class of a byte for approximate mode.
+func charClass(b byte) int {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b == '_':
+		return classLetter
+	case b >= '0' && b <= '9':
+		return classDigit
+	case b == ' ' || b == '\t':
+		return classSpace
+	case b == '\n' || b == '\r':
+		return classNewline
+	case b >= utf8.RuneSelf:
+		return classNonASCII
+	default:
+		return classPunctuation
+	}
+}
+
+// sampleTokens estimates the token count of text by encoding fastSamples evenly spaced
+// samples, each extended to whole lines, and scaling their tokens per byte to the length
+// of text.
+func sampleTokens(enc tokenizer.Codec, text string) (int, error) {
+	stride := len(text) / fastSamples
+	sampledBytes, sampledTokens := 0, 0
+
+	for i := range fastSamples {
+		start := i * stride
+		if start > 0 {
+			if newline := strings.IndexByte(text[start:], '\n'); newline >= 0 {
+				start += newline + 1
+			}
+		}
+
+		end := min(start+fastSampleSize, len(text))
+		if newline := strings.IndexByte(text[end:], '\n'); newline >= 0 {
+			end += newline + 1
+		} else {
+			end = len(text)
+		}
+
+		count, err := enc.Count(text[start:end])
+		if err != nil {
+			return 0, err
+		}
+
+		sampledBytes += end - start
+		sampledTokens += count
+	}
+
+	if sampledBytes == 0 {
+		return 0, nil
+	}
+
+	return int(math.Round(float64(len(text)) * float64(sampledTokens) / float64(sampledBytes))), nil
+}
+
+// CountTokens counts the number of tokens in the provided text using the configured
+// tokenizer and mode. It returns the token count and any error that occurred during counting.
+func CountTokens(text string) (int, error) {
+	return countText(text, 1)
+}
+
+// StreamingTokenCounter maintains an incremental token count for streaming content. In
+// fast mode, once more than fastThreshold bytes have been counted, only one in every
+// fastStreamStride texts is counted, and the others are estimated from the tokens per
+// byte of the counted texts.
 type StreamingTokenCounter struct {
-	enc        tokenizer.Codec
-	tokenCount int
-	mu         sync.Mutex
+	tokenCount   int
+	texts        int
+	countedBytes int
+	skippedBytes int
+	mu           sync.Mutex
 }
 
+// fastStreamStride is the interval at which a StreamingTokenCounter counts texts in fast
+// mode once past fastThreshold.
+const fastStreamStride = 8
+
 // NewStreamingCounter creates a new streaming token counter
 func NewStreamingCounter() (*StreamingTokenCounter, error) {
-	enc, err := getEncoder()
-	if err != nil {
-		return nil, err
+	if activeMode != ModeApproximate {
+		// Load the encoder up front so that a failure is reported here.
+		if _, err := getEncoder(); err != nil {
+			return nil, err
+		}
 	}
 
 	return &StreamingTokenCounter{
-		enc:        enc,
 		tokenCount: 0,
 	}, nil
 }
@@ -67,20 +311,32 @@ func (c *StreamingTokenCounter) AddText(text string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	count, err := c.enc.Count(text)
+	c.texts++
+	if activeMode == ModeFast && c.countedBytes > fastThreshold && c.texts%fastStreamStride != 0 {
+		c.skippedBytes += len(text)
+		return nil
+	}
+
+	count, err := CountTokens(text)
 	if err != nil {
 		return err
 	}
 
 	c.tokenCount += count
+	c.countedBytes += len(text)
 	return nil
 }
 
-// TokenCount returns the current token count
+// TokenCount returns the current token count, including the estimate for skipped texts
 func (c *StreamingTokenCounter) TokenCount() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.tokenCount
+
+	if c.skippedBytes == 0 {
+		return c.tokenCount
+	}
+
+	return c.tokenCount + int(math.Round(float64(c.skippedBytes)*float64(c.tokenCount)/float64(c.countedBytes)))
 }
 
 // CountFileTokens counts the tokens in a specific file content and returns
@@ -90,16 +346,75 @@ func CountFileTokens(filePath, content string) (int, error) {
 		return 0, nil
 	}
 
-	// Reuse the shared encoder instance
-	enc, err := getEncoder()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get encoder for file %s: %w", filePath, err)
+	factor, ok := calibration[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		factor = 1
 	}
 
-	count, err := enc.Count(content)
+	count, err := countText(content, factor)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count tokens for file %s: %w", filePath, err)
 	}
 
 	return count, nil
 }
+
+// SplitText splits text into consecutive pieces of at most maxTokens tokens each.
+// Pieces are cut at token boundaries, so a multi-byte character may be split if it
+// spans more than one token. In approximate mode, pieces are cut at character
+// boundaries instead.
+func SplitText(text string, maxTokens int) ([]string, error) {
+	if maxTokens <= 0 {
+		return nil, fmt.Errorf("invalid maximum token count %d", maxTokens)
+	}
+
+	if activeMode == ModeApproximate {
+		return splitApproximate(text, maxTokens), nil
+	}
+
+	enc, err := getEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	ids, _, err := enc.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []string
+	for start := 0; start < len(ids); start += maxTokens {
+		end := min(start+maxTokens, len(ids))
+		piece, err := enc.Decode(ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, piece)
+	}
+
+	return pieces, nil
+}
+
+// splitApproximate splits text into consecutive pieces whose estimated token count is at
+// most maxTokens each, cut at character boundaries. Estimates only grow as text is
+// extended, so the longest piece that fits is found by binary search.
+func splitApproximate(text string, maxTokens int) []string {
+	var pieces []string
+	for text != "" {
+		end := sort.Search(len(text), func(n int) bool {
+			return estimateTokens(text[:n+1], 1) > maxTokens
+		})
+
+		// Cut at a character boundary, keeping at least one character.
+		for end > 0 && end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(text)
+		}
+
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
@@ -0,0 +1,87 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// withSettings configures counting for the duration of a test.
+func withSettings(t *testing.T, name string, mode Mode) {
+	t.Helper()
+	previousTokenizer, previousMode := activeTokenizer, activeMode
+	if err := Configure(name, mode); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		activeTokenizer, activeMode = previousTokenizer, previousMode
+	})
+}
+
+func TestCountModes(t *testing.T) {
+	source, err := os.ReadFile("counter.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := strings.Repeat(string(source), fastThreshold/len(source)+1)
+
+	withSettings(t, DefaultTokenizer, ModeExact)
+	exact, err := CountFileTokens("counter.go", large)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		tokenizer string
+		mode      Mode
+		tolerance float64
+	}{
+		{name: "Fast samples large text", tokenizer: DefaultTokenizer, mode: ModeFast, tolerance: 0.02},
+		{name: "Approximate", tokenizer: DefaultTokenizer, mode: ModeApproximate, tolerance: 0.15},
+		{name: "Other encoding", tokenizer: "cl100k", mode: ModeExact, tolerance: 0.15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, tt.tokenizer, tt.mode)
+
+			got, err := CountFileTokens("counter.go", large)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if deviation := float64(got-exact) / float64(exact); deviation > tt.tolerance || deviation < -tt.tolerance {
+				t.Errorf("Count %d deviates by %.1f%% from the exact count %d", got, deviation*100, exact)
+			}
+		})
+	}
+}
+
+func TestConfigureRejectsUnknownSettings(t *testing.T) {
+	if err := Configure("gpt2", ModeExact); err == nil {
+		t.Error("Expected an error for an unknown tokenizer")
+	}
+	if err := Configure(DefaultTokenizer, "slow"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestSplitTextApproximate(t *testing.T) {
+	withSettings(t, DefaultTokenizer, ModeApproximate)
+
+	text := strings.Repeat("abcdefgh", 100) + "日本語"
+	pieces, err := SplitText(text, 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.Join(pieces, "") != text {
+		t.Error("Pieces do not add up to the text")
+	}
+	for _, piece := range pieces {
+		if count, _ := CountTokens(piece); count > 20 {
+			t.Errorf("Piece has %d tokens, more than 20", count)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tokens
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaptureWriter(t *testing.T) {
+	source, err := os.ReadFile("counter.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Include a long line without whitespace to exercise cuts at character boundaries.
+	text := strings.Repeat(string(source)+"\n\n"+strings.Repeat("é", 10000)+"\n", 3)
+
+	withSettings(t, DefaultTokenizer, ModeExact)
+	exact, err := CountTokens(text)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		mode      Mode
+		chunkSize int
+		buffered  bool
+		tolerance float64
+	}{
+		{name: "Exact mode buffers", mode: ModeExact, buffered: true},
+		{name: "Fast mode streams", mode: ModeFast, tolerance: 0.001},
+		{name: "Small chunks", mode: ModeFast, chunkSize: 256, tolerance: 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, DefaultTokenizer, tt.mode)
+
+			var out bytes.Buffer
+			cw, err := NewCaptureWriter(&out, &TokenCounterOptions{ChunkSize: tt.chunkSize})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Write in uneven pieces, as serializers do.
+			for start, size := 0, 1; start < len(text); start, size = start+size, size%977+1 {
+				if _, err := cw.Write([]byte(text[start:min(start+size, len(text))])); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := cw.CountTokens(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if out.String() != text {
+				t.Error("Output differs from the written content")
+			}
+			if (cw.Buffer != nil) != tt.buffered {
+				t.Errorf("Buffered mismatch: got %v, want %v", cw.Buffer != nil, tt.buffered)
+			}
+			if len(cw.pending) > 0 {
+				t.Errorf("%d bytes left uncounted", len(cw.pending))
+			}
+
+			if deviation := float64(cw.GetTokenCount()-exact) / float64(exact); deviation > tt.tolerance || deviation < -tt.tolerance {
+				t.Errorf("Count %d deviates by %.2f%% from the exact count %d", cw.GetTokenCount(), deviation*100, exact)
+			}
+		})
+	}
+}